@@ -1,7 +1,8 @@
 /*
 Healthcheck is a simple program that sends an HTTP request to the local host (self) to a configured port number.
-It's used in environment where you need a simple probe for health checks (e.g., an empty container in docker).
-The probe URL is http://localhost:3000/liveness . Only the port can be changed.
+It's used in environment where you need a simple probe for health checks (e.g., an empty container in docker, or the
+liveness and readiness probes in Kubernetes).
+The probe URL is http://localhost:3000/liveness by default. The port and the path can be changed.
 
 Usage:
 
@@ -12,35 +13,66 @@ The flags are:
 	-port <1-65535>
 		Change the port where the request is sent.
 
+	-mode <liveness | readiness>
+		Select the probe: liveness (the server is running) or readiness (the server can serve requests, e.g.
+		the database is reachable). The path is /liveness or /readiness, respectively. Default is liveness.
+
+	-path <path>
+		Send the request to this path, instead of the one selected by -mode.
+
+	-timeout <duration>
+		Maximum duration of the request (e.g., 2s). Default is 5s.
+
 Return values (exit codes):
 
 	0
 		The request was successful (HTTP 200 or HTTP 204)
 
 	> 0
-		The request was not successful (connection error or unexpected HTTP status code)
+		The request was not successful (connection error, timeout or unexpected HTTP status code)
 */
 package main
 
 import (
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 func main() {
 	var port = flag.Int("port", 3000, "HTTP port for healthcheck")
+	var mode = flag.String("mode", "liveness", "probe to check: liveness or readiness")
+	var path = flag.String("path", "", "path of the request (overrides -mode)")
+	var timeout = flag.Duration("timeout", 5*time.Second, "timeout of the request")
 
 	flag.Parse()
 
-	res, err := http.Get(fmt.Sprintf("http://localhost:%d/liveness", *port))
+	if *path == "" {
+		switch *mode {
+		case "liveness", "readiness":
+			*path = "/" + *mode
+		default:
+			_, _ = fmt.Fprintf(os.Stderr, "Unknown mode %q, must be liveness or readiness\n", *mode)
+			os.Exit(2)
+		}
+	} else if !strings.HasPrefix(*path, "/") {
+		*path = "/" + *path
+	}
+
+	client := http.Client{Timeout: *timeout}
+	res, err := client.Get(fmt.Sprintf("http://localhost:%d%s", *port, *path))
 	if err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	} else if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		// The readiness probe tells which check failed in the body (the reason is in the server logs)
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
 		_ = res.Body.Close()
-		_, _ = fmt.Fprintln(os.Stderr, "Healthcheck request not OK: ", res.Status)
+		_, _ = fmt.Fprintln(os.Stderr, "Healthcheck request not OK: ", res.Status, strings.TrimSpace(string(body)))
 		os.Exit(1)
 	}
 	_ = res.Body.Close()
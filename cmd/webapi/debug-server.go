@@ -0,0 +1,39 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+	"sapienza/azzurra/wasaphoto/service/metrics"
+)
+
+// newDebugHandler returns the handler of the debug web server: profiler infos (/debug/pprof/), debug variables
+// (/debug/vars) and the metrics in `registry` (/metrics).
+func newDebugHandler(registry *metrics.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/metrics", registry.Handler())
+	return mux
+}
+
+// instrumentDatabase returns the AppDatabase `db` with the query timings and errors registered in `registry`.
+func instrumentDatabase(db database.AppDatabase, registry *metrics.Registry) database.AppDatabase {
+	duration := registry.NewHistogram("wasaphoto_db_query_duration_seconds",
+		"Duration of database operations, by operation.", nil, "operation")
+	errs := registry.NewCounter("wasaphoto_db_query_errors_total",
+		"Number of database operations that returned an error, by operation.", "operation")
+	return database.Instrument(db, func(operation string, d time.Duration, err error) {
+		duration.Observe(d.Seconds(), operation)
+		if err != nil {
+			errs.Inc(operation)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newLogger creates the logger described by the Log section of the configuration. The returned function closes the
+// log file, if any.
+func newLogger(cfg WebAPIConfiguration) (*logrus.Logger, func() error, error) {
+	logger := logrus.New()
+	closer := func() error { return nil }
+
+	level, err := logrus.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, closer, fmt.Errorf("invalid log level: %w", err)
+	}
+	if cfg.Debug {
+		// Kept for compatibility with configurations older than the Log section
+		level = logrus.DebugLevel
+	}
+	logger.SetLevel(level)
+
+	if cfg.Log.JSON {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{})
+	}
+	logger.SetReportCaller(cfg.Log.MethodName)
+
+	switch cfg.Log.Destination {
+	case "stdout":
+		logger.SetOutput(os.Stdout)
+	case "stderr":
+		logger.SetOutput(os.Stderr)
+	case "file":
+		if cfg.Log.File == "" {
+			return nil, closer, fmt.Errorf("the log file is required with the %q destination", cfg.Log.Destination)
+		}
+		f, err := newRotatingFile(cfg.Log.File, cfg.Log.MaxSize<<20, cfg.Log.MaxBackups)
+		if err != nil {
+			return nil, closer, fmt.Errorf("opening the log file: %w", err)
+		}
+		closer = f.Close
+		if cfg.Log.CombinedToStdout {
+			logger.SetOutput(io.MultiWriter(f, os.Stdout))
+		} else {
+			logger.SetOutput(f)
+		}
+	default:
+		return nil, closer, fmt.Errorf("invalid log destination %q", cfg.Log.Destination)
+	}
+	return logger, closer, nil
+}
+
+// rotatingFile is a log file that is rotated when it reaches maxSize bytes: `name` is renamed to `name.1` (and
+// `name.1` to `name.2`, and so on, keeping at most maxBackups old files), and a new file is created.
+type rotatingFile struct {
+	name       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func newRotatingFile(name string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{name: name, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rotateErr error
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if rotateErr = r.rotate(); rotateErr != nil {
+			// Entries are still written to the current file: the rotation is retried after maxSize more bytes
+			r.size = 0
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err == nil && rotateErr != nil {
+		// The entry is written, but the error is reported (logrus prints it on stderr)
+		err = fmt.Errorf("rotating the log file: %w", rotateErr)
+	}
+	return n, err
+}
+
+// rotate shifts the old files and opens a new file. The current file is closed only when the new one is open: if the
+// rotation fails, entries are still written to it.
+func (r *rotatingFile) rotate() error {
+	if r.maxBackups == 0 {
+		// The file is opened with O_APPEND: after the truncation, writes start from the beginning
+		if err := r.f.Truncate(0); err != nil {
+			return err
+		}
+		r.size = 0
+		return nil
+	}
+
+	_ = os.Remove(r.backupName(r.maxBackups))
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(r.backupName(i), r.backupName(i+1))
+	}
+	if err := os.Rename(r.name, r.backupName(1)); err != nil {
+		return err
+	}
+	old := r.f
+	if err := r.open(); err != nil {
+		// The current file is moved back, so that it's not shifted by the next rotation
+		_ = os.Rename(r.backupName(1), r.name)
+		return err
+	}
+	return old.Close()
+}
+
+func (r *rotatingFile) backupName(i int) string {
+	return r.name + "." + strconv.Itoa(i)
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readLogFiles returns the content of the log file and of its backups, "" for the missing ones.
+func readLogFiles(t *testing.T, name string, backups int) []string {
+	t.Helper()
+	files := make([]string, 0, backups+1)
+	for i := 0; i <= backups; i++ {
+		path := name
+		if i > 0 {
+			path = fmt.Sprintf("%s.%d", name, i)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		files = append(files, string(data))
+	}
+	return files
+}
+
+func TestRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "webapi.log")
+	f, err := newRotatingFile(name, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Each write is rotated to a new file, and backups are shifted: the oldest one is removed
+	var tests = []struct {
+		write string
+		want  []string
+	}{
+		{"0123456789", []string{"0123456789", "", "", ""}},
+		{"abc", []string{"abc", "0123456789", "", ""}},
+		{"defghijk", []string{"defghijk", "abc", "0123456789", ""}},
+		{"lmnopqrstu", []string{"lmnopqrstu", "defghijk", "abc", ""}},
+	}
+	for _, tt := range tests {
+		if n, err := f.Write([]byte(tt.write)); err != nil || n != len(tt.write) {
+			t.Fatalf("Write(%q): got %d, %v", tt.write, n, err)
+		}
+		if got := readLogFiles(t, name, 3); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("after Write(%q): got files %q, want %q", tt.write, got, tt.want)
+		}
+	}
+
+	// Writes that fit in the file are appended
+	for _, s := range []string{"v", "w"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatalf("Write(%q): %v", s, err)
+		}
+	}
+	if got := readLogFiles(t, name, 1); got[0] != "vw" || got[1] != "lmnopqrstu" {
+		t.Errorf("after small writes: got files %q, want %q", got, []string{"vw", "lmnopqrstu"})
+	}
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "webapi.log")
+	f, err := newRotatingFile(name, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, s := range []string{"0123456789", "abc", "def"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatalf("Write(%q): %v", s, err)
+		}
+	}
+	if got := readLogFiles(t, name, 1); got[0] != "abcdef" || got[1] != "" {
+		t.Errorf("got files %q, want the file truncated and no backups", got)
+	}
+}
+
+func TestRotatingFileFailure(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "webapi.log")
+	f, err := newRotatingFile(name, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A (non-empty) directory in place of the backup can't be removed nor replaced by the log file
+	if err := os.MkdirAll(filepath.Join(name+".1", "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("abc")); err == nil || n != 3 {
+		t.Errorf("Write with a failed rotation: got %d, %v, want the entry written and an error", n, err)
+	}
+
+	// Logging continues in the current file, and the rotation is retried after maxSize more bytes
+	if _, err := f.Write([]byte("def")); err != nil {
+		t.Errorf("Write after a failed rotation: %v", err)
+	}
+	if err := os.RemoveAll(name + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("ghijk")); err != nil {
+		t.Errorf("Write with a rotation: %v", err)
+	}
+	if got := readLogFiles(t, name, 1); got[0] != "ghijk" || got[1] != "0123456789abcdef" {
+		t.Errorf("got files %q, want the entries written before the rotation in the backup", got)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "webapi.log")
+	var cfg WebAPIConfiguration
+	cfg.Log.Level = "warning"
+	cfg.Log.JSON = true
+	cfg.Log.Destination = "file"
+	cfg.Log.File = name
+	cfg.Log.MaxSize = 1
+	cfg.Log.MaxBackups = 1
+
+	logger, closeLog, err := newLogger(cfg)
+	if err != nil {
+		t.Fatalf("newLogger: %v", err)
+	}
+	logger.Info("hidden")
+	logger.WithField("user", 1).Warn("shown")
+	if err := closeLog(); err != nil {
+		t.Fatalf("closing the log: %v", err)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); strings.Contains(s, "hidden") || !strings.Contains(s, `"msg":"shown"`) || !strings.Contains(s, `"user":1`) {
+		t.Errorf("log file: got %q, want only the warning in JSON", s)
+	}
+
+	var tests = []struct {
+		name        string
+		level       string
+		destination string
+		file        string
+	}{
+		{"invalid level", "verbose", "stdout", ""},
+		{"invalid destination", "info", "syslog", ""},
+		{"missing file", "info", "file", ""},
+	}
+	for _, tt := range tests {
+		var cfg WebAPIConfiguration
+		cfg.Log.Level, cfg.Log.Destination, cfg.Log.File = tt.level, tt.destination, tt.file
+		if _, _, err := newLogger(cfg); err == nil {
+			t.Errorf("%s: newLogger returned no error", tt.name)
+		}
+	}
+}
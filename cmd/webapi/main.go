@@ -1,15 +1,22 @@
 /*
 Webapi is the executable for the main web server.
 It builds a web server around APIs from `service/api`.
-Webapi connects to external resources needed (database) and starts two web servers: the API web server, and the debug.
-Everything is served via the API web server, except debug variables (/debug/vars) and profiler infos (pprof).
+Webapi connects to external resources needed (database and images storage) and starts two web servers: the API web
+server, and the debug.
+Everything is served via the API web server, except debug variables (/debug/vars), profiler infos (pprof) and metrics
+in the Prometheus text format (/metrics), served via the debug web server. The debug web server is disabled when its
+address (Web.DebugHost) is empty.
 
 Usage:
 
 	webapi [flags]
+	webapi [flags] migrate [up | down [steps] | status]
 
 Flags and configurations are handled automatically by the code in `load-configuration.go`.
 
+The `migrate` subcommand applies (`up`, the default) or reverts (`down`, one migration by default) the database schema
+migrations, or prints the schema version (`status`), and then exits without starting the web servers.
+
 Return values (exit codes):
 
 	0
@@ -25,7 +32,6 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -37,10 +43,9 @@ import (
 	"sapienza/azzurra/wasaphoto/service/api"
 	"sapienza/azzurra/wasaphoto/service/database"
 	"sapienza/azzurra/wasaphoto/service/globaltime"
+	"sapienza/azzurra/wasaphoto/service/metrics"
 
 	"github.com/ardanlabs/conf"
-	_ "github.com/mattn/go-sqlite3"
-	"github.com/sirupsen/logrus"
 )
 
 // main is the program entry point. The only purpose of this function is to call run() and set the exit code if there is
@@ -58,8 +63,9 @@ func main() {
 // * connects to any external resources (like databases, authenticators, etc.)
 // * creates an instance of the service/api package
 // * starts the principal web server (using the service/api.Router.Handler() for HTTP handlers)
+// * starts the debug web server (pprof, expvar and metrics)
 // * waits for any termination event: SIGTERM signal (UNIX), non-recoverable server error, etc.
-// * closes the principal web server
+// * closes the principal and the debug web servers
 func run() error {
 	rand.Seed(globaltime.Now().UnixNano())
 	// Load Configuration and defaults
@@ -72,35 +78,56 @@ func run() error {
 	}
 
 	// Init logging
-	logger := logrus.New()
-	logger.SetOutput(os.Stdout)
-	if cfg.Debug {
-		logger.SetLevel(logrus.DebugLevel)
-	} else {
-		logger.SetLevel(logrus.InfoLevel)
+	logger, closeLog, err := newLogger(cfg)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		_ = closeLog()
+	}()
 
 	logger.Infof("application initializing")
 
 	// Start Database
 	logger.Println("initializing database support")
-	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename)
-	pragma := `PRAGMA foreign_keys = ON;`
-	_, err = dbconn.Exec(pragma)
+	dbconn, err := openDatabase(cfg)
 	if err != nil {
-		logger.WithError(err).Error("error opening SQLite DB")
-		return fmt.Errorf("opening SQLite: %w", err)
+		logger.WithError(err).Error("error opening the database")
+		return fmt.Errorf("opening the database: %w", err)
 	}
 	defer func() {
 		logger.Debug("database stopping")
 		_ = dbconn.Close()
 	}()
-	db, err := database.New(dbconn)
+
+	if cfg.Args.Num(0) == "migrate" {
+		return runMigrate(logger, dbconn, cfg.DB.Driver, cfg.Args[1:])
+	}
+
+	applied, err := database.MigrateUp(dbconn, cfg.DB.Driver)
+	if err != nil {
+		logger.WithError(err).Error("error migrating the database")
+		return fmt.Errorf("migrating the database: %w", err)
+	} else if applied > 0 {
+		logger.Infof("database schema updated, %d migration(s) applied", applied)
+	}
+
+	db, err := newAppDatabase(cfg, dbconn)
 	if err != nil {
 		logger.WithError(err).Error("error creating AppDatabase")
 		return fmt.Errorf("creating AppDatabase: %w", err)
 	}
 
+	images, err := openStorage(cfg)
+	if err != nil {
+		logger.WithError(err).Error("error opening the images storage")
+		return fmt.Errorf("opening the images storage: %w", err)
+	}
+
+	// Metrics are collected in the registry, and exposed by the debug server
+	registry := metrics.NewRegistry()
+	db = instrumentDatabase(db, registry)
+
 	// Start (main) API server
 	logger.Info("initializing API server")
 
@@ -111,12 +138,21 @@ func run() error {
 
 	// Make a channel to listen for errors coming from the listener. Use a
 	// buffered channel so the goroutine can exit if we don't collect this error.
-	serverErrors := make(chan error, 1)
+	// There is a slot for each server.
+	serverErrors := make(chan error, 2)
 
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:            logger,
+		Database:          db,
+		Storage:           images,
+		PresignTTL:        cfg.Storage.PresignTTL,
+		Metrics:           registry,
+		BehindProxy:       cfg.Web.BehindProxy,
+		SessionTTL:        cfg.Web.SessionTTL,
+		MaxImageBytes:     cfg.Images.MaxBytes,
+		MaxImageDimension: cfg.Images.MaxDimension,
+		KeepImageMetadata: cfg.Images.KeepMetadata,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -149,6 +185,21 @@ func run() error {
 		logger.Infof("stopping API server")
 	}()
 
+	// Start the debug server, if enabled. It has no write timeout, as CPU profiles and traces last as long as requested
+	var debugserver *http.Server
+	if cfg.Web.DebugHost != "" {
+		debugserver = &http.Server{
+			Addr:              cfg.Web.DebugHost,
+			Handler:           newDebugHandler(registry),
+			ReadHeaderTimeout: cfg.Web.ReadTimeout,
+		}
+		go func() {
+			logger.Infof("debug server listening on %s", debugserver.Addr)
+			serverErrors <- debugserver.ListenAndServe()
+			logger.Infof("stopping debug server")
+		}()
+	}
+
 	// Waiting for shutdown signal or POSIX signals
 	select {
 	case err := <-serverErrors:
@@ -168,7 +219,13 @@ func run() error {
 		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
 		defer cancel()
 
-		// Asking listener to shut down and load shed.
+		// Asking listeners to shut down and load shed.
+		if debugserver != nil {
+			if err := debugserver.Shutdown(ctx); err != nil {
+				logger.WithError(err).Warning("error during graceful shutdown of debug server")
+				_ = debugserver.Close()
+			}
+		}
 		err = apiserver.Shutdown(ctx)
 		if err != nil {
 			logger.WithError(err).Warning("error during graceful shutdown of HTTP server")
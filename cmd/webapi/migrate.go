@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runMigrate executes the `migrate` subcommand. `args` are the positional arguments after `migrate`.
+func runMigrate(logger *logrus.Logger, dbconn *sql.DB, driver string, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		applied, err := database.MigrateUp(dbconn, driver)
+		if err != nil {
+			return fmt.Errorf("migrating the database: %w", err)
+		}
+		logger.Infof("%d migration(s) applied", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := database.MigrateDown(dbconn, driver, steps)
+		if err != nil {
+			return fmt.Errorf("reverting migrations: %w", err)
+		}
+		logger.Infof("%d migration(s) reverted", reverted)
+	case "status":
+		state, err := database.MigrationStatus(dbconn, driver)
+		if err != nil {
+			return fmt.Errorf("reading the schema status: %w", err)
+		}
+		logger.Infof("schema version %d, latest version %d", state.Current, state.Latest)
+		for _, m := range state.Pending {
+			logger.Infof("pending migration: %d_%s", m.Version, m.Name)
+		}
+	default:
+		return fmt.Errorf("unknown migrate action %q, expected up, down or status", action)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openDatabase opens the connection pool to the database selected by the DB section of the configuration.
+func openDatabase(cfg WebAPIConfiguration) (*sql.DB, error) {
+	switch cfg.DB.Driver {
+	case database.DriverSQLite:
+		// Options are set in the DSN so that they apply to every connection of the pool: transactions take the write
+		// lock when they begin (instead of failing on upgrade when another connection is writing), and busy connections
+		// wait
+		return sql.Open(database.DriverSQLite, cfg.DB.Filename+"?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate")
+	case database.DriverPostgres:
+		if cfg.DB.DSN == "" {
+			return nil, fmt.Errorf("the DSN is required for the %s driver", cfg.DB.Driver)
+		}
+		return sql.Open(database.DriverPostgres, cfg.DB.DSN)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.DB.Driver)
+	}
+}
+
+// newAppDatabase initializes the AppDatabase for the driver in the configuration.
+func newAppDatabase(cfg WebAPIConfiguration, dbconn *sql.DB) (database.AppDatabase, error) {
+	if cfg.DB.Driver == database.DriverPostgres {
+		return database.NewPostgres(dbconn)
+	}
+	return database.New(dbconn)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"sapienza/azzurra/wasaphoto/service/storage"
+)
+
+// openStorage returns the store of the images selected by the Storage section of the configuration.
+func openStorage(cfg WebAPIConfiguration) (storage.BlobStore, error) {
+	switch cfg.Storage.Backend {
+	case "local":
+		return storage.NewLocal(cfg.Storage.Folder), nil
+	case "s3":
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  cfg.Storage.S3.Endpoint,
+			Region:    cfg.Storage.S3.Region,
+			Bucket:    cfg.Storage.S3.Bucket,
+			AccessKey: cfg.Storage.S3.AccessKey,
+			SecretKey: cfg.Storage.S3.SecretKey,
+			PathStyle: cfg.Storage.S3.PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", cfg.Storage.Backend)
+	}
+}
@@ -1,9 +1,13 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"sapienza/azzurra/wasaphoto/service/api/reqcontext"
+	"sapienza/azzurra/wasaphoto/service/database"
 
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
@@ -14,9 +18,35 @@ import (
 // required by the httprouter package.
 type httpRouterHandler func(http.ResponseWriter, *http.Request, httprouter.Params, reqcontext.RequestContext)
 
-// wrap parses the request and adds a reqcontext.RequestContext instance related to the request.
-func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Request, httprouter.Params) {
-	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// authMode tells wrap which kind of authentication is required by a route.
+type authMode int
+
+const (
+	// authNone means that the route is public (e.g., the login).
+	authNone authMode = iota
+
+	// authUser means that any authenticated user can call the route.
+	authUser
+
+	// authSelf means that the route acts on behalf of the `:userId` path parameter, so the bearer token must belong to
+	// that same user.
+	authSelf
+
+	// authQuery is like authUser, but the token can also be passed in the `access_token` query parameter (RFC 6750),
+	// as browsers can't send headers when loading images. It's only for routes reading images: tokens in URLs end up
+	// in logs and in the browser history, so they must not be accepted by routes that change something.
+	authQuery
+)
+
+// wrap parses the request and adds a reqcontext.RequestContext instance related to the request. Depending on `auth`,
+// the bearer token in the Authorization header is resolved into the authenticated user (see authMode). Metrics of the
+// request are recorded with the name of `fn` as route.
+func (rt *_router) wrap(fn httpRouterHandler, auth authMode) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+	route := routeName(fn)
+	return func(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w := &statusRecorder{ResponseWriter: rw}
+		defer rt.metrics.observe(route, r, w, time.Now())
+
 		reqUUID, err := uuid.NewV4()
 		if err != nil {
 			rt.baseLogger.WithError(err).Error("can't generate a request UUID")
@@ -30,10 +60,76 @@ func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Re
 		// Create a request-specific logger
 		ctx.Logger = rt.baseLogger.WithFields(logrus.Fields{
 			"reqid":     ctx.ReqUUID.String(),
-			"remote-ip": r.RemoteAddr,
+			"remote-ip": rt.remoteIP(r),
 		})
 
+		if auth != authNone && !rt.authenticate(w, r, ps, &ctx, auth) {
+			return
+		}
+
 		// Call the next handler in chain (usually, the handler function for the path)
 		fn(w, r, ps, ctx)
 	}
 }
+
+// authenticate resolves the bearer token of the request into ctx.User. If the user is not authenticated (or, for
+// authSelf routes, is not the user in the path), an error is sent to the client and false is returned.
+func (rt *_router) authenticate(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx *reqcontext.RequestContext, auth authMode) bool {
+	token := bearerToken(r, auth == authQuery)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		sendProblem(w, r, *ctx, http.StatusUnauthorized, codeUnauthenticated, "missing bearer token")
+		return false
+	}
+
+	user, err := rt.db.GetSessionUser(r.Context(), token, time.Now().Add(-rt.sessionTTL))
+	if errors.Is(err, database.ErrSessionNotExists) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		sendProblem(w, r, *ctx, http.StatusUnauthorized, codeUnauthenticated, "invalid bearer token")
+		return false
+	} else if err != nil {
+		sendInternalError(w, r, *ctx, err, "auth: error retrieving the session")
+		return false
+	}
+	ctx.User = &user
+	ctx.Logger = ctx.Logger.WithField("userid", user.ID)
+
+	if auth == authSelf {
+		ids, ok := pathIDs(w, r, ps, *ctx, "userId")
+		if !ok {
+			return false
+		} else if ids[0] != user.ID {
+			ctx.Logger.WithField("path-userid", ids[0]).Warn("auth: user acting on behalf of another user")
+			sendProblem(w, r, *ctx, http.StatusForbidden, codeForbidden, "the operation can only be done by the user itself")
+			return false
+		}
+	}
+	return true
+}
+
+// bearerToken returns the token in the "Authorization: Bearer <token>" header, or an empty string if missing. If
+// fromQuery is true, the token is read from the `access_token` query parameter as a fallback (see authQuery).
+func bearerToken(r *http.Request, fromQuery bool) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		if fromQuery {
+			return r.URL.Query().Get("access_token")
+		}
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// remoteIP returns the address of the client. Behind a reverse proxy, it's the last address in the X-Forwarded-For
+// header, the one added by the proxy (the previous ones are sent by the client, so they can't be trusted).
+func (rt *_router) remoteIP(r *http.Request) string {
+	if !rt.behindProxy {
+		return r.RemoteAddr
+	}
+	forwarded := strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+	addrs := strings.Split(forwarded, ",")
+	if last := strings.TrimSpace(addrs[len(addrs)-1]); last != "" {
+		return last
+	}
+	return r.RemoteAddr
+}
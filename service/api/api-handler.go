@@ -7,24 +7,39 @@ import (
 // Handler returns an instance of httprouter.Router that handle APIs registered here
 func (rt *_router) Handler() http.Handler {
 	// Register routes
-	rt.router.POST("/session", rt.wrap(rt.doLogin))
-	rt.router.PUT("/users/:userId/username", rt.wrap(rt.setMyUserName))
-	rt.router.PUT("/users/:userId/following/:followingId", rt.wrap(rt.followUser))
-	rt.router.DELETE("/users/:userId/following/:followingId", rt.wrap(rt.unfollowUser))
-	rt.router.PUT("/users/:userId/bans/:userBanId", rt.wrap(rt.banUser))
-	rt.router.DELETE("/users/:userId/bans/:userBanId", rt.wrap(rt.unbanUser))
-	rt.router.GET("/users/:userId", rt.wrap(rt.getUserProfile))
-	rt.router.GET("/users/:userId/streams", rt.wrap(rt.getMyStream))
+	rt.router.POST("/session", rt.wrap(rt.doLogin, authNone))
+	rt.router.PUT("/users/:userId/username", rt.wrap(rt.setMyUserName, authSelf))
+	rt.router.GET("/users/:userId/followers", rt.wrap(rt.getFollowers, authUser))
+	rt.router.GET("/users/:userId/following", rt.wrap(rt.getFollowing, authUser))
+	rt.router.PUT("/users/:userId/following/:followingId", rt.wrap(rt.followUser, authSelf))
+	rt.router.DELETE("/users/:userId/following/:followingId", rt.wrap(rt.unfollowUser, authSelf))
+	rt.router.PUT("/users/:userId/bans/:userBanId", rt.wrap(rt.banUser, authSelf))
+	rt.router.DELETE("/users/:userId/bans/:userBanId", rt.wrap(rt.unbanUser, authSelf))
+	rt.router.GET("/users", rt.wrap(rt.searchUsers, authUser))
+	rt.router.GET("/users/:userId", rt.wrap(rt.getUserProfile, authUser))
+	rt.router.GET("/users/:userId/streams", rt.wrap(rt.getMyStream, authSelf))
+	rt.router.GET("/users/:userId/liked", rt.wrap(rt.getLikedPhotos, authSelf))
+	rt.router.GET("/users/:userId/notifications", rt.wrap(rt.getNotifications, authSelf))
+	rt.router.POST("/users/:userId/notifications/read", rt.wrap(rt.markNotificationsRead, authSelf))
 
-	rt.router.POST("/users/:userId/photos", rt.wrap(rt.uploadPhoto))
-	rt.router.DELETE("/users/:userId/photos/:photoId", rt.wrap(rt.deletePhoto))
-	rt.router.PUT("/users/:userId/photos/:photoId/likes", rt.wrap(rt.likePhoto))
-	rt.router.DELETE("/users/:userId/photos/:photoId/likes", rt.wrap(rt.unlikePhoto))
-	rt.router.POST("/users/:userId/photos/:photoId/comments", rt.wrap(rt.commentPhoto))
-	rt.router.DELETE("/users/:userId/photos/:photoId/comments/:commentId", rt.wrap(rt.uncommentPhoto))
+	rt.router.POST("/users/:userId/photos", rt.wrap(rt.uploadPhoto, authSelf))
+	rt.router.GET("/users/:userId/photos/:photoId", rt.wrap(rt.getPhoto, authUser))
+	rt.router.PATCH("/users/:userId/photos/:photoId", rt.wrap(rt.editPhoto, authSelf))
+	rt.router.DELETE("/users/:userId/photos/:photoId", rt.wrap(rt.deletePhoto, authSelf))
+	rt.router.GET("/users/:userId/photos/:photoId/image", rt.wrap(rt.getPhotoImage, authQuery))
+	rt.router.GET("/users/:userId/photos/:photoId/likes", rt.wrap(rt.getPhotoLikes, authSelf))
+	rt.router.PUT("/users/:userId/photos/:photoId/likes", rt.wrap(rt.likePhoto, authSelf))
+	rt.router.DELETE("/users/:userId/photos/:photoId/likes", rt.wrap(rt.unlikePhoto, authSelf))
+	rt.router.GET("/users/:userId/photos/:photoId/comments", rt.wrap(rt.getPhotoComments, authSelf))
+	rt.router.POST("/users/:userId/photos/:photoId/comments", rt.wrap(rt.commentPhoto, authSelf))
+	rt.router.DELETE("/users/:userId/photos/:photoId/comments/:commentId", rt.wrap(rt.uncommentPhoto, authSelf))
+
+	rt.router.GET("/tags", rt.wrap(rt.searchTags, authUser))
+	rt.router.GET("/tags/:tag/photos", rt.wrap(rt.getTagPhotos, authUser))
 
 	// Special routes
 	rt.router.GET("/liveness", rt.liveness)
+	rt.router.GET("/readiness", rt.readiness)
 
 	return rt.router
 }
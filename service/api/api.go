@@ -39,8 +39,11 @@ package api
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"sapienza/azzurra/wasaphoto/service/database"
+	"sapienza/azzurra/wasaphoto/service/metrics"
+	"sapienza/azzurra/wasaphoto/service/storage"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
@@ -54,8 +57,42 @@ type Config struct {
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
 
-	// ImagesFolder is the folder where the images are stored
+	// Storage is where the images are saved. If nil, images are saved in ImagesFolder
+	Storage storage.BlobStore
+
+	// ImagesFolder is the folder where the images are saved when Storage is nil. Default is /tmp
 	ImagesFolder string
+
+	// PresignTTL, if not zero, redirects the requests of images to presigned URLs of the storage valid for this
+	// duration, so that images are downloaded directly from the storage. It's ignored if the storage doesn't support
+	// presigned URLs (e.g., the local folder)
+	PresignTTL time.Duration
+
+	// MaxImageBytes is the maximum size (in bytes) of uploaded images. Default is 10 MiB
+	MaxImageBytes int64
+
+	// MaxImageDimension is the maximum width and height (in pixels) of uploaded images. Default is 8192
+	MaxImageDimension int
+
+	// KeepImageMetadata stores uploaded images with their metadata (EXIF, XMP, ...). By default, metadata are removed,
+	// as they may contain the location of the user
+	KeepImageMetadata bool
+
+	// MinFreeSpace is the free space (in bytes) required in the images folder for the server to be ready, if images are
+	// saved in a local folder. Default is 64 MiB
+	MinFreeSpace uint64
+
+	// SessionTTL is the validity of the session tokens issued at login: expired tokens are rejected, and deleted at the
+	// next login. Default is 30 days
+	SessionTTL time.Duration
+
+	// BehindProxy is true if requests come from a trusted reverse proxy: the address of the client is read from the
+	// X-Forwarded-For header
+	BehindProxy bool
+
+	// Metrics is the registry where the metrics of the API server are registered. If nil, metrics are collected but
+	// not exposed.
+	Metrics *metrics.Registry
 }
 
 // Router is the package API interface representing an API handler builder
@@ -77,8 +114,26 @@ func New(cfg Config) (Router, error) {
 		return nil, errors.New("database is required")
 	}
 
-	if cfg.ImagesFolder == "" {
-		cfg.ImagesFolder = "/tmp"
+	if cfg.Storage == nil {
+		if cfg.ImagesFolder == "" {
+			cfg.ImagesFolder = "/tmp"
+		}
+		cfg.Storage = storage.NewLocal(cfg.ImagesFolder)
+	}
+	if cfg.MaxImageBytes <= 0 {
+		cfg.MaxImageBytes = 10 << 20
+	}
+	if cfg.MaxImageDimension <= 0 {
+		cfg.MaxImageDimension = 8192
+	}
+	if cfg.MinFreeSpace == 0 {
+		cfg.MinFreeSpace = 64 << 20
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = 30 * 24 * time.Hour
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.NewRegistry()
 	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
@@ -88,10 +143,20 @@ func New(cfg Config) (Router, error) {
 	router.RedirectFixedPath = false
 
 	return &_router{
-		router:       router,
-		baseLogger:   cfg.Logger,
-		db:           cfg.Database,
-		imagesFolder: cfg.ImagesFolder,
+		router:     router,
+		baseLogger: cfg.Logger,
+		db:         cfg.Database,
+		images:     cfg.Storage,
+		presignTTL: cfg.PresignTTL,
+		imageLimits: imageLimits{
+			MaxBytes:     cfg.MaxImageBytes,
+			MaxDimension: cfg.MaxImageDimension,
+		},
+		keepImageMetadata: cfg.KeepImageMetadata,
+		minFreeSpace:      cfg.MinFreeSpace,
+		sessionTTL:        cfg.SessionTTL,
+		behindProxy:       cfg.BehindProxy,
+		metrics:           newAPIMetrics(cfg.Metrics),
 	}, nil
 }
 
@@ -104,5 +169,29 @@ type _router struct {
 
 	db database.AppDatabase
 
-	imagesFolder string
+	// images is where the images are saved
+	images storage.BlobStore
+
+	// presignTTL is the validity of presigned URLs of images, 0 to serve images from the API server (see getPhotoImage)
+	presignTTL time.Duration
+
+	// imageLimits are the limits of the uploaded images
+	imageLimits imageLimits
+
+	// keepImageMetadata is true if uploaded images are stored with their metadata (see stripMetadata)
+	keepImageMetadata bool
+
+	// minFreeSpace is the free space (in bytes) required in the local images folder by the readiness probe
+	minFreeSpace uint64
+
+	// storageCheck is the cached result of the images storage check of the readiness probe
+	storageCheck cachedCheck
+
+	// sessionTTL is the validity of the session tokens (see authenticate)
+	sessionTTL time.Duration
+
+	// behindProxy is true if the address of the client is read from the X-Forwarded-For header (see remoteIP)
+	behindProxy bool
+
+	metrics *apiMetrics
 }
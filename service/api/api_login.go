@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"time"
 
 	"sapienza/azzurra/wasaphoto/service/api/reqcontext"
 
 	"sapienza/azzurra/wasaphoto/service/database"
 
+	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -17,43 +19,45 @@ func (rt *_router) doLogin(w http.ResponseWriter, r *http.Request, ps httprouter
 	var user User
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "Error decoding JSON",
-		}
-		ctx.Logger.WithError(err).Error("user: error decoding JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeInvalidBody, "the body is not a valid JSON user")
 		return
 	} else if !user.IsValid() {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "Error validating JSON",
-		}
-		ctx.Logger.Error("user: error validating JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "invalid username",
+			FieldError{Field: "username", Message: usernameRule})
 		return
 	}
 
-	// Create user in the DB
-	dbuser, err := rt.db.CreateUser(user.ToDatabase())
+	// Create user in the DB, or log in the existing one
+	status := http.StatusCreated
+	dbuser, err := rt.db.CreateUser(r.Context(), user.ToDatabase())
 	if errors.Is(err, database.ErrUserExists) {
-		resp := ApiResponse{
-			Code:    http.StatusConflict,
-			Message: "user: The user alredy exists",
-		}
-		w.WriteHeader(http.StatusConflict)
-		_ = json.NewEncoder(w).Encode(resp)
+		status = http.StatusOK
+		dbuser, err = rt.db.GetUserByUsername(r.Context(), user.Username)
+	}
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "user: error creating user in DB")
+		return
+	}
+
+	// Issue a new session token
+	token, err := uuid.NewV4()
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "user: error creating the session token")
 		return
-	} else if err != nil {
-		ctx.Logger.WithError(err).Error("user: error creating user in DB")
-		w.WriteHeader(http.StatusInternalServerError)
+	}
+	if err := rt.db.CreateSession(r.Context(), dbuser.ID, token.String(), time.Now().Add(-rt.sessionTTL)); err != nil {
+		sendInternalError(w, r, ctx, err, "user: error saving the session in DB")
 		return
 	}
 
 	user.FromDatabase(dbuser)
+	session := Session{
+		ID:       user.ID,
+		Username: user.Username,
+		Token:    token.String(),
+	}
 	// Send the response
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(user)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(session)
 }
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLogin(t *testing.T) {
+	srv := newTestServer(t)
+
+	var tests = []struct {
+		name string
+		body string
+		want int
+	}{
+		{"new user", `{"username":"alice"}`, http.StatusCreated},
+		{"existing user", `{"username":"alice"}`, http.StatusOK},
+		{"short username", `{"username":"al"}`, http.StatusBadRequest},
+		{"invalid characters", `{"username":"al ice"}`, http.StatusBadRequest},
+		{"invalid JSON", `{"username":`, http.StatusBadRequest},
+	}
+	var ids []uint64
+	for _, tt := range tests {
+		var s Session
+		if status := doJSON(t, srv, Session{}, http.MethodPost, "/session", tt.body, &s); status != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, status, tt.want)
+		} else if status < 300 {
+			if s.Token == "" || s.Username != "alice" {
+				t.Errorf("%s: got session %+v", tt.name, s)
+			}
+			ids = append(ids, s.ID)
+		}
+	}
+	if len(ids) == 2 && ids[0] != ids[1] {
+		t.Errorf("logging in again returned another user: %v", ids)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	path := fmt.Sprintf("/users/%d/streams", alice.ID)
+	image := fmt.Sprintf("/users/%d/photos/%d/image", alice.ID, uploadTestPhoto(t, srv, alice))
+
+	var tests = []struct {
+		name    string
+		session Session
+		path    string
+		want    int
+	}{
+		{"missing token", Session{}, path, http.StatusUnauthorized},
+		{"invalid token", Session{Token: "invalid"}, path, http.StatusUnauthorized},
+		{"another user", bob, path, http.StatusForbidden},
+		{"invalid user ID", alice, "/users/alice/streams", http.StatusBadRequest},
+		{"same user", alice, path, http.StatusOK},
+		{"token in the query", Session{}, path + "?access_token=" + alice.Token, http.StatusUnauthorized},
+		{"token in the query of an image", Session{}, image + "?access_token=" + alice.Token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status := doRequest(t, srv, tt.session, http.MethodGet, tt.path, "", nil); status != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, status, tt.want)
+		}
+	}
+
+	res := send(t, srv, Session{}, http.MethodGet, path, "", bytes.NewReader(nil))
+	_ = res.Body.Close()
+	if res.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("missing WWW-Authenticate header in the 401 response")
+	}
+}
+
+func TestSessionExpiration(t *testing.T) {
+	srv := newTestServerWith(t, Config{SessionTTL: 50 * time.Millisecond})
+	alice := login(t, srv, "alice")
+	path := fmt.Sprintf("/users/%d/streams", alice.ID)
+	if status := doRequest(t, srv, alice, http.MethodGet, path, "", nil); status != http.StatusOK {
+		t.Fatalf("new session: got status %d", status)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if status := doRequest(t, srv, alice, http.MethodGet, path, "", nil); status != http.StatusUnauthorized {
+		t.Errorf("expired session: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	alice = login(t, srv, "alice")
+	if status := doRequest(t, srv, alice, http.MethodGet, path, "", nil); status != http.StatusOK {
+		t.Errorf("session after a new login: got status %d", status)
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	var tests = []struct {
+		behindProxy bool
+		forwarded   []string
+		want        string
+	}{
+		{false, []string{"10.0.0.1"}, "192.0.2.1:1234"},
+		{true, nil, "192.0.2.1:1234"},
+		{true, []string{"10.0.0.1"}, "10.0.0.1"},
+		// The addresses sent by the client are ignored, only the one added by the proxy is used
+		{true, []string{"203.0.113.7, 10.0.0.1"}, "10.0.0.1"},
+		{true, []string{"203.0.113.7", "10.0.0.2"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		rt := &_router{behindProxy: tt.behindProxy}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		for _, f := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		if got := rt.remoteIP(r); got != tt.want {
+			t.Errorf("remoteIP(behindProxy=%v, %q): got %q, want %q", tt.behindProxy, tt.forwarded, got, tt.want)
+		}
+	}
+}
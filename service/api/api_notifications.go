@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sapienza/azzurra/wasaphoto/service/api/reqcontext"
+	"sapienza/azzurra/wasaphoto/service/database"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// getNotifications sends a page of the notifications of the logged in user, grouped and most recent first, with the
+// number of unread ones.
+func (rt *_router) getNotifications(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	page, ok := readPage(w, r, ctx)
+	if !ok {
+		return
+	}
+
+	dbnotifications, err := rt.db.ListNotifications(r.Context(), ctx.User.ID, lookahead(page))
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "notifications: error listing the notifications")
+		return
+	}
+	unread, err := rt.db.CountUnreadNotifications(r.Context(), ctx.User.ID)
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "notifications: error counting the unread notifications")
+		return
+	}
+
+	notifications := Notifications{
+		Notifications: make([]Notification, 0, len(dbnotifications)),
+		UnreadCount:   unread,
+	}
+	if len(dbnotifications) > page.Limit {
+		dbnotifications = dbnotifications[:page.Limit]
+		last := dbnotifications[len(dbnotifications)-1]
+		notifications.NextCursor = encodeCursor(database.Cursor{Time: last.Datetime, ID: last.Id})
+	}
+	for _, d := range dbnotifications {
+		var n Notification
+		n.FromDatabase(d)
+		notifications.Notifications = append(notifications.Notifications, n)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(notifications)
+}
+
+// markNotificationsRead marks the notifications of the logged in user as read: all of them, or those up to the
+// `last_id` of the body (if any).
+func (rt *_router) markNotificationsRead(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	var req NotificationsRead
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeInvalidBody, "the body is not a valid JSON object")
+		return
+	}
+
+	if err := rt.db.MarkNotificationsRead(r.Context(), ctx.User.ID, req.LastId, time.Now()); err != nil {
+		sendInternalError(w, r, ctx, err, "notifications: error marking the notifications as read")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNotifications(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	carol := login(t, srv, "carol")
+
+	list := func(s Session, query string) Notifications {
+		t.Helper()
+		var n Notifications
+		if status := doJSON(t, srv, s, http.MethodGet, fmt.Sprintf("/users/%d/notifications%s", s.ID, query), "", &n); status != http.StatusOK {
+			t.Fatalf("notifications: got status %d", status)
+		}
+		return n
+	}
+	texts := func(n Notifications) string {
+		var texts []string
+		for _, n := range n.Notifications {
+			texts = append(texts, n.Text)
+		}
+		return strings.Join(texts, "; ")
+	}
+	markRead := func(s Session, body string) {
+		t.Helper()
+		if status := doRequest(t, srv, s, http.MethodPost, fmt.Sprintf("/users/%d/notifications/read", s.ID), "application/json", strings.NewReader(body)); status != http.StatusNoContent {
+			t.Fatalf("mark read: got status %d", status)
+		}
+	}
+
+	photoId := uploadTestPhoto(t, srv, alice)
+	for _, s := range []Session{bob, carol} {
+		if status := doRequest(t, srv, s, http.MethodPut, fmt.Sprintf("/users/%d/following/%d", s.ID, alice.ID), "", nil); status != http.StatusNoContent {
+			t.Fatalf("follow: got status %d", status)
+		}
+		if status := doRequest(t, srv, s, http.MethodPut, fmt.Sprintf("/users/%d/photos/%d/likes", s.ID, photoId), "", nil); status != http.StatusOK {
+			t.Fatalf("like: got status %d", status)
+		}
+	}
+	if status := doJSON(t, srv, bob, http.MethodPost, fmt.Sprintf("/users/%d/photos/%d/comments", bob.ID, photoId), `{"text":"nice"}`, nil); status != http.StatusOK {
+		t.Fatalf("comment: got status %d", status)
+	}
+	// Self-likes are not notified
+	if status := doRequest(t, srv, alice, http.MethodPut, fmt.Sprintf("/users/%d/photos/%d/likes", alice.ID, photoId), "", nil); status != http.StatusOK {
+		t.Fatalf("like: got status %d", status)
+	}
+
+	n := list(alice, "")
+	want := "bob commented on your photo; carol and 1 other liked your photo; carol and 1 other started following you"
+	if got := texts(n); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	} else if n.UnreadCount != 3 {
+		t.Errorf("got %d unread, want 3", n.UnreadCount)
+	} else if p := n.Notifications[1].Photo; p == nil || p.Id != photoId || p.UserId != alice.ID || n.Notifications[1].Type != "like" {
+		t.Errorf("got like notification %+v", n.Notifications[1])
+	}
+
+	// Pagination
+	first := list(alice, "?limit=2")
+	if len(first.Notifications) != 2 || first.NextCursor == "" {
+		t.Fatalf("got first page %+v", first)
+	}
+	second := list(alice, "?limit=2&cursor="+first.NextCursor)
+	if texts(second) != "carol and 1 other started following you" || second.NextCursor != "" {
+		t.Errorf("got second page %q, cursor %q", texts(second), second.NextCursor)
+	}
+
+	// Only the notifications up to last_id are marked as read
+	markRead(alice, fmt.Sprintf(`{"last_id":%d}`, n.Notifications[1].Id))
+	n = list(alice, "")
+	if n.UnreadCount != 1 || !n.Notifications[1].Read || !n.Notifications[2].Read || n.Notifications[0].Read {
+		t.Errorf("after marking read up to the like: got %+v", n)
+	}
+
+	// New notifications start a new group, after the read ones
+	dave := login(t, srv, "dave")
+	if status := doRequest(t, srv, dave, http.MethodPut, fmt.Sprintf("/users/%d/photos/%d/likes", dave.ID, photoId), "", nil); status != http.StatusOK {
+		t.Fatalf("like: got status %d", status)
+	}
+	markRead(alice, "")
+	n = list(alice, "")
+	want = "dave liked your photo; bob commented on your photo; carol and 1 other liked your photo; carol and 1 other started following you"
+	if got := texts(n); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	} else if n.UnreadCount != 0 {
+		t.Errorf("got %d unread, want 0", n.UnreadCount)
+	}
+
+	// Unliking removes the notification
+	if status := doRequest(t, srv, dave, http.MethodDelete, fmt.Sprintf("/users/%d/photos/%d/likes", dave.ID, photoId), "", nil); status != http.StatusOK {
+		t.Fatalf("unlike: got status %d", status)
+	}
+	if got := texts(list(alice, "")); strings.Contains(got, "dave") {
+		t.Errorf("got %q after unliking", got)
+	}
+
+	if status := doRequest(t, srv, bob, http.MethodGet, fmt.Sprintf("/users/%d/notifications", alice.ID), "", nil); status != http.StatusForbidden {
+		t.Errorf("notifications of another user: got status %d, want 403", status)
+	}
+	if status, p := doProblem(t, srv, alice, http.MethodPost, fmt.Sprintf("/users/%d/notifications/read", alice.ID), "{"); status != http.StatusBadRequest || p.Code != codeInvalidBody {
+		t.Errorf("invalid body: got status %d, %+v", status, p)
+	}
+}
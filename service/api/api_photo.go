@@ -1,282 +1,580 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"strconv"
 	"time"
 
 	"sapienza/azzurra/wasaphoto/service/api/reqcontext"
 	"sapienza/azzurra/wasaphoto/service/database"
+	"sapienza/azzurra/wasaphoto/service/storage"
 
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 )
 
 func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	userId, err := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "error parsing JSON",
-		}
-		ctx.Logger.WithError(err).Error("stream: Error parsing userId")
-		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(resp)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId")
+	if !ok {
 		return
 	}
-	photoId, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "error parsing JSON",
-		}
-		ctx.Logger.WithError(err).Error("photo: Error parsing photoId")
-		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(resp)
+	userId, photoId := ids[0], ids[1]
+
+	dbPhoto, err := rt.db.GetPhotoByID(r.Context(), photoId)
+	if errors.Is(err, database.ErrPhotoNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "photo not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "photo: error retrieving the photo")
+		return
+	} else if !rt.checkBan(w, r, ctx, dbPhoto.UserId, interactionComment) {
 		return
 	}
+
 	var req CommentRequest
-	errR := json.NewDecoder(r.Body).Decode(&req)
-	if errR != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "Error decoding JSON",
-		}
-		ctx.Logger.WithError(errR).Error("comment: error decoding JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeInvalidBody, "the body is not a valid JSON comment")
 		return
 	}
-	dbcomment, err := rt.db.CommentPhoto(userId, photoId, req.ToDatabase())
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "Constraints Failed",
-		}
-		ctx.Logger.WithError(errR).Error("comment: error retrieving data")
-		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(resp)
+	req.Text = normalizeText(req.Text)
+	if !validComment(req.Text) {
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "the comment is not valid",
+			FieldError{Field: "text", Message: commentRule})
 		return
 	}
-	u := User{
-		Username: dbcomment.User.Username,
-	}
-	cr := CommentResponse{
-		Id:       dbcomment.Id,
-		From:     &u,
-		Comment:  dbcomment.Comment,
-		Datetime: dbcomment.Datetime,
+	dbcomment, err := rt.db.CommentPhoto(r.Context(), userId, photoId, req.ToDatabase())
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "comment: error saving the comment")
+		return
 	}
+	var cr CommentResponse
+	cr.FromDatabase(*dbcomment)
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	_ = json.NewEncoder(w).Encode(cr)
 }
 
 func (rt *_router) deletePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-
-	userId, err := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing userId")
-		w.WriteHeader(http.StatusInternalServerError)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId")
+	if !ok {
 		return
 	}
-	photoId, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing photoId")
-		w.WriteHeader(http.StatusInternalServerError)
+	userId, photoId := ids[0], ids[1]
+
+	dbPhoto, err := rt.db.GetPhoto(r.Context(), userId, photoId)
+	if errors.Is(err, database.ErrPhotoNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "photo not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "photo: error retrieving the photo")
 		return
 	}
-
-	dbPhoto, err := rt.db.GetPhoto(userId, photoId)
+	renditions, err := rt.db.ListRenditions(r.Context(), photoId)
 	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: photo does not exist in db")
-		w.WriteHeader(http.StatusInternalServerError)
+		sendInternalError(w, r, ctx, err, "photo: error retrieving the renditions")
 		return
 	}
 
-	if err := rt.db.DeletePhoto(userId, photoId); err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error deleting photo")
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := rt.db.DeletePhoto(r.Context(), userId, photoId); err != nil {
+		sendInternalError(w, r, ctx, err, "photo: Error deleting photo")
 		return
 	}
 
-	// deleting from filesystem
-	photoPath := fmt.Sprintf("%s/%d/%s", rt.imagesFolder, userId, dbPhoto.PhotoUrl)
-	if err := os.Remove(photoPath); err != nil {
-		ctx.Logger.WithError(err).Warn("photo: could not remove photo from folder")
+	// deleting from the storage
+	if err := rt.images.Delete(r.Context(), dbPhoto.Path); err != nil {
+		ctx.Logger.WithError(err).Warn("photo: could not remove photo from the storage")
 	}
+	rt.removeRenditions(r.Context(), renditions)
 
 	w.WriteHeader(http.StatusOK)
 }
 
 func (rt *_router) likePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	userId, err := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing userId")
-		w.WriteHeader(http.StatusInternalServerError)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId")
+	if !ok {
 		return
 	}
-	photoId, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing photoId")
-		w.WriteHeader(http.StatusInternalServerError)
+	userId, photoId := ids[0], ids[1]
+
+	dbPhoto, err := rt.db.GetPhotoByID(r.Context(), photoId)
+	if errors.Is(err, database.ErrPhotoNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "photo not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "photo: error retrieving the photo")
+		return
+	} else if !rt.checkBan(w, r, ctx, dbPhoto.UserId, interactionLike) {
 		return
 	}
 
-	errD := rt.db.LikePhoto(userId, photoId)
-	if errors.Is(errD, database.ErrLikesExists) {
-		resp := ApiResponse{
-			Code:    http.StatusConflict,
-			Message: "The user has already liked",
-		}
-		ctx.Logger.WithError(errD).Error("like: Error The user has already liked")
-		w.WriteHeader(http.StatusConflict)
-		_ = json.NewEncoder(w).Encode(resp)
-		return
-	} else if errD != nil {
-		resp := ApiResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "Constraint failed",
-		}
-		ctx.Logger.WithError(errD).Error("like: Error constraint failed")
-		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(resp)
+	err = rt.db.LikePhoto(r.Context(), userId, photoId)
+	if errors.Is(err, database.ErrLikesExists) {
+		sendProblem(w, r, ctx, http.StatusConflict, codeConflict, "the photo is already liked")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "like: error saving the like")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
 func (rt *_router) uncommentPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	userId, err := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing userId")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	photoId, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing photoId")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	commentId, err := strconv.ParseUint(ps.ByName("commentId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing photoId")
-		w.WriteHeader(http.StatusInternalServerError)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId", "commentId")
+	if !ok {
 		return
 	}
+	userId, photoId, commentId := ids[0], ids[1], ids[2]
 
-	if err := rt.db.DeleteComment(commentId, userId, photoId); err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error constraint failed")
-		w.WriteHeader(http.StatusInternalServerError)
+	err := rt.db.DeleteComment(r.Context(), commentId, userId, photoId)
+	if errors.Is(err, database.ErrCommentNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "comment not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "comment: error deleting the comment")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
 func (rt *_router) unlikePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	userId, err := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing userId")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	photoId, err := strconv.ParseUint(ps.ByName("photoId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing photoId")
-		w.WriteHeader(http.StatusInternalServerError)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId")
+	if !ok {
 		return
 	}
+	userId, photoId := ids[0], ids[1]
 
-	if err := rt.db.DeleteLike(userId, photoId); err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error constraint failed")
-		w.WriteHeader(http.StatusInternalServerError)
+	err := rt.db.DeleteLike(r.Context(), userId, photoId)
+	if errors.Is(err, database.ErrLikeNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "like not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "like: error removing the like")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// uploadPhoto saves the uploaded image (the `file` field of the multipart form) as a new photo of the logged in user,
+// with the optional `caption` field. The image is checked by readImage, and saved with a name chosen by the server: the
+// client filename is ignored.
 func (rt *_router) uploadPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// The other parts of the form are small: the body can't be much larger than the image
+	r.Body = http.MaxBytesReader(w, r.Body, rt.imageLimits.MaxBytes+1<<20)
 	err := r.ParseMultipartForm(32 << 20)
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "photo: Bad Request",
-		}
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		rt.sendImageTooLarge(w, r, ctx)
+		return
+	} else if err != nil {
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeInvalidBody, "the body is not a multipart form")
 		return
 	}
 	file, handler, err := r.FormFile("file")
 	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error Retrieving the File")
-		w.WriteHeader(http.StatusInternalServerError)
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "the image is missing",
+			FieldError{Field: "file", Message: "required"})
 		return
 	}
 	defer file.Close()
+	if handler.Size > rt.imageLimits.MaxBytes {
+		rt.sendImageTooLarge(w, r, ctx)
+		return
+	}
+	caption := normalizeText(r.FormValue("caption"))
+	if !validCaption(caption) {
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "the caption is not valid",
+			FieldError{Field: "caption", Message: captionRule})
+		return
+	}
 
-	userid, err := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error parsing userId")
-		w.WriteHeader(http.StatusInternalServerError)
+	data, img, format, err := readImage(file, rt.imageLimits)
+	switch {
+	case errors.Is(err, errImageTooLarge):
+		rt.sendImageTooLarge(w, r, ctx)
+		return
+	case errors.Is(err, errImageUnsupported):
+		sendProblem(w, r, ctx, http.StatusUnsupportedMediaType, codeUnsupported,
+			"the image must be a JPEG, PNG, WebP or GIF image", FieldError{Field: "file", Message: "unsupported format"})
+		return
+	case errors.Is(err, errImageDimensions):
+		ctx.Logger.WithError(err).Info("photo: image rejected")
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "the image is too large",
+			FieldError{Field: "file", Message: fmt.Sprintf("width and height must be at most %d pixels", rt.imageLimits.MaxDimension)})
+		return
+	case errors.Is(err, errImageInvalid):
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "the image can't be decoded",
+			FieldError{Field: "file", Message: "not a valid " + format.Name + " image"})
+		return
+	case err != nil:
+		sendInternalError(w, r, ctx, err, "photo: error reading the uploaded image")
 		return
 	}
+	rt.metrics.uploadBytes.Add(float64(len(data)))
+
+	// The orientation is applied to the pixels, and metadata are removed (unless configured otherwise): the stored
+	// image is displayed correctly, and it doesn't leak the location of the user or the camera serial number
+	md := readMetadata(data, format)
+	if format == formatWebP && md.Orientation != 1 {
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "rotated WebP images are not supported",
+			FieldError{Field: "file", Message: "the EXIF orientation of WebP images must be 1 (not rotated)"})
+		return
+	}
+	img = applyOrientation(img, md.Orientation)
+	if !rt.keepImageMetadata {
+		data, err = stripMetadata(data, img, format, md)
+		if errors.Is(err, errImageInvalid) {
+			// The image can be decoded, but its segments (or chunks) are malformed
+			sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "the image can't be decoded",
+				FieldError{Field: "file", Message: "not a valid " + format.Name + " image"})
+			return
+		} else if err != nil {
+			sendInternalError(w, r, ctx, err, "photo: error removing the metadata of the image")
+			return
+		}
+	}
+
+	userid := ctx.User.ID
 
 	uuid, err := uuid.NewV4()
 	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: Error Creating the UUID")
-		w.WriteHeader(http.StatusInternalServerError)
+		sendInternalError(w, r, ctx, err, "photo: Error Creating the UUID")
 		return
 	}
 	imgid := uuid.String()
 
-	// check user dir existence
-	userDir := fmt.Sprintf("%s/%d", rt.imagesFolder, userid)
-	if _, err := os.Stat(userDir); os.IsNotExist(err) {
-		if err := os.Mkdir(userDir, os.ModePerm); err != nil {
-			ctx.Logger.WithError(err).Error("photo: .errors.upload_image.cannot_create_local_file")
-			w.WriteHeader(http.StatusInternalServerError)
+	// Images are saved in the storage with keys like <user ID>/<UUID>.<ext>
+	key := fmt.Sprintf("%d/%s%s", userid, imgid, format.Ext)
+	if err := rt.images.Put(r.Context(), key, data, format.ContentType); err != nil {
+		sendInternalError(w, r, ctx, err, ".errors.upload_image.cannot_copy_to_file")
+		return
+	}
+
+	renditions, err := rt.saveRenditions(r.Context(), img, fmt.Sprintf("%d/%s", userid, imgid))
+	if err != nil {
+		_ = rt.images.Delete(r.Context(), key)
+		sendInternalError(w, r, ctx, err, "photo: error saving the renditions")
+		return
+	}
+
+	dbPhoto := database.Photo{
+		Datetime:   time.Now(),
+		UUID:       imgid,
+		UserId:     userid,
+		Likes:      0,
+		Path:       key,
+		Renditions: renditions,
+		Caption:    caption,
+		Tags:       parseHashtags(caption),
+		Mentions:   parseMentions(caption),
+
+		TakenAt:     md.TakenAt,
+		Orientation: md.Orientation,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}
+
+	createdPhoto, err := rt.db.CreatePhoto(r.Context(), dbPhoto)
+	if err != nil {
+		_ = rt.images.Delete(r.Context(), key)
+		rt.removeRenditions(r.Context(), renditions)
+		sendInternalError(w, r, ctx, err, ".errors.upload_image.cannot_save_to_db")
+		return
+	}
+
+	var p Photo
+	p.FromDatabase(createdPhoto)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// getPhoto sends the photo with its details (author, caption, likes and comments count, first comments), as seen by the
+// logged in user. Here `userId` is the owner of the photo.
+func (rt *_router) getPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId")
+	if !ok {
+		return
+	}
+	userId, photoId := ids[0], ids[1]
+	if !rt.checkBan(w, r, ctx, userId, interactionView) {
+		return
+	}
+	rt.sendPhotoDetails(w, r, ctx, userId, photoId)
+}
+
+// editPhoto edits the photo of the logged in user. Only the caption can be changed (replacing the tags of the photo),
+// and the edit time is saved.
+func (rt *_router) editPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId")
+	if !ok {
+		return
+	}
+	userId, photoId := ids[0], ids[1]
+
+	var req PhotoUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeInvalidBody, "the body is not a valid JSON photo update")
+		return
+	} else if req.Caption == nil {
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "nothing to edit",
+			FieldError{Field: "caption", Message: "required"})
+		return
+	}
+	caption := normalizeText(*req.Caption)
+	if !validCaption(caption) {
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "the caption is not valid",
+			FieldError{Field: "caption", Message: captionRule})
+		return
+	}
+
+	err := rt.db.UpdatePhotoCaption(r.Context(), userId, photoId, caption, parseHashtags(caption),
+		parseMentions(caption), time.Now())
+	if errors.Is(err, database.ErrPhotoNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "photo not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "photo: error saving the caption")
+		return
+	}
+	rt.sendPhotoDetails(w, r, ctx, userId, photoId)
+}
+
+// sendPhotoDetails sends the photo of the user with its details, as seen by the logged in user.
+func (rt *_router) sendPhotoDetails(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext, userId uint64, photoId uint64) {
+	dbPhoto, err := rt.db.GetPhotoDetails(r.Context(), photoId, ctx.User.ID)
+	if errors.Is(err, database.ErrPhotoNotExists) || (err == nil && dbPhoto.UserId != userId) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "photo not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "photo: error retrieving the photo")
+		return
+	}
+
+	var p Photo
+	p.FromDatabase(dbPhoto)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// getPhotoImage sends the image file of the photo: the original, or the rendition selected by the `size` query
+// parameter. If the rendition doesn't exist (the original is smaller), the original is sent. Conditional requests
+// (ETag, Last-Modified) and HTTP Range requests are handled by http.ServeContent. If configured, and supported by the
+// storage, the client is redirected to a presigned URL of the image instead.
+func (rt *_router) getPhotoImage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId")
+	if !ok {
+		return
+	}
+	userId, photoId := ids[0], ids[1]
+	size := r.URL.Query().Get("size")
+	if _, ok := findRenditionSize(size); size != "" && !ok {
+		sendInvalidParameter(w, r, ctx, "size", "must be thumb, medium or large")
+		return
+	}
+	if !rt.checkBan(w, r, ctx, userId, interactionView) {
+		return
+	}
+
+	dbPhoto, err := rt.db.GetPhoto(r.Context(), userId, photoId)
+	if errors.Is(err, database.ErrPhotoNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "photo not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "photo: error retrieving the photo")
+		return
+	}
+
+	path, etag := dbPhoto.Path, dbPhoto.UUID
+	if size != "" {
+		renditions, err := rt.db.ListRenditions(r.Context(), photoId)
+		if err != nil {
+			sendInternalError(w, r, ctx, err, "photo: error retrieving the renditions")
+			return
+		}
+		for _, rendition := range renditions {
+			if rendition.Size == size {
+				path, etag = rendition.Path, dbPhoto.UUID+"-"+size
+			}
+		}
+	}
+
+	// With presigned URLs, the image is downloaded directly from the storage
+	if rt.presignTTL > 0 {
+		url, err := rt.images.PresignedURL(r.Context(), path, rt.presignTTL)
+		if err == nil {
+			w.Header().Set("Cache-Control", "no-store")
+			http.Redirect(w, r, url, http.StatusFound)
 			return
+		} else if !errors.Is(err, storage.ErrPresignUnsupported) {
+			sendInternalError(w, r, ctx, err, "photo: error creating the presigned URL")
+			return
+		}
+	}
 
+	body, info, err := rt.images.Get(r.Context(), path)
+	if errors.Is(err, storage.ErrNotFound) {
+		ctx.Logger.WithError(err).Warn("photo: image file is missing")
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "image not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "photo: error opening the image file")
+		return
+	}
+	defer body.Close()
+
+	// ServeContent seeks in the image for Range requests: images not read from a file (e.g., from S3) are read in memory
+	content, ok := body.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			sendInternalError(w, r, ctx, err, "photo: error reading the image file")
+			return
 		}
+		content = bytes.NewReader(data)
+	}
+
+	// Images are never modified after the upload, so the photo UUID (with the size of the rendition) is a valid strong
+	// ETag
+	w.Header().Set("ETag", fmt.Sprintf("%q", etag))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	// An empty name lets ServeContent sniff the Content-Type from the file content
+	http.ServeContent(w, r, "", info.ModTime, content)
+}
+
+// getPhotoComments sends a page of the comments of the photo, oldest first.
+func (rt *_router) getPhotoComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId")
+	if !ok {
+		return
+	}
+	photoId := ids[1]
+	page, ok := readPage(w, r, ctx)
+	if !ok {
+		return
+	}
+
+	dbPhoto, err := rt.db.GetPhotoByID(r.Context(), photoId)
+	if errors.Is(err, database.ErrPhotoNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "photo not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "photo: error retrieving the photo")
+		return
+	} else if !rt.checkBan(w, r, ctx, dbPhoto.UserId, interactionView) {
+		return
 	}
-	uniqueName := fmt.Sprintf("%s-%s", imgid, handler.Filename)
-	tmpFileName := fmt.Sprintf("%s/%s", userDir, uniqueName)
-	tmpFile, err := os.Create(tmpFileName)
 
+	dbcomments, err := rt.db.ListComments(r.Context(), photoId, lookahead(page))
 	if err != nil {
-		ctx.Logger.WithError(err).Error("photo: .errors.upload_image.cannot_create_local_file")
-		w.WriteHeader(http.StatusInternalServerError)
+		sendInternalError(w, r, ctx, err, "comment: error retrieving the comments")
 		return
 	}
-	defer tmpFile.Close()
-	if _, err := io.Copy(tmpFile, file); err != nil {
-		ctx.Logger.WithError(err).Error(".errors.upload_image.cannot_copy_to_file")
-		w.WriteHeader(http.StatusInternalServerError)
+
+	comments := Comments{
+		Comments: make([]CommentResponse, 0, len(dbcomments)),
+	}
+	if len(dbcomments) > page.Limit {
+		dbcomments = dbcomments[:page.Limit]
+		last := dbcomments[len(dbcomments)-1]
+		comments.NextCursor = encodeCursor(database.Cursor{Time: last.Datetime, ID: last.Id})
+	}
+	for _, c := range dbcomments {
+		var cr CommentResponse
+		cr.FromDatabase(c)
+		comments.Comments = append(comments.Comments, cr)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(comments)
+}
+
+// getPhotoLikes sends a page of the users who liked the photo, most recent first.
+func (rt *_router) getPhotoLikes(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "photoId")
+	if !ok {
+		return
+	}
+	photoId := ids[1]
+	page, ok := readPage(w, r, ctx)
+	if !ok {
 		return
 	}
 
-	p := Photo{
-		Datetime: time.Now(),
-		UUID:     imgid,
-		UserId:   userid,
-		Likes:    0,
-		PhotoUrl: tmpFileName,
+	dbPhoto, err := rt.db.GetPhotoByID(r.Context(), photoId)
+	if errors.Is(err, database.ErrPhotoNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "photo not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "photo: error retrieving the photo")
+		return
+	} else if !rt.checkBan(w, r, ctx, dbPhoto.UserId, interactionView) {
+		return
 	}
 
-	createdPhoto, err := rt.db.CreatePhoto(p.ToDatabase())
+	dblikes, err := rt.db.ListLikes(r.Context(), photoId, lookahead(page))
 	if err != nil {
-		ctx.Logger.WithError(err).Error(".errors.upload_image.cannot_save_to_db")
-		w.WriteHeader(http.StatusInternalServerError)
+		sendInternalError(w, r, ctx, err, "like: error retrieving the likes")
 		return
 	}
 
-	p.FromDatabase(createdPhoto)
+	likes := Likes{
+		Likes: make([]Liker, 0, len(dblikes)),
+	}
+	if len(dblikes) > page.Limit {
+		dblikes = dblikes[:page.Limit]
+		last := dblikes[len(dblikes)-1]
+		likes.NextCursor = encodeCursor(database.Cursor{Time: last.Datetime, ID: last.User.ID})
+	}
+	for _, l := range dblikes {
+		likes.Likes = append(likes.Likes, Liker{
+			ID:       l.User.ID,
+			Username: l.User.Username,
+			LikedAt:  l.Datetime,
+		})
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	_ = json.NewEncoder(w).Encode(p)
+	_ = json.NewEncoder(w).Encode(likes)
+}
+
+// getLikedPhotos sends a page of the photos liked by the user, most recent like first.
+func (rt *_router) getLikedPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	page, ok := readPage(w, r, ctx)
+	if !ok {
+		return
+	}
+
+	dblikes, err := rt.db.ListLikedPhotos(r.Context(), ctx.User.ID, lookahead(page))
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "like: error retrieving the liked photos")
+		return
+	}
+
+	liked := LikedPhotos{
+		Photos: make([]LikedPhoto, 0, len(dblikes)),
+	}
+	if len(dblikes) > page.Limit {
+		dblikes = dblikes[:page.Limit]
+		last := dblikes[len(dblikes)-1]
+		liked.NextCursor = encodeCursor(database.Cursor{Time: last.Datetime, ID: last.Photo.Id})
+	}
+	for _, l := range dblikes {
+		lp := LikedPhoto{
+			LikedAt: l.Datetime,
+		}
+		lp.Photo.FromDatabase(l.Photo)
+		liked.Photos = append(liked.Photos, lp)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(liked)
+}
+
+// sendImageTooLarge sends the 413 error for an image larger than the maximum size.
+func (rt *_router) sendImageTooLarge(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext) {
+	sendProblem(w, r, ctx, http.StatusRequestEntityTooLarge, codeTooLarge, "the image is too large",
+		FieldError{Field: "file", Message: fmt.Sprintf("must be at most %d bytes", rt.imageLimits.MaxBytes)})
 }
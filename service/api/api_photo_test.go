@@ -0,0 +1,413 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/storage"
+	"sapienza/azzurra/wasaphoto/service/storage/s3fake"
+)
+
+func TestUploadAndDeletePhoto(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	photoId := uploadTestPhoto(t, srv, alice)
+	imagePath := fmt.Sprintf("/users/%d/photos/%d/image", alice.ID, photoId)
+
+	res := send(t, srv, bob, http.MethodGet, imagePath, "", nil)
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "image/png" || !bytes.Equal(body, testImage(t)) {
+		t.Fatalf("image: got status %d, type %q and %d bytes", res.StatusCode, res.Header.Get("Content-Type"), len(body))
+	}
+
+	if status := doRequest(t, srv, bob, http.MethodDelete, fmt.Sprintf("/users/%d/photos/%d", bob.ID, photoId), "", nil); status != http.StatusNotFound {
+		t.Errorf("delete of another user's photo: got status %d, want %d", status, http.StatusNotFound)
+	}
+	if status := doRequest(t, srv, alice, http.MethodDelete, fmt.Sprintf("/users/%d/photos/%d", alice.ID, photoId), "", nil); status != http.StatusOK {
+		t.Fatalf("delete: got status %d", status)
+	}
+	if status := doRequest(t, srv, bob, http.MethodGet, imagePath, "", nil); status != http.StatusNotFound {
+		t.Errorf("image after delete: got status %d, want %d", status, http.StatusNotFound)
+	}
+
+	if status := doRequest(t, srv, alice, http.MethodPost, fmt.Sprintf("/users/%d/photos", alice.ID), "text/plain", bytes.NewBufferString("photo")); status != http.StatusBadRequest {
+		t.Errorf("upload without file: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestLikes(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	photoId := uploadTestPhoto(t, srv, alice)
+	likePath := fmt.Sprintf("/users/%d/photos/%d/likes", bob.ID, photoId)
+
+	if status := doRequest(t, srv, bob, http.MethodPut, likePath, "", nil); status != http.StatusOK {
+		t.Fatalf("like: got status %d", status)
+	}
+	if status := doRequest(t, srv, bob, http.MethodPut, likePath, "", nil); status != http.StatusConflict {
+		t.Errorf("like twice: got status %d, want %d", status, http.StatusConflict)
+	}
+	if status := doRequest(t, srv, bob, http.MethodPut, fmt.Sprintf("/users/%d/photos/1000/likes", bob.ID), "", nil); status != http.StatusNotFound {
+		t.Errorf("like of a missing photo: got status %d, want %d", status, http.StatusNotFound)
+	}
+
+	var likes Likes
+	if status := doJSON(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d/likes", alice.ID, photoId), "", &likes); status != http.StatusOK {
+		t.Fatalf("likes: got status %d", status)
+	} else if len(likes.Likes) != 1 || likes.Likes[0].ID != bob.ID || likes.Likes[0].LikedAt.IsZero() {
+		t.Errorf("likes: got %+v", likes.Likes)
+	}
+	// userId is the logged in user on every method: the likes are read from the URL of the like
+	if status := doJSON(t, srv, bob, http.MethodGet, likePath, "", &likes); status != http.StatusOK {
+		t.Errorf("likes as the liker: got status %d", status)
+	} else if len(likes.Likes) != 1 || likes.Likes[0].ID != bob.ID {
+		t.Errorf("likes as the liker: got %+v", likes.Likes)
+	}
+	if status := doRequest(t, srv, alice, http.MethodGet, likePath, "", nil); status != http.StatusForbidden {
+		t.Errorf("likes as another user: got status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := doRequest(t, srv, bob, http.MethodGet, fmt.Sprintf("/users/%d/photos/1000/likes", bob.ID), "", nil); status != http.StatusNotFound {
+		t.Errorf("likes of a missing photo: got status %d, want %d", status, http.StatusNotFound)
+	}
+
+	var liked LikedPhotos
+	if status := doJSON(t, srv, bob, http.MethodGet, fmt.Sprintf("/users/%d/liked", bob.ID), "", &liked); status != http.StatusOK {
+		t.Fatalf("liked photos: got status %d", status)
+	} else if len(liked.Photos) != 1 || liked.Photos[0].Id != photoId || liked.Photos[0].Likes != 1 {
+		t.Errorf("liked photos: got %+v", liked.Photos)
+	}
+
+	if status := doRequest(t, srv, bob, http.MethodDelete, likePath, "", nil); status != http.StatusOK {
+		t.Fatalf("unlike: got status %d", status)
+	}
+	if status := doRequest(t, srv, bob, http.MethodDelete, likePath, "", nil); status != http.StatusNotFound {
+		t.Errorf("unlike twice: got status %d, want %d", status, http.StatusNotFound)
+	}
+	if status := doJSON(t, srv, bob, http.MethodGet, fmt.Sprintf("/users/%d/liked", bob.ID), "", &liked); status != http.StatusOK {
+		t.Fatalf("liked photos: got status %d", status)
+	} else if len(liked.Photos) != 0 {
+		t.Errorf("liked photos after unlike: got %+v", liked.Photos)
+	}
+}
+
+func TestComments(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	photoId := uploadTestPhoto(t, srv, alice)
+	commentsPath := fmt.Sprintf("/users/%d/photos/%d/comments", bob.ID, photoId)
+
+	var ids []uint64
+	for _, text := range []string{"first", "second", "third"} {
+		var c CommentResponse
+		if status := doJSON(t, srv, bob, http.MethodPost, commentsPath, `{"text":"`+text+`"}`, &c); status != http.StatusOK {
+			t.Fatalf("comment: got status %d", status)
+		} else if c.Comment != text || c.From == nil || c.From.ID != bob.ID {
+			t.Errorf("comment: got %+v", c)
+		}
+		ids = append(ids, c.Id)
+	}
+	if status := doJSON(t, srv, bob, http.MethodPost, commentsPath, `{"text":`, nil); status != http.StatusBadRequest {
+		t.Errorf("invalid JSON: got status %d, want %d", status, http.StatusBadRequest)
+	}
+	for _, body := range []string{`{}`, `{"text":"  \r\n "}`, `{"text":"a\u0007b"}`, `{"text":"` + strings.Repeat("è", maxCommentLength+1) + `"}`} {
+		status, p := doProblem(t, srv, bob, http.MethodPost, commentsPath, body)
+		if status != http.StatusBadRequest || p.Code != codeValidationFailed || len(p.Errors) != 1 || p.Errors[0].Field != "text" {
+			t.Errorf("comment with %.20s: got status %d, %+v", body, status, p)
+		}
+	}
+
+	// Oldest first, two per page
+	var got []uint64
+	path := fmt.Sprintf("/users/%d/photos/%d/comments?limit=2", alice.ID, photoId)
+	for i := 0; path != ""; i++ {
+		var comments Comments
+		if status := doJSON(t, srv, alice, http.MethodGet, path, "", &comments); status != http.StatusOK {
+			t.Fatalf("comments: got status %d", status)
+		}
+		for _, c := range comments.Comments {
+			got = append(got, c.Id)
+		}
+		path = ""
+		if comments.NextCursor != "" {
+			path = fmt.Sprintf("/users/%d/photos/%d/comments?limit=2&cursor=%s", alice.ID, photoId, comments.NextCursor)
+		}
+		if i > 2 {
+			t.Fatalf("comments: too many pages")
+		}
+	}
+	if len(got) != 3 || got[0] != ids[0] || got[2] != ids[2] {
+		t.Errorf("comments: got %v, want %v", got, ids)
+	}
+
+	if status := doRequest(t, srv, bob, http.MethodDelete, fmt.Sprintf("%s/%d", commentsPath, ids[0]), "", nil); status != http.StatusOK {
+		t.Fatalf("uncomment: got status %d", status)
+	}
+	var comments Comments
+	if status := doJSON(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d/comments", alice.ID, photoId), "", &comments); status != http.StatusOK {
+		t.Fatalf("comments: got status %d", status)
+	} else if len(comments.Comments) != 2 {
+		t.Errorf("comments after uncomment: got %d comments, want 2", len(comments.Comments))
+	}
+	if status := doJSON(t, srv, bob, http.MethodGet, commentsPath, "", &comments); status != http.StatusOK {
+		t.Errorf("comments as the author: got status %d", status)
+	} else if len(comments.Comments) != 2 {
+		t.Errorf("comments as the author: got %d comments, want 2", len(comments.Comments))
+	}
+	if status := doRequest(t, srv, alice, http.MethodGet, commentsPath, "", nil); status != http.StatusForbidden {
+		t.Errorf("comments as another user: got status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := doRequest(t, srv, bob, http.MethodDelete, fmt.Sprintf("%s/%d", commentsPath, ids[0]), "", nil); status != http.StatusNotFound {
+		t.Errorf("uncomment of a deleted comment: got status %d, want %d", status, http.StatusNotFound)
+	}
+	if status := doRequest(t, srv, bob, http.MethodDelete, fmt.Sprintf("/users/%d/photos/1000/comments/%d", bob.ID, ids[1]), "", nil); status != http.StatusNotFound {
+		t.Errorf("uncomment on another photo: got status %d, want %d", status, http.StatusNotFound)
+	}
+
+	// Comments are trimmed, as captions
+	var trimmed CommentResponse
+	if status := doJSON(t, srv, bob, http.MethodPost, commentsPath, `{"text":" `+strings.Repeat("è", maxCommentLength)+`\r\n"}`, &trimmed); status != http.StatusOK {
+		t.Errorf("comment of the maximum length: got status %d", status)
+	} else if trimmed.Comment != strings.Repeat("è", maxCommentLength) {
+		t.Errorf("comment of the maximum length: got %.20q", trimmed.Comment)
+	}
+}
+
+func TestUploadValidation(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	img := testImage(t)
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		status   int
+		code     string
+	}{
+		{"html", "photo.png", []byte("<html><body>not an image</body></html>"), http.StatusUnsupportedMediaType, codeUnsupported},
+		{"truncated", "photo.png", img[:len(img)/2], http.StatusBadRequest, codeValidationFailed},
+		{"too wide", "photo.png", encodeImage(t, 8193, 1, encodePNG), http.StatusBadRequest, codeValidationFailed},
+		{"too large", "photo.png", append(img, make([]byte, 10<<20)...), http.StatusRequestEntityTooLarge, codeTooLarge},
+		{"malformed chunks", "photo.webp", append(webpImage[:len(webpImage):len(webpImage)], "VP8"...), http.StatusBadRequest, codeValidationFailed},
+		{"rotated webp", "photo.webp", webpWithExif(t, webpImage, exifData(6, "", "")), http.StatusBadRequest, codeValidationFailed},
+	}
+	for _, tt := range tests {
+		res := uploadFile(t, srv, alice, tt.filename, tt.data)
+		var p Problem
+		_ = json.NewDecoder(res.Body).Decode(&p)
+		_ = res.Body.Close()
+		if res.StatusCode != tt.status || p.Code != tt.code {
+			t.Errorf("%s: got status %d and code %q, want %d and %q", tt.name, res.StatusCode, p.Code, tt.status, tt.code)
+		}
+	}
+
+	// The client filename is not used on disk: a path traversal is harmless
+	res := uploadFile(t, srv, alice, "../../escape.png", img)
+	var photo Photo
+	_ = json.NewDecoder(res.Body).Decode(&photo)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("upload: got status %d", res.StatusCode)
+	}
+	res = send(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d/image", alice.ID, photo.Id), "", nil)
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK || !bytes.Equal(body, img) {
+		t.Errorf("image: got status %d and %d bytes", res.StatusCode, len(body))
+	}
+}
+
+func TestPhotoStorageS3(t *testing.T) {
+	fake := s3fake.New("photos", "access-key")
+	s3srv := httptest.NewServer(fake)
+	t.Cleanup(s3srv.Close)
+	store, err := storage.NewS3(storage.S3Config{Endpoint: s3srv.URL, Bucket: "photos", AccessKey: "access-key", SecretKey: "secret", PathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, presignTTL := range []time.Duration{0, time.Minute} {
+		srv := newTestServerWith(t, Config{Storage: store, PresignTTL: presignTTL})
+		alice := login(t, srv, "alice")
+
+		var img bytes.Buffer
+		if err := png.Encode(&img, gradientImage(800, 600)); err != nil {
+			t.Fatal(err)
+		}
+		res := uploadFile(t, srv, alice, "photo.png", img.Bytes())
+		var photo Photo
+		_ = json.NewDecoder(res.Body).Decode(&photo)
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("upload: got status %d", res.StatusCode)
+		} else if keys := fake.Keys(); len(keys) != 3 {
+			t.Errorf("got objects %v, want the original and 2 renditions", keys)
+		}
+
+		// With presigned URLs, the client is redirected to the storage
+		for _, size := range []string{"", "thumb"} {
+			res = send(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d/image?size=%s", alice.ID, photo.Id, size), "", nil)
+			cfg, _, err := image.DecodeConfig(res.Body)
+			_ = res.Body.Close()
+			if res.StatusCode != http.StatusOK || err != nil {
+				t.Errorf("presign %s, size %q: got status %d, %v", presignTTL, size, res.StatusCode, err)
+			} else if redirected := res.Request.URL.Host != strings.TrimPrefix(srv.URL, "http://"); redirected != (presignTTL > 0) {
+				t.Errorf("presign %s, size %q: got redirected %v", presignTTL, size, redirected)
+			} else if size == "thumb" && cfg.Width != 150 {
+				t.Errorf("presign %s: got a thumbnail %d pixels wide", presignTTL, cfg.Width)
+			}
+		}
+
+		var ready ReadinessResponse
+		if status := doJSON(t, srv, Session{}, http.MethodGet, "/readiness", "", &ready); status != http.StatusOK || ready.Checks["images"].Status != "ok" {
+			t.Errorf("readiness: got status %d, %+v", status, ready)
+		}
+
+		if status := doRequest(t, srv, alice, http.MethodDelete, fmt.Sprintf("/users/%d/photos/%d", alice.ID, photo.Id), "", nil); status != http.StatusOK {
+			t.Fatalf("delete: got status %d", status)
+		} else if keys := fake.Keys(); len(keys) != 0 {
+			t.Errorf("after delete: got objects %v", keys)
+		}
+	}
+}
+
+func TestPhotoCaption(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+
+	// The caption is trimmed, with Unix new lines
+	res := uploadForm(t, srv, alice, "photo.png", testImage(t), map[string]string{"caption": "  Sunset\r\nin Rome \n"})
+	var photo Photo
+	_ = json.NewDecoder(res.Body).Decode(&photo)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK || photo.Caption != "Sunset\nin Rome" || photo.EditedAt != nil {
+		t.Fatalf("upload: got status %d, %+v", res.StatusCode, photo)
+	}
+	res = uploadForm(t, srv, alice, "photo.png", testImage(t), map[string]string{"caption": strings.Repeat("è", maxCaptionLength+1)})
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("upload with a long caption: got status %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+
+	photoPath := fmt.Sprintf("/users/%d/photos/%d", alice.ID, photo.Id)
+	var got Photo
+	if status := doJSON(t, srv, bob, http.MethodGet, photoPath, "", &got); status != http.StatusOK {
+		t.Fatalf("get: got status %d", status)
+	} else if got.Caption != photo.Caption || got.Author == nil || got.Author.ID != alice.ID || got.PhotoUrl != photoPath+"/image" {
+		t.Errorf("get: got %+v", got)
+	}
+	if status := doRequest(t, srv, bob, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d", bob.ID, photo.Id), "", nil); status != http.StatusNotFound {
+		t.Errorf("get with the wrong owner: got status %d, want %d", status, http.StatusNotFound)
+	}
+
+	// Only the owner can edit the caption
+	if status := doJSON(t, srv, bob, http.MethodPatch, photoPath, `{"caption": "mine"}`, nil); status != http.StatusForbidden {
+		t.Errorf("edit by another user: got status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := doJSON(t, srv, bob, http.MethodPatch, fmt.Sprintf("/users/%d/photos/%d", bob.ID, photo.Id), `{"caption": "mine"}`, nil); status != http.StatusNotFound {
+		t.Errorf("edit of a photo of another user: got status %d, want %d", status, http.StatusNotFound)
+	}
+	for _, body := range []string{`{}`, `{"caption": "a\u0000b"}`, `{"caption": "` + strings.Repeat("a", maxCaptionLength+1) + `"}`} {
+		status, p := doProblem(t, srv, alice, http.MethodPatch, photoPath, body)
+		if status != http.StatusBadRequest || len(p.Errors) != 1 || p.Errors[0].Field != "caption" {
+			t.Errorf("edit with %.20s: got status %d, %+v", body, status, p)
+		}
+	}
+
+	got = Photo{}
+	if status := doJSON(t, srv, alice, http.MethodPatch, photoPath, `{"caption": " Tramonto a Roma "}`, &got); status != http.StatusOK {
+		t.Fatalf("edit: got status %d", status)
+	} else if got.Caption != "Tramonto a Roma" || got.EditedAt == nil || got.Id != photo.Id {
+		t.Errorf("edit: got %+v", got)
+	}
+
+	// Banned users can't see the photo
+	if status := doRequest(t, srv, alice, http.MethodPut, fmt.Sprintf("/users/%d/bans/%d", alice.ID, bob.ID), "", nil); status != http.StatusNoContent {
+		t.Fatalf("ban: got status %d", status)
+	}
+	if status := doRequest(t, srv, bob, http.MethodGet, photoPath, "", nil); status != http.StatusNotFound {
+		t.Errorf("get by a banned user: got status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // usernames, offsets and lengths
+	}{
+		{"", "[]"},
+		{"@bob", "[bob 0 4]"},
+		{"è @Bob, (@carol_1) @@dave", "[Bob 2 4 carol_1 9 8 dave 20 5]"},
+		{"mail@bob.com @al @" + strings.Repeat("a", 17), "[]"},
+	}
+	for _, tt := range tests {
+		got := make([]string, 0)
+		for _, m := range parseMentions(tt.text) {
+			got = append(got, fmt.Sprintf("%s %d %d", m.User.Username, m.Offset, m.Length))
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("parseMentions(%q): got %v, want %v", tt.text, got, tt.want)
+		}
+	}
+	if got := parseMentions(strings.Repeat("@bob ", maxMentions+1)); len(got) != maxMentions {
+		t.Errorf("got %d mentions, want at most %d", len(got), maxMentions)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+
+	res := uploadForm(t, srv, alice, "photo.png", testImage(t), map[string]string{"caption": "With @bob and @nobody"})
+	var photo Photo
+	_ = json.NewDecoder(res.Body).Decode(&photo)
+	_ = res.Body.Close()
+	want := []Entity{{Type: "mention", Offset: 5, Length: 4, UserId: bob.ID}}
+	if res.StatusCode != http.StatusOK || fmt.Sprint(photo.CaptionEntities) != fmt.Sprint(want) {
+		t.Fatalf("upload: got status %d, entities %+v", res.StatusCode, photo.CaptionEntities)
+	}
+
+	commentsPath := fmt.Sprintf("/users/%d/photos/%d/comments", bob.ID, photo.Id)
+	var comment CommentResponse
+	if status := doJSON(t, srv, bob, http.MethodPost, commentsPath, `{"text": "thanks @alice, mail@alice.it"}`, &comment); status != http.StatusOK {
+		t.Fatalf("comment: got status %d", status)
+	} else if want := []Entity{{Type: "mention", Offset: 7, Length: 6, UserId: alice.ID}}; fmt.Sprint(comment.Entities) != fmt.Sprint(want) {
+		t.Errorf("comment: got entities %+v, want %+v", comment.Entities, want)
+	}
+	var comments Comments
+	if status := doJSON(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d/comments", alice.ID, photo.Id), "", &comments); status != http.StatusOK {
+		t.Fatalf("list comments: got status %d", status)
+	} else if len(comments.Comments) != 1 || len(comments.Comments[0].Entities) != 1 {
+		t.Errorf("list comments: got %+v", comments.Comments)
+	}
+
+	// Entities are sent with the photo, and removed with the mention
+	var got Photo
+	photoPath := fmt.Sprintf("/users/%d/photos/%d", alice.ID, photo.Id)
+	if status := doJSON(t, srv, bob, http.MethodGet, photoPath, "", &got); status != http.StatusOK {
+		t.Fatalf("get: got status %d", status)
+	} else if len(got.CaptionEntities) != 1 || len(got.Comments) != 1 || len(got.Comments[0].Entities) != 1 {
+		t.Errorf("get: got %+v", got)
+	}
+	got = Photo{}
+	if status := doJSON(t, srv, alice, http.MethodPatch, photoPath, `{"caption": "Alone"}`, &got); status != http.StatusOK {
+		t.Fatalf("edit: got status %d", status)
+	} else if len(got.CaptionEntities) != 0 {
+		t.Errorf("edit: got entities %+v", got.CaptionEntities)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sapienza/azzurra/wasaphoto/service/api/reqcontext"
+	"sapienza/azzurra/wasaphoto/service/database"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// getTagPhotos sends a page of the photos with the tag, most recent first. As in the stream, photos of users who banned
+// the logged in user, or banned by them, are not listed.
+func (rt *_router) getTagPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	tag, ok := tagName(ps.ByName("tag"))
+	if !ok {
+		sendInvalidParameter(w, r, ctx, "tag", tagRule)
+		return
+	}
+	page, ok := readPage(w, r, ctx)
+	if !ok {
+		return
+	}
+
+	photos, err := rt.db.ListTagPhotos(r.Context(), ctx.User.ID, tag, lookahead(page))
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "tags: error listing the photos")
+		return
+	}
+
+	stream := Stream{
+		Photos: make([]Photo, 0, len(photos)),
+	}
+	if len(photos) > page.Limit {
+		photos = photos[:page.Limit]
+		last := photos[len(photos)-1]
+		stream.NextCursor = encodeCursor(database.Cursor{Time: last.Datetime, ID: last.Id})
+	}
+	for _, p := range photos {
+		var photo Photo
+		photo.FromDatabase(p)
+		stream.Photos = append(stream.Photos, photo)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(stream)
+}
+
+// searchTags sends the tags starting with the `prefix` query parameter (all the tags if missing), most used first, for
+// autocompletion. Only the photos visible to the logged in user are counted.
+func (rt *_router) searchTags(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// Unlike tags, prefixes can be empty or only digits (e.g., "#20" while typing "#2023travel")
+	prefix := strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("prefix"), "#"))
+	if utf8.RuneCountInString(prefix) > maxTagLength || strings.IndexFunc(prefix, func(r rune) bool { return !isTagRune(r) }) >= 0 {
+		sendInvalidParameter(w, r, ctx, "prefix", "must be at most 64 letters, digits or _, optionally starting with #")
+		return
+	}
+	page, ok := readPage(w, r, ctx)
+	if !ok {
+		return
+	} else if page.After != nil {
+		sendInvalidParameter(w, r, ctx, "cursor", "the search is not paginated")
+		return
+	}
+
+	dbtags, err := rt.db.SearchTags(r.Context(), ctx.User.ID, prefix, page.Limit)
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "tags: error searching tags")
+		return
+	}
+
+	tags := Tags{
+		Tags: make([]Tag, 0, len(dbtags)),
+	}
+	for _, t := range dbtags {
+		tags.Tags = append(tags.Tags, Tag{Name: t.Name, Photos: t.Photos})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(tags)
+}
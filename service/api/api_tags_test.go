@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseHashtags(t *testing.T) {
+	long := strings.Repeat("a", maxTagLength)
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"#Sunset in #Rome, #rome again", []string{"sunset", "rome"}},
+		{"#città_eterna! #2023 #2023rome", []string{"città_eterna", "2023rome"}},
+		{"a#b &#39; ##double #", []string{"double"}},
+		{"#" + long + " #" + long + "a", []string{long}},
+		{"(#one)#two\n#three", []string{"one", "two", "three"}},
+	}
+	for _, tt := range tests {
+		if got := parseHashtags(tt.text); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseHashtags(%q): got %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	many := make([]string, 0, maxPhotoTags+5)
+	for i := 0; i < maxPhotoTags+5; i++ {
+		many = append(many, fmt.Sprintf("#tag%d", i))
+	}
+	if got := parseHashtags(strings.Join(many, " ")); len(got) != maxPhotoTags {
+		t.Errorf("got %d tags, want at most %d", len(got), maxPhotoTags)
+	}
+}
+
+func TestTags(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	carol := login(t, srv, "carol")
+
+	upload := func(s Session, caption string) Photo {
+		t.Helper()
+		var p Photo
+		res := uploadForm(t, srv, s, "photo.png", testImage(t), map[string]string{"caption": caption})
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("upload: got status %d", res.StatusCode)
+		}
+		_ = json.NewDecoder(res.Body).Decode(&p)
+		return p
+	}
+	p1 := upload(alice, "#Rome at night")
+	p2 := upload(bob, "Walking in #rome #Trastevere")
+	p3 := upload(carol, "#rome")
+
+	// Photos are listed by everybody, most recent first
+	var stream Stream
+	if status := doJSON(t, srv, alice, http.MethodGet, "/tags/rome/photos?limit=2", "", &stream); status != http.StatusOK {
+		t.Fatalf("tag photos: got status %d", status)
+	} else if len(stream.Photos) != 2 || stream.Photos[0].Id != p3.Id || stream.Photos[1].Id != p2.Id || stream.NextCursor == "" {
+		t.Fatalf("tag photos: got %+v", stream)
+	} else if stream.Photos[0].Author == nil || stream.Photos[0].Author.ID != carol.ID {
+		t.Errorf("tag photos: got author %+v", stream.Photos[0].Author)
+	}
+	next := Stream{}
+	if status := doJSON(t, srv, alice, http.MethodGet, "/tags/%23Rome/photos?limit=2&cursor="+stream.NextCursor, "", &next); status != http.StatusOK {
+		t.Fatalf("tag photos: got status %d", status)
+	} else if len(next.Photos) != 1 || next.Photos[0].Id != p1.Id || next.NextCursor != "" {
+		t.Errorf("tag photos second page: got %+v", next)
+	}
+	for _, tag := range []string{"2023", "a-b", strings.Repeat("a", maxTagLength+1)} {
+		if status := doRequest(t, srv, alice, http.MethodGet, "/tags/"+tag+"/photos", "", nil); status != http.StatusBadRequest {
+			t.Errorf("photos of the tag %q: got status %d, want %d", tag, status, http.StatusBadRequest)
+		}
+	}
+
+	var tags Tags
+	if status := doJSON(t, srv, alice, http.MethodGet, "/tags?prefix="+url.QueryEscape("#R"), "", &tags); status != http.StatusOK {
+		t.Fatalf("search tags: got status %d", status)
+	} else if fmt.Sprint(tags.Tags) != "[{rome 3}]" {
+		t.Errorf("search tags: got %v", tags.Tags)
+	}
+	tags = Tags{}
+	if status := doJSON(t, srv, alice, http.MethodGet, "/tags", "", &tags); status != http.StatusOK || fmt.Sprint(tags.Tags) != "[{rome 3} {trastevere 1}]" {
+		t.Errorf("search all tags: got status %d, %v", status, tags.Tags)
+	}
+	if status := doRequest(t, srv, alice, http.MethodGet, "/tags?prefix=a-b", "", nil); status != http.StatusBadRequest {
+		t.Errorf("search with an invalid prefix: got status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// Editing the caption replaces the tags
+	if status := doJSON(t, srv, bob, http.MethodPatch, fmt.Sprintf("/users/%d/photos/%d", bob.ID, p2.Id), `{"caption": "#Roma"}`, nil); status != http.StatusOK {
+		t.Fatalf("edit: got status %d", status)
+	}
+	tags = Tags{}
+	if status := doJSON(t, srv, alice, http.MethodGet, "/tags?prefix=rom", "", &tags); status != http.StatusOK || fmt.Sprint(tags.Tags) != "[{rome 2} {roma 1}]" {
+		t.Errorf("search after the edit: got status %d, %v", status, tags.Tags)
+	}
+
+	// As in the stream, photos of users banned by the viewer, or who banned the viewer, are hidden
+	if status := doRequest(t, srv, carol, http.MethodPut, fmt.Sprintf("/users/%d/bans/%d", carol.ID, alice.ID), "", nil); status != http.StatusNoContent {
+		t.Fatalf("ban: got status %d", status)
+	}
+	stream = Stream{}
+	if status := doJSON(t, srv, alice, http.MethodGet, "/tags/rome/photos", "", &stream); status != http.StatusOK || len(stream.Photos) != 1 || stream.Photos[0].Id != p1.Id {
+		t.Errorf("tag photos with a ban: got status %d, %+v", status, stream)
+	}
+	tags = Tags{}
+	if status := doJSON(t, srv, alice, http.MethodGet, "/tags?prefix=rome", "", &tags); status != http.StatusOK || fmt.Sprint(tags.Tags) != "[{rome 1}]" {
+		t.Errorf("search with a ban: got status %d, %v", status, tags.Tags)
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sapienza/azzurra/wasaphoto/service/database/memdb"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newTestServer starts the API on a new in-memory database. Images are stored in a temporary directory.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return newTestServerWith(t, Config{})
+}
+
+// newTestServerWith starts the API with the configuration. As in newTestServer, the logger, the database and the images
+// folder are set if missing.
+func newTestServerWith(t *testing.T, cfg Config) *httptest.Server {
+	t.Helper()
+	if cfg.Logger == nil {
+		logger := logrus.New()
+		logger.SetOutput(io.Discard)
+		cfg.Logger = logger
+	}
+	if cfg.Database == nil {
+		cfg.Database = memdb.New()
+	}
+	if cfg.ImagesFolder == "" {
+		cfg.ImagesFolder = t.TempDir()
+	}
+	router, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(router.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// login logs in (or creates) the user and returns its session.
+func login(t *testing.T, srv *httptest.Server, username string) Session {
+	t.Helper()
+	res, err := http.Post(srv.URL+"/session", "application/json", bytes.NewBufferString(`{"username":"`+username+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var s Session
+	if err := json.NewDecoder(res.Body).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// doRequest sends an authenticated request and returns the response status code.
+func doRequest(t *testing.T, srv *httptest.Server, s Session, method string, path string, contentType string, body io.Reader) int {
+	t.Helper()
+	res := send(t, srv, s, method, path, contentType, body)
+	_ = res.Body.Close()
+	return res.StatusCode
+}
+
+// doJSON sends an authenticated request with the JSON body (if not empty), decodes the JSON response in `out` (if not
+// nil), and returns the response status code.
+func doJSON(t *testing.T, srv *httptest.Server, s Session, method string, path string, body string, out interface{}) int {
+	t.Helper()
+	var contentType string
+	if body != "" {
+		contentType = "application/json"
+	}
+	res := send(t, srv, s, method, path, contentType, bytes.NewBufferString(body))
+	defer res.Body.Close()
+
+	if out != nil && res.StatusCode < 300 {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding the response: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// send sends an authenticated request (unless the session has no token) and returns the response.
+func send(t *testing.T, srv *httptest.Server, s Session, method string, path string, contentType string, body io.Reader) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// testImage returns a small PNG image.
+func testImage(t *testing.T) []byte {
+	t.Helper()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	return img.Bytes()
+}
+
+// uploadFile uploads the file (with the given client filename) as a new photo of the user, and returns the response.
+func uploadFile(t *testing.T, srv *httptest.Server, s Session, filename string, data []byte) *http.Response {
+	t.Helper()
+	return uploadForm(t, srv, s, filename, data, nil)
+}
+
+// uploadForm uploads the file as a new photo of the user, with the other fields of the form, and returns the response.
+func uploadForm(t *testing.T, srv *httptest.Server, s Session, filename string, data []byte, fields map[string]string) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		_ = mw.WriteField(name, value)
+	}
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write(data)
+	_ = mw.Close()
+
+	return send(t, srv, s, http.MethodPost, fmt.Sprintf("/users/%d/photos", s.ID), mw.FormDataContentType(), &body)
+}
+
+// uploadTestPhoto uploads a small PNG image as the given user, and returns the new photo ID.
+func uploadTestPhoto(t *testing.T, srv *httptest.Server, s Session) uint64 {
+	t.Helper()
+	res := uploadFile(t, srv, s, "test.png", testImage(t))
+	defer res.Body.Close()
+
+	var p Photo
+	if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	return p.Id
+}
@@ -1,106 +1,97 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"sapienza/azzurra/wasaphoto/service/api/reqcontext"
 	"sapienza/azzurra/wasaphoto/service/database"
-	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 func (rt *_router) banUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	userid, erru := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	bannedid, errb := strconv.ParseUint(ps.ByName("userBanId"), 10, 64)
-	if erru != nil || errb != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "error parsing JSON",
-		}
-		ctx.Logger.WithError(erru).Error("user: error parsing JSON")
-		ctx.Logger.WithError(errb).Error("user: error parsing JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "userBanId")
+	if !ok {
 		return
 	}
-	errB := rt.db.BanUser(userid, bannedid)
-	if errB != nil {
-		resp := ApiResponse{
-			Code:    http.StatusConflict,
-			Message: "Constraint failed",
-		}
-		ctx.Logger.WithError(errB).Error("user: error constraint failed")
-		w.WriteHeader(http.StatusConflict)
-		_ = json.NewEncoder(w).Encode(resp)
+	userid, bannedid := ids[0], ids[1]
+	if userid == bannedid {
+		sendInvalidParameter(w, r, ctx, "userBanId", "a user cannot ban itself")
 		return
 	}
-	errF := rt.db.DeleteFollowerUser(userid, bannedid)
-	if errF != nil {
-		resp := ApiResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "unfollowed user",
+	// The ban breaks the follow relationship in both directions: everything is done in a transaction, so that the ban
+	// is never applied without the unfollows
+	var errB error
+	errF := rt.db.WithTx(r.Context(), func(tx database.AppDatabase) error {
+		errB = tx.BanUser(r.Context(), userid, bannedid)
+		if errB != nil {
+			return errB
 		}
-		ctx.Logger.WithError(errF).Error("user: the banned user does not follow the user who banned him")
-		w.WriteHeader(http.StatusConflict)
-		_ = json.NewEncoder(w).Encode(resp)
+		for _, f := range [][2]uint64{{userid, bannedid}, {bannedid, userid}} {
+			if err := tx.DeleteFollowerUser(r.Context(), f[0], f[1]); err != nil && !errors.Is(err, database.ErrFollowNotExists) {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(errB, database.ErrBanExists) {
+		sendProblem(w, r, ctx, http.StatusConflict, codeConflict, "the user is already banned")
+		return
+	} else if errors.Is(errB, database.ErrUserNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "user not found")
+		return
+	} else if errF != nil {
+		sendInternalError(w, r, ctx, errF, "user: error banning the user")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (rt *_router) followUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	userid, erru := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	followingId, errb := strconv.ParseUint(ps.ByName("followingId"), 10, 64)
-	if erru != nil || errb != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "error parsing JSON",
-		}
-		ctx.Logger.WithError(erru).Error("user: error parsing JSON")
-		ctx.Logger.WithError(errb).Error("user: error parsing JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "followingId")
+	if !ok {
 		return
 	}
-	err := rt.db.FollowerUser(userid, followingId)
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusConflict,
-			Message: "Constraint failed",
-		}
-		ctx.Logger.WithError(err).Error("user: error constraint failed")
-		w.WriteHeader(http.StatusConflict)
-		_ = json.NewEncoder(w).Encode(resp)
+	userid, followingId := ids[0], ids[1]
+	if !rt.checkBan(w, r, ctx, followingId, interactionFollow) {
+		return
+	}
+	err := rt.db.FollowerUser(r.Context(), userid, followingId)
+	if errors.Is(err, database.ErrFollowExists) {
+		sendProblem(w, r, ctx, http.StatusConflict, codeConflict, "the user is already followed")
+		return
+	} else if errors.Is(err, database.ErrUserNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "user not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "user: error following the user")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (rt *_router) getMyStream(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	userId, err := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "error parsing JSON",
-		}
-		ctx.Logger.WithError(err).Error("stream: Error parsing userId")
-		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(resp)
+	page, ok := readPage(w, r, ctx)
+	if !ok {
 		return
 	}
 
-	photos, err := rt.db.GetStream(userId)
+	photos, err := rt.db.GetStream(r.Context(), ctx.User.ID, lookahead(page))
 	if err != nil {
-		ctx.Logger.WithError(err).Error("stream: Error getting photos")
-		w.WriteHeader(http.StatusInternalServerError)
+		sendInternalError(w, r, ctx, err, "stream: Error getting photos")
 		return
 	}
 
 	stream := Stream{
 		Photos: make([]Photo, 0),
 	}
+	if len(photos) > page.Limit {
+		photos = photos[:page.Limit]
+		last := photos[len(photos)-1]
+		stream.NextCursor = encodeCursor(database.Cursor{Time: last.Datetime, ID: last.Id})
+	}
 
 	for _, p := range photos {
 		apiPhoto := Photo{}
@@ -113,35 +104,25 @@ func (rt *_router) getMyStream(w http.ResponseWriter, r *http.Request, ps httpro
 }
 
 func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	id, err := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "error parsing JSON",
-		}
-		ctx.Logger.WithError(err).Error("user: error parsing JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId")
+	if !ok {
+		return
+	}
+	id := ids[0]
+	if !rt.checkBan(w, r, ctx, id, interactionView) {
 		return
 	}
-	profiledb, err := rt.db.GetUserProfile(id)
+	profiledb, err := rt.db.GetUserProfile(r.Context(), id, ctx.User.ID)
 	if errors.Is(err, database.ErrUserNotExists) {
-		resp := ApiResponse{
-			Code:    http.StatusConflict,
-			Message: "user: The user not exists",
-		}
-		w.WriteHeader(http.StatusConflict)
-		_ = json.NewEncoder(w).Encode(resp)
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "user not found")
 		return
 	} else if err != nil {
-		ctx.Logger.WithError(err).Error("Profile: Error getting profile")
-		w.WriteHeader(http.StatusInternalServerError)
+		sendInternalError(w, r, ctx, err, "Profile: Error getting profile")
 		return
 	}
 
-	u := User{
-		Username: profiledb.User.Username,
-	}
+	var u User
+	u.FromDatabase(*profiledb.User)
 	profile := Profile{
 		User:      &u,
 		Post:      profiledb.Post,
@@ -160,46 +141,27 @@ func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps htt
 }
 
 func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	id, err := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "Error Parsing JSON",
-		}
-		ctx.Logger.WithError(err).Error("user: error parsing JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
-		return
-	}
 	var updatedUser User
-	err = json.NewDecoder(r.Body).Decode(&updatedUser)
+	err := json.NewDecoder(r.Body).Decode(&updatedUser)
 	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "Error decoding JSON",
-		}
-		ctx.Logger.WithError(err).Error("user: error decoding JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeInvalidBody, "the body is not a valid JSON user")
 		return
 	} else if !updatedUser.IsValid() {
-		w.WriteHeader(http.StatusBadRequest)
+		sendProblem(w, r, ctx, http.StatusBadRequest, codeValidationFailed, "invalid username",
+			FieldError{Field: "username", Message: usernameRule})
 		return
 	}
-	updatedUser.ID = id
-	dbuser, err := rt.db.UpdateUser(updatedUser.ToDatabase())
+	updatedUser.ID = ctx.User.ID
+	dbuser, err := rt.db.UpdateUser(r.Context(), updatedUser.ToDatabase())
 	if errors.Is(err, database.ErrUserNotExists) {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "The user not exists",
-		}
-		ctx.Logger.WithError(err).Error("user: error user not exists")
-		w.WriteHeader(http.StatusNotFound)
-		_ = json.NewEncoder(w).Encode(resp)
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "user not found")
+		return
+	} else if errors.Is(err, database.ErrUserExists) {
+		sendProblem(w, r, ctx, http.StatusConflict, codeConflict, "the username is taken by another user",
+			FieldError{Field: "username", Message: "already taken"})
 		return
 	} else if err != nil {
-		ctx.Logger.WithError(err).WithField("id", id).Error("can't update the user")
-		w.WriteHeader(http.StatusInternalServerError)
+		sendInternalError(w, r, ctx, err, "can't update the user")
 		return
 	}
 	updatedUser.FromDatabase(dbuser)
@@ -208,68 +170,119 @@ func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps http
 }
 
 func (rt *_router) unbanUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	userid, erru := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	bannedid, errb := strconv.ParseUint(ps.ByName("userBanId"), 10, 64)
-	if erru != nil || errb != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "error parsing JSON",
-		}
-		ctx.Logger.WithError(erru).Error("user: error parsing JSON")
-		ctx.Logger.WithError(errb).Error("user: error parsing JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "userBanId")
+	if !ok {
 		return
 	}
+	userid, bannedid := ids[0], ids[1]
 	if userid == bannedid {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "error parsing JSON",
-		}
-		ctx.Logger.WithError(erru).Error("user: bannerId cannot be equal to userid")
-		ctx.Logger.WithError(errb).Error("user: bannerId cannot be equal to userid")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+		sendInvalidParameter(w, r, ctx, "userBanId", "a user cannot unban itself")
 		return
 	}
-	err := rt.db.DeleteBan(userid, bannedid)
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusConflict,
-			Message: "Constraint failed",
-		}
-		ctx.Logger.WithError(err).Error("user: error constraint failed")
-		w.WriteHeader(http.StatusConflict)
-		_ = json.NewEncoder(w).Encode(resp)
+	err := rt.db.DeleteBan(r.Context(), userid, bannedid)
+	if errors.Is(err, database.ErrBanNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "ban not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "user: error removing the ban")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	userid, erru := strconv.ParseUint(ps.ByName("userId"), 10, 64)
-	followingId, errb := strconv.ParseUint(ps.ByName("followingId"), 10, 64)
-	if erru != nil || errb != nil {
-		resp := ApiResponse{
-			Code:    http.StatusBadRequest,
-			Message: "error parsing JSON",
-		}
-		ctx.Logger.WithError(erru).Error("user: error parsing JSON")
-		ctx.Logger.WithError(errb).Error("user: error parsing JSON")
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
+	ids, ok := pathIDs(w, r, ps, ctx, "userId", "followingId")
+	if !ok {
 		return
 	}
-	err := rt.db.FollowerUser(userid, followingId)
-	if err != nil {
-		resp := ApiResponse{
-			Code:    http.StatusConflict,
-			Message: "Constraint failed",
-		}
-		ctx.Logger.WithError(err).Error("user: error constraint failed")
-		w.WriteHeader(http.StatusConflict)
-		_ = json.NewEncoder(w).Encode(resp)
+	err := rt.db.DeleteFollowerUser(r.Context(), ids[0], ids[1])
+	if errors.Is(err, database.ErrFollowNotExists) {
+		sendProblem(w, r, ctx, http.StatusNotFound, codeNotFound, "follow not found")
+		return
+	} else if err != nil {
+		sendInternalError(w, r, ctx, err, "user: error removing the follow")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (rt *_router) getFollowers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.listFollows(w, r, ps, ctx, rt.db.ListFollowers)
+}
+
+func (rt *_router) getFollowing(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.listFollows(w, r, ps, ctx, rt.db.ListFollowing)
+}
+
+// listFollows sends a page of the users returned by `list` for the user in the path.
+func (rt *_router) listFollows(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext,
+	list func(context.Context, uint64, uint64, database.Page) ([]database.UserEntry, error)) {
+	ids, ok := pathIDs(w, r, ps, ctx, "userId")
+	if !ok {
+		return
+	}
+	id := ids[0]
+	page, ok := readPage(w, r, ctx)
+	if !ok {
+		return
+	}
+	if !rt.checkBan(w, r, ctx, id, interactionView) {
+		return
+	}
+
+	dbusers, err := list(r.Context(), id, ctx.User.ID, lookahead(page))
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "user: error listing followers")
+		return
+	}
+
+	users := Users{
+		Users: make([]UserEntry, 0, len(dbusers)),
+	}
+	if len(dbusers) > page.Limit {
+		dbusers = dbusers[:page.Limit]
+		users.NextCursor = encodeCursor(database.Cursor{ID: dbusers[len(dbusers)-1].User.ID})
+	}
+	for _, u := range dbusers {
+		var entry UserEntry
+		entry.FromDatabase(u)
+		users.Users = append(users.Users, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(users)
+}
+
+// searchUsers sends the users whose username starts with the `search` query parameter.
+func (rt *_router) searchUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	prefix := r.URL.Query().Get("search")
+	if len(prefix) < 1 || len(prefix) > 16 || !usernameRx.MatchString(prefix) {
+		sendInvalidParameter(w, r, ctx, "search", "must be 1 to 16 characters long, with letters, digits, _ or - only")
+		return
+	}
+	page, ok := readPage(w, r, ctx)
+	if !ok {
+		return
+	} else if page.After != nil {
+		sendInvalidParameter(w, r, ctx, "cursor", "the search is not paginated")
+		return
+	}
+
+	dbusers, err := rt.db.SearchUsers(r.Context(), ctx.User.ID, prefix, page.Limit)
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "user: error searching users")
+		return
+	}
+
+	users := Users{
+		Users: make([]UserEntry, 0, len(dbusers)),
+	}
+	for _, u := range dbusers {
+		var entry UserEntry
+		entry.FromDatabase(u)
+		users.Users = append(users.Users, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(users)
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSetMyUserName(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	login(t, srv, "bob")
+	path := fmt.Sprintf("/users/%d/username", alice.ID)
+
+	var u User
+	if status := doJSON(t, srv, alice, http.MethodPut, path, `{"username":"alice2"}`, &u); status != http.StatusOK {
+		t.Fatalf("got status %d", status)
+	} else if u.ID != alice.ID || u.Username != "alice2" {
+		t.Errorf("got user %+v", u)
+	}
+
+	var profile Profile
+	if status := doJSON(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d", alice.ID), "", &profile); status != http.StatusOK {
+		t.Fatalf("profile: got status %d", status)
+	} else if profile.User.Username != "alice2" {
+		t.Errorf("profile: got username %q after the update", profile.User.Username)
+	}
+
+	if status := doJSON(t, srv, alice, http.MethodPut, path, `{"username":"a"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("invalid username: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	carol := login(t, srv, "carol")
+
+	for _, s := range []Session{alice, carol} {
+		if status := doRequest(t, srv, s, http.MethodPut, fmt.Sprintf("/users/%d/following/%d", s.ID, bob.ID), "", nil); status != http.StatusNoContent {
+			t.Fatalf("follow: got status %d", status)
+		}
+	}
+	if status := doRequest(t, srv, alice, http.MethodPut, fmt.Sprintf("/users/%d/following/%d", alice.ID, carol.ID), "", nil); status != http.StatusNoContent {
+		t.Fatalf("follow: got status %d", status)
+	}
+
+	// Followers of bob as seen by alice, one per page
+	var got []UserEntry
+	path := fmt.Sprintf("/users/%d/followers?limit=1", bob.ID)
+	for i := 0; path != ""; i++ {
+		var users Users
+		if status := doJSON(t, srv, alice, http.MethodGet, path, "", &users); status != http.StatusOK {
+			t.Fatalf("followers: got status %d", status)
+		}
+		got = append(got, users.Users...)
+		path = ""
+		if users.NextCursor != "" {
+			path = fmt.Sprintf("/users/%d/followers?limit=1&cursor=%s", bob.ID, users.NextCursor)
+		}
+		if i > 2 {
+			t.Fatalf("followers: too many pages")
+		}
+	}
+	if len(got) != 2 || got[0].ID != alice.ID || got[1].ID != carol.ID || got[0].FollowedByMe || !got[1].FollowedByMe {
+		t.Errorf("followers: got %+v", got)
+	}
+
+	var following Users
+	if status := doJSON(t, srv, bob, http.MethodGet, fmt.Sprintf("/users/%d/following", alice.ID), "", &following); status != http.StatusOK {
+		t.Fatalf("following: got status %d", status)
+	} else if len(following.Users) != 2 {
+		t.Errorf("following: got %+v, want bob and carol", following.Users)
+	}
+
+	if status := doRequest(t, srv, alice, http.MethodDelete, fmt.Sprintf("/users/%d/following/%d", alice.ID, bob.ID), "", nil); status != http.StatusNoContent {
+		t.Fatalf("unfollow: got status %d", status)
+	}
+	if status := doRequest(t, srv, alice, http.MethodDelete, fmt.Sprintf("/users/%d/following/%d", alice.ID, bob.ID), "", nil); status != http.StatusNotFound {
+		t.Errorf("unfollow twice: got status %d, want %d", status, http.StatusNotFound)
+	}
+	var profile Profile
+	if status := doJSON(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d", bob.ID), "", &profile); status != http.StatusOK {
+		t.Fatalf("profile: got status %d", status)
+	} else if profile.Follower != 1 {
+		t.Errorf("profile: got %d followers after the unfollow, want 1", profile.Follower)
+	}
+}
+
+func TestBanAndUnban(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	for _, f := range [][2]Session{{alice, bob}, {bob, alice}} {
+		if status := doRequest(t, srv, f[0], http.MethodPut, fmt.Sprintf("/users/%d/following/%d", f[0].ID, f[1].ID), "", nil); status != http.StatusNoContent {
+			t.Fatalf("follow: got status %d", status)
+		}
+	}
+
+	banPath := fmt.Sprintf("/users/%d/bans/%d", alice.ID, bob.ID)
+	if status := doRequest(t, srv, alice, http.MethodPut, fmt.Sprintf("/users/%d/bans/%d", alice.ID, alice.ID), "", nil); status != http.StatusBadRequest {
+		t.Errorf("self ban: got status %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := doRequest(t, srv, alice, http.MethodPut, banPath, "", nil); status != http.StatusNoContent {
+		t.Fatalf("ban: got status %d", status)
+	}
+
+	// The ban removed the follows in both directions
+	var profile Profile
+	if status := doJSON(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d", alice.ID), "", &profile); status != http.StatusOK {
+		t.Fatalf("profile: got status %d", status)
+	} else if profile.Follower != 0 || profile.Following != 0 {
+		t.Errorf("profile after the ban: got %d followers and %d following, want none", profile.Follower, profile.Following)
+	}
+
+	if status := doRequest(t, srv, alice, http.MethodDelete, banPath, "", nil); status != http.StatusNoContent {
+		t.Fatalf("unban: got status %d", status)
+	}
+	if status := doRequest(t, srv, alice, http.MethodDelete, banPath, "", nil); status != http.StatusNotFound {
+		t.Errorf("unban twice: got status %d, want %d", status, http.StatusNotFound)
+	}
+	if status := doRequest(t, srv, bob, http.MethodGet, fmt.Sprintf("/users/%d", alice.ID), "", nil); status != http.StatusOK {
+		t.Errorf("profile after the unban: got status %d", status)
+	}
+}
+
+func TestGetUserProfile(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	photoId := uploadTestPhoto(t, srv, alice)
+
+	var profile Profile
+	if status := doJSON(t, srv, bob, http.MethodGet, fmt.Sprintf("/users/%d", alice.ID), "", &profile); status != http.StatusOK {
+		t.Fatalf("got status %d", status)
+	}
+	if profile.User == nil || profile.User.ID != alice.ID || profile.Post != 1 || len(profile.Photos) != 1 || profile.Photos[0].Id != photoId {
+		t.Errorf("got profile %+v", profile)
+	}
+
+	if status := doRequest(t, srv, bob, http.MethodGet, "/users/alice", "", nil); status != http.StatusBadRequest {
+		t.Errorf("invalid user ID: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestGetMyStream(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+	var photos []uint64
+	for i := 0; i < 3; i++ {
+		photos = append(photos, uploadTestPhoto(t, srv, bob))
+	}
+	if status := doRequest(t, srv, alice, http.MethodPut, fmt.Sprintf("/users/%d/following/%d", alice.ID, bob.ID), "", nil); status != http.StatusNoContent {
+		t.Fatalf("follow: got status %d", status)
+	}
+
+	var got []uint64
+	path := fmt.Sprintf("/users/%d/streams?limit=2", alice.ID)
+	for i := 0; path != ""; i++ {
+		var stream Stream
+		if status := doJSON(t, srv, alice, http.MethodGet, path, "", &stream); status != http.StatusOK {
+			t.Fatalf("got status %d", status)
+		}
+		for _, p := range stream.Photos {
+			if p.Author == nil || p.Author.Username != "bob" {
+				t.Errorf("photo without author: %+v", p)
+			}
+			got = append(got, p.Id)
+		}
+		path = ""
+		if stream.NextCursor != "" {
+			path = fmt.Sprintf("/users/%d/streams?limit=2&cursor=%s", alice.ID, stream.NextCursor)
+		}
+		if i > 2 {
+			t.Fatalf("too many pages")
+		}
+	}
+	if len(got) != 3 || got[0] != photos[2] || got[2] != photos[0] {
+		t.Errorf("got photos %v, want %v from the most recent", got, photos)
+	}
+
+	for _, path := range []string{"?limit=0", "?limit=abc", "?cursor=invalid"} {
+		if status := doRequest(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d/streams%s", alice.ID, path), "", nil); status != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", path, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	login(t, srv, "Annie")
+	login(t, srv, "bob")
+
+	var users Users
+	if status := doJSON(t, srv, alice, http.MethodGet, "/users?search=A", "", &users); status != http.StatusOK {
+		t.Fatalf("got status %d", status)
+	}
+	if len(users.Users) != 2 || users.Users[0].Username != "alice" || users.Users[1].Username != "Annie" {
+		t.Errorf("got users %+v, want alice and Annie", users.Users)
+	}
+
+	if status := doRequest(t, srv, alice, http.MethodGet, "/users", "", nil); status != http.StatusBadRequest {
+		t.Errorf("missing search: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+
+	"sapienza/azzurra/wasaphoto/service/api/reqcontext"
+)
+
+// interaction is an action of the logged in user on another user or on their content.
+type interaction int
+
+const (
+	// interactionView is viewing the profile, the photos, the comments or the likes of a user
+	interactionView interaction = iota
+
+	// interactionLike is liking a photo
+	interactionLike
+
+	// interactionComment is commenting a photo
+	interactionComment
+
+	// interactionFollow is following a user
+	interactionFollow
+)
+
+// banStatus returns the HTTP status code sent to a user banned by the owner of the content for the interaction. Views
+// reply "not found", so banned users can't tell if the content exists; other interactions reply "forbidden".
+func banStatus(action interaction) int {
+	if action == interactionView {
+		return http.StatusNotFound
+	}
+	return http.StatusForbidden
+}
+
+// checkBan is the central check for bans: if `ownerId` banned the logged in user, the error for the interaction is
+// sent to the client and false is returned. Every handler acting on other users' content must call it.
+func (rt *_router) checkBan(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext, ownerId uint64, action interaction) bool {
+	if ownerId == ctx.User.ID {
+		return true
+	}
+
+	banned, err := rt.db.IsBanned(r.Context(), ownerId, ctx.User.ID)
+	if err != nil {
+		sendInternalError(w, r, ctx, err, "ban: error checking the ban")
+		return false
+	} else if banned {
+		if status := banStatus(action); status == http.StatusNotFound {
+			sendProblem(w, r, ctx, status, codeNotFound, "not found")
+		} else {
+			sendProblem(w, r, ctx, status, codeBanned, "the owner of the content banned the user")
+		}
+		return false
+	}
+	return true
+}
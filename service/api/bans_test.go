@@ -0,0 +1,69 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestBanPolicy(t *testing.T) {
+	srv := newTestServer(t)
+	owner := login(t, srv, "owner")
+	banned := login(t, srv, "banned")
+	other := login(t, srv, "other")
+	photoId := uploadTestPhoto(t, srv, owner)
+
+	if status := doRequest(t, srv, owner, http.MethodPut, fmt.Sprintf("/users/%d/bans/%d", owner.ID, banned.ID), "", nil); status != http.StatusNoContent {
+		t.Fatalf("ban: unexpected status %d", status)
+	}
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		// want is the status code for the banned user, wantOther for a user not banned
+		want      int
+		wantOther int
+	}{
+		{"view profile", http.MethodGet, "/users/%[1]d", "", http.StatusNotFound, http.StatusOK},
+		{"view image", http.MethodGet, "/users/%[1]d/photos/%[3]d/image", "", http.StatusNotFound, http.StatusOK},
+		{"view comments", http.MethodGet, "/users/%[2]d/photos/%[3]d/comments", "", http.StatusNotFound, http.StatusOK},
+		{"view likes", http.MethodGet, "/users/%[2]d/photos/%[3]d/likes", "", http.StatusNotFound, http.StatusOK},
+		{"like", http.MethodPut, "/users/%[2]d/photos/%[3]d/likes", "", http.StatusForbidden, http.StatusOK},
+		{"comment", http.MethodPost, "/users/%[2]d/photos/%[3]d/comments", `{"text":"hello"}`, http.StatusForbidden, http.StatusOK},
+		{"follow", http.MethodPut, "/users/%[2]d/following/%[1]d", "", http.StatusForbidden, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, c := range []struct {
+				user Session
+				want int
+			}{{banned, tt.want}, {other, tt.wantOther}} {
+				path := fmt.Sprintf(tt.path, owner.ID, c.user.ID, photoId)
+				status := doRequest(t, srv, c.user, tt.method, path, "application/json", bytes.NewBufferString(tt.body))
+				if status != c.want {
+					t.Errorf("%s %s as %s: got status %d, want %d", tt.method, path, c.user.Username, status, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBanStatus(t *testing.T) {
+	var tests = []struct {
+		action interaction
+		want   int
+	}{
+		{interactionView, http.StatusNotFound},
+		{interactionLike, http.StatusForbidden},
+		{interactionComment, http.StatusForbidden},
+		{interactionFollow, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := banStatus(tt.action); got != tt.want {
+			t.Errorf("banStatus(%d) = %d, want %d", tt.action, got, tt.want)
+		}
+	}
+}
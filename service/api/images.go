@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	// Decoders of the accepted image formats, registered in the image package
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// errImageTooLarge is returned when the image is larger than the maximum size in bytes
+	errImageTooLarge = errors.New("image too large")
+
+	// errImageUnsupported is returned when the image is not in one of the accepted formats
+	errImageUnsupported = errors.New("unsupported image format")
+
+	// errImageInvalid is returned when the image can't be decoded
+	errImageInvalid = errors.New("invalid image")
+
+	// errImageDimensions is returned when the width or the height of the image are larger than the maximum
+	errImageDimensions = errors.New("image dimensions too large")
+)
+
+// imageFormat is an accepted image format.
+type imageFormat struct {
+	// Name is the name of the format, as registered in the image package
+	Name string
+
+	// ContentType is the MIME type of the format
+	ContentType string
+
+	// Ext is the file extension of the format, with the dot
+	Ext string
+}
+
+var (
+	formatJPEG = imageFormat{Name: "jpeg", ContentType: "image/jpeg", Ext: ".jpg"}
+	formatPNG  = imageFormat{Name: "png", ContentType: "image/png", Ext: ".png"}
+	formatGIF  = imageFormat{Name: "gif", ContentType: "image/gif", Ext: ".gif"}
+	formatWebP = imageFormat{Name: "webp", ContentType: "image/webp", Ext: ".webp"}
+)
+
+// sniffImage detects the format of the image from its first bytes (the "magic bytes"). The client filename and content
+// type are never trusted.
+func sniffImage(data []byte) (imageFormat, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return formatJPEG, true
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return formatPNG, true
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return formatGIF, true
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return formatWebP, true
+	}
+	return imageFormat{}, false
+}
+
+// imageLimits are the limits of the uploaded images.
+type imageLimits struct {
+	// MaxBytes is the maximum size of the image file
+	MaxBytes int64
+
+	// MaxDimension is the maximum width and height of the image, in pixels
+	MaxDimension int
+}
+
+// readImage reads the uploaded image and checks it: the size must be within the limits, the format must be one of the
+// accepted ones and the image must be decoded correctly. It returns the content of the file, the decoded image and its
+// format.
+func readImage(r io.Reader, limits imageLimits) ([]byte, image.Image, imageFormat, error) {
+	// One more byte than the limit, to know if the file is too large
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, nil, imageFormat{}, err
+	} else if int64(len(data)) > limits.MaxBytes {
+		return nil, nil, imageFormat{}, errImageTooLarge
+	}
+
+	format, ok := sniffImage(data)
+	if !ok {
+		return nil, nil, imageFormat{}, errImageUnsupported
+	}
+
+	// The dimensions are checked on the header, before decoding the whole image: a small file can declare a huge image
+	cfg, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || name != format.Name {
+		return nil, nil, format, errImageInvalid
+	} else if cfg.Width < 1 || cfg.Height < 1 {
+		return nil, nil, format, errImageInvalid
+	} else if cfg.Width > limits.MaxDimension || cfg.Height > limits.MaxDimension {
+		return nil, nil, format, fmt.Errorf("%w: %dx%d", errImageDimensions, cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, format, errImageInvalid
+	}
+	return data, img, format, nil
+}
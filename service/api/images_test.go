@@ -0,0 +1,66 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// encodeImage encodes a width x height image with the encoder.
+func encodeImage(t *testing.T, width int, height int, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) }
+
+func encodeJPEG(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }
+
+func encodeGIF(buf *bytes.Buffer, img image.Image) error { return gif.Encode(buf, img, nil) }
+
+// webpImage is a 1x1 lossless WebP image.
+var webpImage = []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+
+func TestReadImage(t *testing.T) {
+	limits := imageLimits{MaxBytes: 4096, MaxDimension: 64}
+	pngImage := encodeImage(t, 8, 8, encodePNG)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format imageFormat
+		err    error
+	}{
+		{"png", pngImage, formatPNG, nil},
+		{"jpeg", encodeImage(t, 8, 8, encodeJPEG), formatJPEG, nil},
+		{"gif", encodeImage(t, 8, 8, encodeGIF), formatGIF, nil},
+		{"webp", webpImage, formatWebP, nil},
+		{"too large", append(pngImage, make([]byte, 4096)...), imageFormat{}, errImageTooLarge},
+		{"too wide", encodeImage(t, 65, 8, encodePNG), formatPNG, errImageDimensions},
+		{"too high", encodeImage(t, 8, 65, encodeGIF), formatGIF, errImageDimensions},
+		{"truncated", pngImage[:len(pngImage)/2], formatPNG, errImageInvalid},
+		{"wrong format", append([]byte("GIF89a"), pngImage[6:]...), formatGIF, errImageInvalid},
+		{"text", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), imageFormat{}, errImageUnsupported},
+		{"empty", nil, imageFormat{}, errImageUnsupported},
+	}
+	for _, tt := range tests {
+		data, img, format, err := readImage(bytes.NewReader(tt.data), limits)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+		} else if format != tt.format {
+			t.Errorf("%s: got format %+v, want %+v", tt.name, format, tt.format)
+		} else if err == nil && !bytes.Equal(data, tt.data) {
+			t.Errorf("%s: got %d bytes, want %d", tt.name, len(data), len(tt.data))
+		} else if err == nil && img == nil {
+			t.Errorf("%s: got no image", tt.name)
+		}
+	}
+}
@@ -5,12 +5,10 @@ import (
 	"net/http"
 )
 
-// liveness is an HTTP handler that checks the API server status. If the server cannot serve requests (e.g., some
-// resources are not ready), this should reply with HTTP Status 500. Otherwise, with HTTP Status 200
+// liveness is an HTTP handler that checks the API server status: if it replies (with HTTP Status 200), the server is
+// alive. External resources (e.g., the database) are not checked here, as restarting the server wouldn't fix them: see
+// readiness instead.
 func (rt *_router) liveness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	/* Example of liveness check:
-	if err := rt.DB.Ping(); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}*/
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
 }
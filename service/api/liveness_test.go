@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLiveness(t *testing.T) {
+	srv := newTestServer(t)
+	if status := doRequest(t, srv, Session{}, http.MethodGet, "/liveness", "", nil); status != http.StatusOK {
+		t.Errorf("got status %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	srv := newTestServer(t)
+	var ready ReadinessResponse
+	if status := doJSON(t, srv, Session{}, http.MethodGet, "/readiness", "", &ready); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	for _, name := range []string{"database", "migrations", "images"} {
+		if ready.Checks[name].Status != "ok" {
+			t.Errorf("check %s: got %+v, want ok", name, ready.Checks[name])
+		}
+	}
+
+	// The images folder doesn't exist: the server is not ready
+	missing := filepath.Join(t.TempDir(), "missing")
+	broken := newTestServerWith(t, Config{ImagesFolder: missing})
+
+	res := send(t, broken, Session{}, http.MethodGet, "/readiness", "", nil)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+	body, _ := io.ReadAll(res.Body)
+	ready = ReadinessResponse{}
+	if err := json.Unmarshal(body, &ready); err != nil {
+		t.Fatal(err)
+	}
+	if ready.Status != "fail" || ready.Checks["images"].Status != "fail" || ready.Checks["database"].Status != "ok" {
+		t.Errorf("got %+v, want the images check to fail", ready)
+	} else if strings.Contains(string(body), missing) {
+		t.Errorf("the response contains the path of the images folder: %s", body)
+	}
+
+	// The result of the storage check is reused: the folder is created, but the server is still not ready
+	if err := os.Mkdir(missing, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if status := doRequest(t, broken, Session{}, http.MethodGet, "/readiness", "", nil); status != http.StatusServiceUnavailable {
+		t.Errorf("after creating the folder: got status %d, want the cached result", status)
+	}
+}
@@ -0,0 +1,363 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"time"
+)
+
+// imageMetadata are the fields read from the EXIF metadata of an uploaded image. Everything else in the metadata (GPS
+// coordinates, camera serial numbers, ...) is removed by stripMetadata.
+type imageMetadata struct {
+	// Orientation is the EXIF orientation (1 to 8) of the original image: 1 if missing
+	Orientation int
+
+	// TakenAt is when the photo was taken, zero if unknown. Without a time zone in the metadata, the time is in UTC.
+	TakenAt time.Time
+}
+
+// EXIF tags read by readMetadata
+const (
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+)
+
+// readMetadata reads the EXIF metadata of JPEG (APP1 segment), PNG (eXIf chunk) and WebP (EXIF chunk) images. Missing
+// or invalid metadata are ignored.
+func readMetadata(data []byte, format imageFormat) imageMetadata {
+	var exif []byte
+	switch format {
+	case formatJPEG:
+		_ = walkJPEG(data, func(marker byte, segment []byte) bool {
+			if marker == 0xe1 && bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+				exif = segment[10:]
+				return false
+			}
+			return true
+		})
+	case formatPNG:
+		_ = walkPNG(data, func(kind string, chunk []byte) bool {
+			if kind == "eXIf" {
+				exif = chunk[8 : len(chunk)-4]
+				return false
+			}
+			return true
+		})
+	case formatWebP:
+		_ = walkWebP(data, func(kind string, chunk []byte) bool {
+			if kind == "EXIF" {
+				// Some encoders write the "Exif" header of JPEG files before the TIFF structure
+				exif = bytes.TrimPrefix(chunk[8:8+binary.LittleEndian.Uint32(chunk[4:])], []byte("Exif\x00\x00"))
+				return false
+			}
+			return true
+		})
+	}
+	return parseExif(exif)
+}
+
+// parseExif parses the EXIF data (a TIFF structure).
+func parseExif(b []byte) imageMetadata {
+	md := imageMetadata{Orientation: 1}
+	if len(b) < 8 {
+		return md
+	}
+	var order binary.ByteOrder
+	switch string(b[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return md
+	}
+	if order.Uint16(b[2:4]) != 42 {
+		return md
+	}
+
+	ifd0 := readIFD(b, order, order.Uint32(b[4:8]))
+	if v, ok := ifd0[tagOrientation]; ok && len(v) >= 2 {
+		if o := int(order.Uint16(v)); o >= 1 && o <= 8 {
+			md.Orientation = o
+		}
+	}
+
+	date, offset := exifString(ifd0[tagDateTime]), ""
+	if v, ok := ifd0[tagExifIFD]; ok && len(v) >= 4 {
+		exifIFD := readIFD(b, order, order.Uint32(v))
+		if original := exifString(exifIFD[tagDateTimeOriginal]); original != "" {
+			date, offset = original, exifString(exifIFD[tagOffsetTimeOriginal])
+		}
+	}
+	if t, err := time.Parse("2006:01:02 15:04:05-07:00", date+offset); offset != "" && err == nil {
+		md.TakenAt = t
+	} else if t, err := time.Parse("2006:01:02 15:04:05", date); err == nil {
+		md.TakenAt = t
+	}
+	return md
+}
+
+// readIFD returns the values of the entries of the TIFF IFD at the offset, by tag. Values are not decoded: they are the
+// bytes of the value, in the byte order of the TIFF structure.
+func readIFD(b []byte, order binary.ByteOrder, offset uint32) map[uint16][]byte {
+	entries := map[uint16][]byte{}
+	if uint64(offset)+2 > uint64(len(b)) {
+		return entries
+	}
+	n := int(order.Uint16(b[offset:]))
+	for i := 0; i < n; i++ {
+		e := uint64(offset) + 2 + uint64(i)*12
+		if e+12 > uint64(len(b)) {
+			break
+		}
+		tag, kind, count := order.Uint16(b[e:]), order.Uint16(b[e+2:]), order.Uint32(b[e+4:])
+
+		// Sizes of the TIFF types: BYTE, ASCII, SHORT, LONG, RATIONAL, ... (only the types used by readMetadata)
+		var size uint64
+		switch kind {
+		case 1, 2, 7:
+			size = 1
+		case 3:
+			size = 2
+		case 4, 9:
+			size = 4
+		default:
+			continue
+		}
+		length := size * uint64(count)
+		if length <= 4 {
+			entries[tag] = b[e+8 : e+8+length]
+		} else if start := uint64(order.Uint32(b[e+8:])); start+length <= uint64(len(b)) {
+			entries[tag] = b[start : start+length]
+		}
+	}
+	return entries
+}
+
+// exifString returns the value of an ASCII entry, without the terminating NUL.
+func exifString(v []byte) string {
+	if i := bytes.IndexByte(v, 0); i >= 0 {
+		v = v[:i]
+	}
+	return string(v)
+}
+
+// applyOrientation returns the image rotated and flipped as described by the EXIF orientation, so that it's displayed
+// correctly without the metadata.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// (sx, sy) is the pixel of the original image displayed at (x, y)
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated by 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // to be rotated by 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // to be rotated by 90° counterclockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// stripMetadata returns the image file without metadata that may identify the user, like the GPS coordinates and the
+// serial number of the camera in EXIF and XMP. img is the decoded image, with the orientation already applied.
+//
+// JPEG and PNG images are re-encoded if the orientation of the original is not 1, so that the pixels are rotated (rotated
+// WebP images are rejected by uploadPhoto: there's no WebP encoder).
+// Otherwise, files are rewritten without the metadata segments (JPEG), chunks (PNG and WebP), leaving the image data
+// unchanged. GIF images have no standard metadata, and are saved as they are.
+func stripMetadata(data []byte, img image.Image, format imageFormat, md imageMetadata) ([]byte, error) {
+	var out bytes.Buffer
+	switch {
+	case format == formatJPEG && md.Orientation != 1:
+		err := jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+		return out.Bytes(), err
+	case format == formatPNG && md.Orientation != 1:
+		err := png.Encode(&out, img)
+		return out.Bytes(), err
+
+	case format == formatJPEG:
+		out.Write(data[:2])
+		err := walkJPEG(data, func(marker byte, segment []byte) bool {
+			if keepJPEGSegment(marker, segment) {
+				out.Write(segment)
+			}
+			return true
+		})
+		return out.Bytes(), err
+	case format == formatPNG:
+		out.Write(data[:8])
+		err := walkPNG(data, func(kind string, chunk []byte) bool {
+			switch kind {
+			case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+			default:
+				out.Write(chunk)
+			}
+			return true
+		})
+		return out.Bytes(), err
+	case format == formatWebP:
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+// keepJPEGSegment returns whether the JPEG segment is kept by stripMetadata: JFIF (APP0), ICC profiles (APP2) and the
+// Adobe segment (APP14, needed to decode CMYK images) are kept. Other application segments (EXIF, XMP, IPTC, the MPF
+// index of the secondary images, ...) and comments are removed.
+func keepJPEGSegment(marker byte, segment []byte) bool {
+	switch {
+	case marker == 0xe2:
+		return !bytes.HasPrefix(segment[4:], []byte("MPF\x00"))
+	case marker == 0xe0, marker == 0xee:
+		return true
+	case marker >= 0xe1 && marker <= 0xef, marker == 0xfe:
+		return false
+	}
+	return true
+}
+
+// walkJPEG calls fn for each segment of the JPEG file (marker and length included), until fn returns false. A start of
+// scan (SOS) segment is followed by its entropy-coded data, which is passed to fn with it. The walk stops at the end of
+// image (EOI) marker, passed to fn as a 2-byte segment: data after it (like the secondary images of MPF files, with
+// their own metadata) are not part of the image.
+func walkJPEG(data []byte, fn func(marker byte, segment []byte) bool) error {
+	for i := 2; i < len(data); {
+		if i+1 >= len(data) || data[i] != 0xff {
+			return errImageInvalid
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// Fill byte
+			i++
+			continue
+		}
+		if marker == 0xd9 {
+			fn(marker, data[i:i+2])
+			return nil
+		}
+		if i+4 > len(data) {
+			return errImageInvalid
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return errImageInvalid
+		}
+		if marker == 0xda {
+			end = scanEnd(data, end)
+		}
+		if !fn(marker, data[i:end]) {
+			return nil
+		}
+		i = end
+	}
+	return nil
+}
+
+// scanEnd returns the end of the entropy-coded data starting at i: the position of the next marker, other than the
+// restart markers (RST0-7) and the stuffed 0x00 bytes that are part of the data, or the end of the file.
+func scanEnd(data []byte, i int) int {
+	for ; i+1 < len(data); i++ {
+		if data[i] == 0xff && data[i+1] != 0x00 && data[i+1] != 0xff && (data[i+1] < 0xd0 || data[i+1] > 0xd7) {
+			return i
+		}
+	}
+	return len(data)
+}
+
+// walkPNG calls fn for each chunk of the PNG file (length, type and CRC included), until fn returns false.
+func walkPNG(data []byte, fn func(kind string, chunk []byte) bool) error {
+	for i := 8; i < len(data); {
+		if i+12 > len(data) {
+			return errImageInvalid
+		}
+		end := uint64(i) + 12 + uint64(binary.BigEndian.Uint32(data[i:]))
+		if end > uint64(len(data)) {
+			return errImageInvalid
+		}
+		kind := string(data[i+4 : i+8])
+		if !fn(kind, data[i:end]) || kind == "IEND" {
+			return nil
+		}
+		i = int(end)
+	}
+	return nil
+}
+
+// walkWebP calls fn for each chunk of the WebP file (header and padding included), until fn returns false.
+func walkWebP(data []byte, fn func(kind string, chunk []byte) bool) error {
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return errImageInvalid
+		}
+		size := uint64(binary.LittleEndian.Uint32(data[i+4:]))
+		end := uint64(i) + 8 + size + size%2
+		if end > uint64(len(data)) {
+			return errImageInvalid
+		}
+		if !fn(string(data[i:i+4]), data[i:end]) {
+			return nil
+		}
+		i = int(end)
+	}
+	return nil
+}
+
+// stripWebP removes the EXIF and XMP chunks of the WebP file, and the corresponding flags in the VP8X chunk.
+func stripWebP(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	err := walkWebP(data, func(kind string, chunk []byte) bool {
+		switch kind {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := out.Len()
+			out.Write(chunk)
+			if len(chunk) > 8 {
+				// Flags: ICC, alpha, EXIF (0x08), XMP (0x04), animation
+				out.Bytes()[start+8] &^= 0x08 | 0x04
+			}
+		default:
+			out.Write(chunk)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:8], uint32(len(stripped)-8))
+	return stripped, nil
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// secret is written in the metadata of test images: it must not be found in stripped images.
+const secret = "GPS 41.8902N 12.4922E"
+
+// exifData returns big-endian EXIF data with the orientation, the original date and its time zone offset (if not
+// empty), followed by the secret.
+func exifData(orientation uint16, date string, offset string) []byte {
+	be := binary.BigEndian
+	b := []byte("MM\x00\x2a\x00\x00\x00\x08")
+
+	// IFD0 at 8: orientation and pointer to the EXIF IFD (at 8+2+2*12+4 = 38)
+	b = be.AppendUint16(b, 2)
+	b = append(b, entry(tagOrientation, 3, 1, uint32(orientation)<<16)...)
+	b = append(b, entry(tagExifIFD, 4, 1, 38)...)
+	b = be.AppendUint32(b, 0)
+
+	// EXIF IFD at 38, values at 38+2+2*12+4 = 68
+	b = be.AppendUint16(b, 2)
+	b = append(b, entry(tagDateTimeOriginal, 2, uint32(len(date)+1), 68)...)
+	b = append(b, entry(tagOffsetTimeOriginal, 2, uint32(len(offset)+1), uint32(68+len(date)+1))...)
+	b = be.AppendUint32(b, 0)
+	b = append(b, date+"\x00"+offset+"\x00"+secret...)
+	return b
+}
+
+// entry returns a big-endian IFD entry.
+func entry(tag uint16, kind uint16, count uint32, value uint32) []byte {
+	var e [12]byte
+	binary.BigEndian.PutUint16(e[0:], tag)
+	binary.BigEndian.PutUint16(e[2:], kind)
+	binary.BigEndian.PutUint32(e[4:], count)
+	binary.BigEndian.PutUint32(e[8:], value)
+	return e[:]
+}
+
+// jpegWithExif returns a JPEG image with the EXIF data and a comment containing the secret.
+func jpegWithExif(t *testing.T, img image.Image, exif []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	app1 := append([]byte("Exif\x00\x00"), exif...)
+	segments := []byte{0xff, 0xe1, byte((len(app1) + 2) >> 8), byte(len(app1) + 2)}
+	segments = append(segments, app1...)
+	segments = append(segments, 0xff, 0xfe, 0, byte(len(secret)+2))
+	segments = append(segments, secret...)
+	return append(append(buf.Bytes()[:2:2], segments...), buf.Bytes()[2:]...)
+}
+
+// jpegWithMPF returns the JPEG image with an ICC profile and an MPF index (APP2 segments), followed by the secondary
+// image, like the depth maps of phone cameras.
+func jpegWithMPF(primary []byte, secondary []byte) []byte {
+	segments := []byte("\xff\xe2\x00\x10ICC_PROFILE\x00\x01\x01")
+	segments = append(segments, "\xff\xe2\x00\x0aMPF\x00MM\x00\x2a"...)
+	b := append(append(primary[:2:2], segments...), primary[2:]...)
+	return append(b, secondary...)
+}
+
+// pngChunk returns a PNG chunk with the type and the data.
+func pngChunk(kind string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(append(chunk, kind...), data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// pngWithExif returns a PNG image with the EXIF data and a text chunk containing the secret.
+func pngWithExif(t *testing.T, img image.Image, exif []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	// Chunks are added after IHDR (8 bytes of signature, 25 bytes of chunk)
+	chunks := append(pngChunk("eXIf", exif), pngChunk("tEXt", []byte("Comment\x00"+secret))...)
+	return append(append(buf.Bytes()[:33:33], chunks...), buf.Bytes()[33:]...)
+}
+
+// webpWithExif returns the WebP image (in the simple format) in the extended format, with an EXIF chunk.
+func webpWithExif(t *testing.T, img []byte, exif []byte) []byte {
+	t.Helper()
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp8x := []byte("VP8X\x0a\x00\x00\x00\x08\x00\x00\x00")
+	vp8x = append(vp8x, byte(cfg.Width-1), byte((cfg.Width-1)>>8), 0, byte(cfg.Height-1), byte((cfg.Height-1)>>8), 0)
+	chunk := binary.LittleEndian.AppendUint32([]byte("EXIF"), uint32(len(exif)))
+	chunk = append(chunk, exif...)
+	if len(exif)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	b := append([]byte("RIFF\x00\x00\x00\x00WEBP"), vp8x...)
+	b = append(b, img[12:]...)
+	b = append(b, chunk...)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b
+}
+
+func TestReadMetadata(t *testing.T) {
+	img := gradientImage(40, 20)
+	cest := time.FixedZone("", 2*60*60)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		format      imageFormat
+		orientation int
+		takenAt     time.Time
+	}{
+		{"jpeg", jpegWithExif(t, img, exifData(6, "2022:08:01 10:30:00", "+02:00")), formatJPEG, 6, time.Date(2022, 8, 1, 10, 30, 0, 0, cest)},
+		{"png", pngWithExif(t, img, exifData(3, "2022:08:01 10:30:00", "")), formatPNG, 3, time.Date(2022, 8, 1, 10, 30, 0, 0, time.UTC)},
+		{"webp", webpWithExif(t, webpImage, exifData(8, "2022:08:01 10:30:00", "")), formatWebP, 8, time.Date(2022, 8, 1, 10, 30, 0, 0, time.UTC)},
+		{"webp with header", webpWithExif(t, webpImage, append([]byte("Exif\x00\x00"), exifData(6, "", "")...)), formatWebP, 6, time.Time{}},
+		{"invalid orientation", jpegWithExif(t, img, exifData(9, "2022:08:01", "")), formatJPEG, 1, time.Time{}},
+		{"truncated", jpegWithExif(t, img, exifData(6, "2022:08:01 10:30:00", "")[:20]), formatJPEG, 1, time.Time{}},
+		{"no metadata", testImage(t), formatPNG, 1, time.Time{}},
+	}
+	for _, tt := range tests {
+		md := readMetadata(tt.data, tt.format)
+		if md.Orientation != tt.orientation || !md.TakenAt.Equal(tt.takenAt) {
+			t.Errorf("%s: got %+v, want orientation %d and taken at %v", tt.name, md, tt.orientation, tt.takenAt)
+		}
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// A 3x2 image, with a different color for each pixel
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			src.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+
+	// The pixel of the original image displayed at the top left corner
+	corners := map[int]image.Point{1: {0, 0}, 2: {2, 0}, 3: {2, 1}, 4: {0, 1}, 5: {0, 0}, 6: {0, 1}, 7: {2, 1}, 8: {2, 0}}
+	for orientation, corner := range corners {
+		got := applyOrientation(src, orientation)
+		size := image.Pt(3, 2)
+		if orientation >= 5 {
+			size = image.Pt(2, 3)
+		}
+		if got.Bounds().Size() != size {
+			t.Errorf("orientation %d: got size %v, want %v", orientation, got.Bounds().Size(), size)
+		} else if c := got.At(0, 0); c != src.At(corner.X, corner.Y) {
+			t.Errorf("orientation %d: got %v at the top left, want the pixel %v", orientation, c, corner)
+		}
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	img := gradientImage(40, 20)
+	tests := []struct {
+		name   string
+		data   []byte
+		format imageFormat
+		size   image.Point // of the stripped image
+	}{
+		{"jpeg", jpegWithExif(t, img, exifData(1, "2022:08:01 10:30:00", "")), formatJPEG, image.Pt(40, 20)},
+		{"jpeg with secondary image", jpegWithMPF(jpegWithExif(t, img, exifData(1, "2022:08:01 10:30:00", "")),
+			jpegWithExif(t, gradientImage(8, 8), exifData(1, "2022:08:01 10:30:00", ""))), formatJPEG, image.Pt(40, 20)},
+		{"rotated jpeg", jpegWithExif(t, img, exifData(6, "2022:08:01 10:30:00", "")), formatJPEG, image.Pt(20, 40)},
+		{"png", pngWithExif(t, img, exifData(1, "2022:08:01 10:30:00", "")), formatPNG, image.Pt(40, 20)},
+		{"rotated png", pngWithExif(t, img, exifData(8, "2022:08:01 10:30:00", "")), formatPNG, image.Pt(20, 40)},
+		{"webp", webpWithExif(t, webpImage, []byte(secret)), formatWebP, image.Pt(1, 1)},
+	}
+	for _, tt := range tests {
+		decoded, _, err := image.Decode(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatalf("%s: test image not valid: %v", tt.name, err)
+		}
+		md := readMetadata(tt.data, tt.format)
+		got, err := stripMetadata(tt.data, applyOrientation(decoded, md.Orientation), tt.format, md)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		} else if bytes.Contains(got, []byte(secret)) || bytes.Contains(got, []byte("Exif")) || bytes.Contains(got, []byte("MPF\x00")) {
+			t.Errorf("%s: the metadata are not removed", tt.name)
+		} else if tt.format == formatJPEG && bytes.Contains(tt.data, []byte("ICC_PROFILE")) && !bytes.Contains(got, []byte("ICC_PROFILE")) {
+			t.Errorf("%s: the ICC profile is removed", tt.name)
+		} else if tt.format == formatJPEG && !bytes.HasSuffix(got, []byte{0xff, 0xd9}) {
+			t.Errorf("%s: the image doesn't end with the EOI marker", tt.name)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(got))
+		if err != nil || format != tt.format.Name || cfg.Width != tt.size.X || cfg.Height != tt.size.Y {
+			t.Errorf("%s: got a %dx%d %s image, %v", tt.name, cfg.Width, cfg.Height, format, err)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(got)); err != nil {
+			t.Errorf("%s: decoding the stripped image: %v", tt.name, err)
+		}
+	}
+}
+
+func TestUploadStripsMetadata(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+
+	data := jpegWithExif(t, gradientImage(40, 20), exifData(6, "2022:08:01 10:30:00", "+02:00"))
+	res := uploadFile(t, srv, alice, "photo.jpg", data)
+	var photo Photo
+	_ = json.NewDecoder(res.Body).Decode(&photo)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("upload: got status %d", res.StatusCode)
+	} else if photo.Width != 20 || photo.Height != 40 {
+		t.Errorf("got a %dx%d photo, want 20x40", photo.Width, photo.Height)
+	} else if photo.TakenAt == nil || !photo.TakenAt.Equal(time.Date(2022, 8, 1, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("got taken at %v", photo.TakenAt)
+	}
+
+	res = send(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d/image", alice.ID, photo.Id), "", nil)
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if bytes.Contains(body, []byte(secret)) || bytes.Contains(body, []byte("Exif")) {
+		t.Errorf("the stored image has the metadata")
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(body)); err != nil || cfg.Width != 20 || cfg.Height != 40 {
+		t.Errorf("got a %dx%d image, %v", cfg.Width, cfg.Height, err)
+	}
+}
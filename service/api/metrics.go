@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/metrics"
+)
+
+// apiMetrics are the metrics of the API server, exposed by the debug server.
+type apiMetrics struct {
+	// requests counts the requests by route, method and status code
+	requests *metrics.Counter
+
+	// duration observes the duration of requests by route
+	duration *metrics.Histogram
+
+	// uploadBytes counts the bytes of the uploaded photos
+	uploadBytes *metrics.Counter
+}
+
+func newAPIMetrics(r *metrics.Registry) *apiMetrics {
+	return &apiMetrics{
+		requests: r.NewCounter("wasaphoto_http_requests_total",
+			"Number of HTTP requests, by route, method and status code.", "route", "method", "code"),
+		duration: r.NewHistogram("wasaphoto_http_request_duration_seconds",
+			"Duration of HTTP requests, by route.", nil, "route"),
+		uploadBytes: r.NewCounter("wasaphoto_upload_bytes_total",
+			"Total size of the uploaded photos, in bytes."),
+	}
+}
+
+// routeName returns the name of the handler function, used as route label in metrics (e.g., "doLogin").
+func routeName(fn httpRouterHandler) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// statusRecorder is a http.ResponseWriter that records the status code of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// observe records the metrics of a request to the route, started at `start`.
+func (m *apiMetrics) observe(route string, r *http.Request, w *statusRecorder, start time.Time) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	m.requests.Inc(route, r.Method, strconv.Itoa(status))
+	m.duration.Observe(time.Since(start).Seconds(), route)
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/api/reqcontext"
+	"sapienza/azzurra/wasaphoto/service/database"
+)
+
+const (
+	// defaultPageLimit is the page size used when the client doesn't specify the `limit` query parameter
+	defaultPageLimit = 20
+
+	// maxPageLimit is the maximum page size that the client can request
+	maxPageLimit = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+var errInvalidLimit = errors.New("invalid limit")
+
+// parsePage reads the `limit` and `cursor` query parameters of the request.
+func parsePage(r *http.Request) (database.Page, error) {
+	page := database.Page{
+		Limit: defaultPageLimit,
+	}
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page, errInvalidLimit
+		}
+		page.Limit = limit
+	}
+
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		cursor, err := decodeCursor(c)
+		if err != nil {
+			return page, err
+		}
+		page.After = &cursor
+	}
+	return page, nil
+}
+
+// readPage parses the page parameters of the request (see parsePage). If they are not valid, a 400 error is sent to the
+// client and false is returned.
+func readPage(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext) (database.Page, bool) {
+	page, err := parsePage(r)
+	if errors.Is(err, errInvalidCursor) {
+		sendInvalidParameter(w, r, ctx, "cursor", "not a cursor returned by the API")
+		return page, false
+	} else if err != nil {
+		sendInvalidParameter(w, r, ctx, "limit", fmt.Sprintf("must be an integer between 1 and %d", maxPageLimit))
+		return page, false
+	}
+	return page, true
+}
+
+// lookahead returns the page to request to the database: one more item than the requested limit, so we can know if
+// there is a next page.
+func lookahead(page database.Page) database.Page {
+	page.Limit++
+	return page
+}
+
+// encodeCursor returns the opaque representation of the cursor sent to clients.
+func encodeCursor(c database.Cursor) string {
+	var nsec int64
+	if !c.Time.IsZero() {
+		nsec = c.Time.UnixNano()
+	}
+	raw := strconv.FormatInt(nsec, 10) + ":" + strconv.FormatUint(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor created by encodeCursor.
+func decodeCursor(s string) (database.Cursor, error) {
+	var c database.Cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	ts, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return c, errInvalidCursor
+	}
+	nsec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	c.ID, err = strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if nsec != 0 {
+		// Dates are stored in UTC, the cursor must use the same location to compare correctly
+		c.Time = time.Unix(0, nsec).UTC()
+	}
+	return c, nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"sapienza/azzurra/wasaphoto/service/api/reqcontext"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Machine-readable error codes, sent in Problem.Code. Clients should rely on these (and on the status code), not on the
+// human-readable messages.
+const (
+	codeInvalidParameter = "invalid_parameter" // a path or query parameter is not valid (see Problem.Errors)
+	codeInvalidBody      = "invalid_body"      // the request body can't be decoded
+	codeValidationFailed = "validation_failed" // the request body is decoded, but some fields are not valid
+	codeUnauthenticated  = "unauthenticated"   // the bearer token is missing or not valid
+	codeForbidden        = "forbidden"         // the user can't do the operation (e.g., acting on behalf of another user)
+	codeBanned           = "banned"            // the owner of the content banned the user
+	codeNotFound         = "not_found"         // the resource (user, photo, ...) doesn't exist
+	codeConflict         = "conflict"          // the resource already exists (e.g., a like, a follow, a username)
+	codeTooLarge         = "too_large"         // the uploaded file is larger than the maximum size
+	codeUnsupported      = "unsupported_media" // the uploaded file is not in one of the accepted formats
+	codeInternal         = "internal_error"    // an unexpected error, logged with the request ID
+)
+
+// Problem is the body of every error response, in the "problem details" format of RFC 7807 (sent with the
+// application/problem+json content type). Besides the standard members, it has the machine-readable error code, the ID
+// of the request (to find it in logs) and, for invalid requests, the errors of each field.
+type Problem struct {
+	// Type is a URI identifying the problem type. It's always "about:blank": the problem is described by Status (and
+	// Code)
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request
+	Instance string `json:"instance,omitempty"`
+
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is the error of a single field of the request: a path parameter, a query parameter or a field of the
+// body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// sendProblem sends an error response with the status code, the error code and the (human-readable) detail.
+func sendProblem(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext, status int, code string, detail string, fields ...FieldError) {
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+		Errors:   fields,
+	}
+	if ctx.ReqUUID != uuid.Nil {
+		problem.RequestID = ctx.ReqUUID.String()
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+// sendInternalError logs the unexpected error with the message, and sends a generic error response: details of the
+// error are in the log only.
+func sendInternalError(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext, err error, message string) {
+	ctx.Logger.WithError(err).Error(message)
+	sendProblem(w, r, ctx, http.StatusInternalServerError, codeInternal, "internal error, see the logs with the request ID")
+}
+
+// sendInvalidParameter sends a 400 error for the invalid parameter (e.g., a path parameter that is not an ID).
+func sendInvalidParameter(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext, name string, message string) {
+	sendProblem(w, r, ctx, http.StatusBadRequest, codeInvalidParameter, "invalid parameter "+name,
+		FieldError{Field: name, Message: message})
+}
+
+// pathIDs parses the path parameters with the given names as IDs. If one of them is not valid, a 400 error is sent to
+// the client and false is returned.
+func pathIDs(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, names ...string) ([]uint64, bool) {
+	ids := make([]uint64, len(names))
+	for i, name := range names {
+		id, err := strconv.ParseUint(ps.ByName(name), 10, 64)
+		if err != nil {
+			sendInvalidParameter(w, r, ctx, name, "must be a positive integer")
+			return nil, false
+		}
+		ids[i] = id
+	}
+	return ids, true
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// doProblem sends an authenticated request with the JSON body (if not empty), and returns the status code and the
+// problem details sent by the API.
+func doProblem(t *testing.T, srv *httptest.Server, s Session, method string, path string, body string) (int, Problem) {
+	t.Helper()
+	var contentType string
+	if body != "" {
+		contentType = "application/json"
+	}
+	res := send(t, srv, s, method, path, contentType, strings.NewReader(body))
+	defer res.Body.Close()
+
+	var p Problem
+	if ct := res.Header.Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("%s %s: got status %d and content type %q", method, path, res.StatusCode, ct)
+	} else if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+		t.Fatalf("%s %s: decoding the problem: %v", method, path, err)
+	}
+	return res.StatusCode, p
+}
+
+func TestProblem(t *testing.T) {
+	srv := newTestServer(t)
+	alice := login(t, srv, "alice")
+	bob := login(t, srv, "bob")
+
+	status, p := doProblem(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d/photos/abc/comments", alice.ID), "")
+	if status != http.StatusBadRequest || p.Status != status || p.Code != codeInvalidParameter || p.Type != "about:blank" {
+		t.Errorf("bad photo ID: got status %d and %+v", status, p)
+	} else if p.RequestID == "" || p.Instance != fmt.Sprintf("/users/%d/photos/abc/comments", alice.ID) {
+		t.Errorf("bad photo ID: got request ID %q and instance %q", p.RequestID, p.Instance)
+	} else if len(p.Errors) != 1 || p.Errors[0].Field != "photoId" {
+		t.Errorf("bad photo ID: got errors %+v", p.Errors)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+		field  string
+	}{
+		{"missing user", http.MethodGet, "/users/1000", "", http.StatusNotFound, codeNotFound, ""},
+		{"missing photo", http.MethodGet, fmt.Sprintf("/users/%d/photos/1000/image", alice.ID), "", http.StatusNotFound, codeNotFound, ""},
+		{"bad limit", http.MethodGet, fmt.Sprintf("/users/%d/followers?limit=0", alice.ID), "", http.StatusBadRequest, codeInvalidParameter, "limit"},
+		{"username taken", http.MethodPut, fmt.Sprintf("/users/%d/username", alice.ID), `{"username":"bob"}`, http.StatusConflict, codeConflict, "username"},
+		{"invalid username", http.MethodPut, fmt.Sprintf("/users/%d/username", alice.ID), `{"username":"a"}`, http.StatusBadRequest, codeValidationFailed, "username"},
+		{"invalid body", http.MethodPut, fmt.Sprintf("/users/%d/username", alice.ID), `{`, http.StatusBadRequest, codeInvalidBody, ""},
+		{"other user", http.MethodPut, fmt.Sprintf("/users/%d/username", bob.ID), `{"username":"bob2"}`, http.StatusForbidden, codeForbidden, ""},
+		{"follow missing user", http.MethodPut, fmt.Sprintf("/users/%d/following/1000", alice.ID), "", http.StatusNotFound, codeNotFound, ""},
+		{"ban itself", http.MethodPut, fmt.Sprintf("/users/%d/bans/%d", alice.ID, alice.ID), "", http.StatusBadRequest, codeInvalidParameter, "userBanId"},
+	}
+	for _, tt := range tests {
+		status, p := doProblem(t, srv, alice, tt.method, tt.path, tt.body)
+		if status != tt.status || p.Code != tt.code {
+			t.Errorf("%s: got status %d and code %q, want %d and %q", tt.name, status, p.Code, tt.status, tt.code)
+		} else if tt.field != "" && (len(p.Errors) != 1 || p.Errors[0].Field != tt.field) {
+			t.Errorf("%s: got errors %+v, want an error for %q", tt.name, p.Errors, tt.field)
+		}
+	}
+
+	followPath := fmt.Sprintf("/users/%d/following/%d", alice.ID, bob.ID)
+	if status := doRequest(t, srv, alice, http.MethodPut, followPath, "", nil); status != http.StatusNoContent {
+		t.Fatalf("follow: got status %d", status)
+	}
+	if status, p := doProblem(t, srv, alice, http.MethodPut, followPath, ""); status != http.StatusConflict || p.Code != codeConflict {
+		t.Errorf("follow twice: got status %d and code %q", status, p.Code)
+	}
+
+	if status, p := doProblem(t, srv, Session{}, http.MethodGet, fmt.Sprintf("/users/%d", alice.ID), ""); status != http.StatusUnauthorized || p.Code != codeUnauthenticated {
+		t.Errorf("no token: got status %d and code %q", status, p.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/storage"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// readinessTimeout is the maximum duration of all readiness checks
+const readinessTimeout = 3 * time.Second
+
+// readinessKey is the key of the blob saved in the images storage by the readiness probe
+const readinessKey = ".readiness"
+
+// storageCheckTTL is how long the result of the images storage check is reused by the readiness probe: the check
+// writes a blob, which costs a request to object storages (S3)
+const storageCheckTTL = 30 * time.Second
+
+// ReadinessCheck is the result of a single readiness check. The probe is public: the reason of a failure is logged, not
+// sent to the client, as it may contain addresses, bucket names or paths.
+type ReadinessCheck struct {
+	Status string `json:"status"` // "ok" or "fail"
+}
+
+// ReadinessResponse is the response of the readiness probe
+type ReadinessResponse struct {
+	Status string                    `json:"status"` // "ok" if all checks succeeded, "fail" otherwise
+	Checks map[string]ReadinessCheck `json:"checks"`
+}
+
+// readiness is an HTTP handler that checks whether the API server can serve requests: the database is reachable and its
+// schema is up to date, and the images storage is writable (and, for a local folder, has enough free space). It replies
+// with HTTP Status 200 if all checks succeed, and with HTTP Status 503 otherwise; the body contains the status of each
+// check. The storage check is cached for storageCheckTTL.
+func (rt *_router) readiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	errs := map[string]error{
+		"database":   rt.db.Ping(ctx),
+		"migrations": rt.db.CheckSchema(ctx),
+		"images":     rt.storageCheck.run(ctx, rt.checkImageStorage),
+	}
+
+	var response = ReadinessResponse{Status: "ok", Checks: map[string]ReadinessCheck{}}
+	status := http.StatusOK
+	for name, err := range errs {
+		if err != nil {
+			rt.baseLogger.WithError(err).WithField("check", name).Warn("readiness: check failed")
+			response.Checks[name] = ReadinessCheck{Status: "fail"}
+			response.Status = "fail"
+			status = http.StatusServiceUnavailable
+		} else {
+			response.Checks[name] = ReadinessCheck{Status: "ok"}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// cachedCheck runs a readiness check at most once every storageCheckTTL, reusing the last result in between.
+type cachedCheck struct {
+	mu  sync.Mutex
+	at  time.Time
+	err error
+}
+
+// run returns the last result of the check if it's recent enough, otherwise it runs the check.
+func (c *cachedCheck) run(ctx context.Context, check func(context.Context) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.at.IsZero() && time.Since(c.at) < storageCheckTTL {
+		return c.err
+	}
+	c.err = check(ctx)
+	c.at = time.Now()
+	return c.err
+}
+
+// checkImageStorage checks that a blob can be saved in the images storage and, if it's a local folder, that the free
+// space in it is at least rt.minFreeSpace.
+func (rt *_router) checkImageStorage(ctx context.Context) error {
+	if err := rt.images.Put(ctx, readinessKey, nil, "application/octet-stream"); err != nil {
+		return fmt.Errorf("images storage not writable: %w", err)
+	}
+	_ = rt.images.Delete(ctx, readinessKey)
+
+	local, ok := rt.images.(*storage.Local)
+	if !ok {
+		return nil
+	}
+	free, err := local.FreeSpace()
+	if errors.Is(err, storage.ErrFreeSpaceUnsupported) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading free space: %w", err)
+	} else if free < rt.minFreeSpace {
+		return fmt.Errorf("not enough free space: %d bytes, at least %d required", free, rt.minFreeSpace)
+	}
+	return nil
+}
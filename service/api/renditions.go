@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+)
+
+// renditionSize is a resized version generated for every uploaded image, served with the `size` query parameter of
+// the image endpoint.
+type renditionSize struct {
+	Name string
+
+	// Max is the maximum width and height of the rendition, in pixels
+	Max int
+
+	// Square is true if the rendition is the center square of the image (e.g., thumbnails)
+	Square bool
+}
+
+// renditionSizes are the renditions of the images. Sizes larger than the original image are not generated: the original
+// is served instead.
+var renditionSizes = []renditionSize{
+	{Name: "thumb", Max: 150, Square: true},
+	{Name: "medium", Max: 640},
+	{Name: "large", Max: 1080},
+}
+
+// findRenditionSize returns the rendition size with the name.
+func findRenditionSize(name string) (renditionSize, bool) {
+	for _, size := range renditionSizes {
+		if size.Name == name {
+			return size, true
+		}
+	}
+	return renditionSize{}, false
+}
+
+// saveRenditions generates the renditions of the image, and saves them in the storage with keys named after the original
+// image: prefix is the key of the original without the extension. If there is an error, the renditions already saved
+// are removed.
+func (rt *_router) saveRenditions(ctx context.Context, img image.Image, prefix string) ([]database.Rendition, error) {
+	renditions := make([]database.Rendition, 0, len(renditionSizes))
+	for _, size := range renditionSizes {
+		resized := makeRendition(img, size)
+		if resized == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		format, err := encodeRendition(&buf, resized)
+		if err == nil {
+			path := prefix + "_" + size.Name + format.Ext
+			err = rt.images.Put(ctx, path, buf.Bytes(), format.ContentType)
+			renditions = append(renditions, database.Rendition{
+				Size:   size.Name,
+				Path:   path,
+				Width:  resized.Bounds().Dx(),
+				Height: resized.Bounds().Dy(),
+			})
+		}
+		if err != nil {
+			rt.removeRenditions(ctx, renditions)
+			return nil, err
+		}
+	}
+	return renditions, nil
+}
+
+// removeRenditions removes the renditions from the storage, ignoring errors.
+func (rt *_router) removeRenditions(ctx context.Context, renditions []database.Rendition) {
+	for _, r := range renditions {
+		_ = rt.images.Delete(ctx, r.Path)
+	}
+}
+
+// makeRendition returns the image resized for the rendition size, or nil if the original image can be served as is.
+func makeRendition(img image.Image, size renditionSize) *image.RGBA {
+	src := img.Bounds()
+	if size.Square && src.Dx() != src.Dy() {
+		side := src.Dx()
+		if src.Dy() < side {
+			side = src.Dy()
+		}
+		x0 := src.Min.X + (src.Dx()-side)/2
+		y0 := src.Min.Y + (src.Dy()-side)/2
+		src = image.Rect(x0, y0, x0+side, y0+side)
+	} else if src.Dx() <= size.Max && src.Dy() <= size.Max {
+		return nil
+	}
+
+	// Scale to fit in Max x Max, keeping the aspect ratio. Images are never enlarged
+	width, height := src.Dx(), src.Dy()
+	if width > size.Max || height > size.Max {
+		if width >= height {
+			width, height = size.Max, maxInt(1, height*size.Max/width)
+		} else {
+			width, height = maxInt(1, width*size.Max/height), size.Max
+		}
+	}
+	return resize(img, src, width, height)
+}
+
+// resize scales the rectangle r of the image to width x height pixels. Each pixel is the average of the source pixels
+// it covers (a box filter), which gives good results when shrinking images.
+func resize(img image.Image, r image.Rectangle, width int, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sw, sh := r.Dx(), r.Dy()
+
+	// Source rows are converted to RGBA a band at a time (the rows covered by a row of the rendition): converting the
+	// whole image at once would need too much memory for large images
+	band := image.NewRGBA(image.Rect(0, 0, sw, (sh+height-1)/height+1))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, maxInt((y+1)*sh/height, y*sh/height+1)
+		draw.Draw(band, image.Rect(0, 0, sw, y1-y0), img, image.Pt(r.Min.X, r.Min.Y+y0), draw.Src)
+
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, maxInt((x+1)*sw/width, x*sw/width+1)
+			var sum [4]uint64
+			for by := 0; by < y1-y0; by++ {
+				row := band.Pix[by*band.Stride+x0*4 : by*band.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += uint64(row[i])
+					sum[1] += uint64(row[i+1])
+					sum[2] += uint64(row[i+2])
+					sum[3] += uint64(row[i+3])
+				}
+			}
+			n := uint64((x1 - x0) * (y1 - y0))
+			o := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[o+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// encodeRendition writes the rendition as JPEG, or as PNG if it has transparent pixels, and returns the format used.
+func encodeRendition(w io.Writer, img *image.RGBA) (imageFormat, error) {
+	if img.Opaque() {
+		return formatJPEG, jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+	return formatPNG, png.Encode(w, img)
+}
+
+// maxInt returns the larger of a and b.
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
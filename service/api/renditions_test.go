@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// gradientImage returns an opaque width x height image, with a horizontal gradient.
+func gradientImage(width int, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / width), G: 100, B: 200, A: 255})
+		}
+	}
+	return img
+}
+
+func TestMakeRendition(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		size   string
+		want   image.Point // zero if the original is served
+	}{
+		{"landscape thumb", 1200, 800, "thumb", image.Pt(150, 150)},
+		{"landscape medium", 1200, 800, "medium", image.Pt(640, 426)},
+		{"landscape large", 1200, 800, "large", image.Pt(1080, 720)},
+		{"portrait medium", 300, 900, "medium", image.Pt(213, 640)},
+		{"small thumb", 100, 60, "thumb", image.Pt(60, 60)},
+		{"small square thumb", 100, 100, "thumb", image.Point{}},
+		{"small large", 1000, 700, "large", image.Point{}},
+	}
+	for _, tt := range tests {
+		size, _ := findRenditionSize(tt.size)
+		got := makeRendition(gradientImage(tt.width, tt.height), size)
+		if tt.want == (image.Point{}) {
+			if got != nil {
+				t.Errorf("%s: got a %v rendition, want none", tt.name, got.Bounds().Size())
+			}
+		} else if got == nil || got.Bounds().Size() != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	// Each pixel of the result is the average of a 2x2 block: black and white columns give gray
+	src := image.NewRGBA(image.Rect(10, 10, 14, 12))
+	for x := 10; x < 14; x += 2 {
+		src.Set(x, 10, color.White)
+		src.Set(x, 11, color.White)
+		src.Set(x+1, 10, color.Black)
+		src.Set(x+1, 11, color.Black)
+	}
+	got := resize(src, src.Bounds(), 2, 1)
+	for x := 0; x < 2; x++ {
+		if c := got.RGBAAt(x, 0); c != (color.RGBA{R: 127, G: 127, B: 127, A: 255}) {
+			t.Errorf("pixel %d: got %v, want gray", x, c)
+		}
+	}
+}
+
+func TestPhotoRenditions(t *testing.T) {
+	dir := t.TempDir()
+	srv := newTestServerWith(t, Config{ImagesFolder: dir})
+	alice := login(t, srv, "alice")
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, gradientImage(1200, 800)); err != nil {
+		t.Fatal(err)
+	}
+	res := uploadFile(t, srv, alice, "photo.png", img.Bytes())
+	var photo Photo
+	_ = json.NewDecoder(res.Body).Decode(&photo)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("upload: got status %d", res.StatusCode)
+	}
+
+	imagePath := fmt.Sprintf("/users/%d/photos/%d/image", alice.ID, photo.Id)
+	etags := map[string]bool{}
+	for size, want := range map[string]image.Point{"": {1200, 800}, "thumb": {150, 150}, "medium": {640, 426}, "large": {1080, 720}} {
+		res := send(t, srv, alice, http.MethodGet, imagePath+"?size="+size, "", nil)
+		cfg, format, err := image.DecodeConfig(res.Body)
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK || err != nil {
+			t.Fatalf("size %q: got status %d, %v", size, res.StatusCode, err)
+		} else if (cfg.Width != want.X || cfg.Height != want.Y) || (size != "" && format != "jpeg") {
+			t.Errorf("size %q: got a %dx%d %s image, want %v", size, cfg.Width, cfg.Height, format, want)
+		}
+		etags[res.Header.Get("ETag")] = true
+	}
+	if len(etags) != 4 {
+		t.Errorf("got ETags %v, want one for each size", etags)
+	}
+
+	if status := doRequest(t, srv, alice, http.MethodGet, imagePath+"?size=huge", "", nil); status != http.StatusBadRequest {
+		t.Errorf("unknown size: got status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// A small image has no renditions: the original is sent
+	smallId := uploadTestPhoto(t, srv, alice)
+	res = send(t, srv, alice, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d/image?size=large", alice.ID, smallId), "", nil)
+	body := new(bytes.Buffer)
+	_, _ = body.ReadFrom(res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK || !bytes.Equal(body.Bytes(), testImage(t)) {
+		t.Errorf("small image: got status %d and %d bytes", res.StatusCode, body.Len())
+	}
+
+	// Deleting the photos removes the files of the renditions too
+	if files, _ := os.ReadDir(filepath.Join(dir, fmt.Sprint(alice.ID))); len(files) != 5 {
+		t.Errorf("got %d files, want 2 originals and 3 renditions", len(files))
+	}
+	if status := doRequest(t, srv, alice, http.MethodDelete, fmt.Sprintf("/users/%d/photos/%d", alice.ID, photo.Id), "", nil); status != http.StatusOK {
+		t.Fatalf("delete: got status %d", status)
+	}
+	if status := doRequest(t, srv, alice, http.MethodDelete, fmt.Sprintf("/users/%d/photos/%d", alice.ID, smallId), "", nil); status != http.StatusOK {
+		t.Fatalf("delete: got status %d", status)
+	}
+	if files, err := os.ReadDir(filepath.Join(dir, fmt.Sprint(alice.ID))); err != nil || len(files) != 0 {
+		t.Errorf("after delete: got %d files, %v", len(files), err)
+	}
+}
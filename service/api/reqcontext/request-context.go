@@ -7,6 +7,8 @@ Each value here should be assumed valid only per request only, with some excepti
 package reqcontext
 
 import (
+	"sapienza/azzurra/wasaphoto/service/database"
+
 	"github.com/gofrs/uuid"
 	"github.com/sirupsen/logrus"
 )
@@ -18,4 +20,8 @@ type RequestContext struct {
 
 	// Logger is a custom field logger for the request
 	Logger logrus.FieldLogger
+
+	// User is the user authenticated by the bearer token of the request. It's nil for routes that don't require
+	// authentication.
+	User *database.User
 }
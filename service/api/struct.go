@@ -1,13 +1,20 @@
 package api
 
 import (
+	"fmt"
 	"regexp"
 	"sapienza/azzurra/wasaphoto/service/database"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 var usernameRx = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
 
+// usernameRule describes the valid usernames (see User.IsValid), for error messages
+const usernameRule = "must be 3 to 16 characters long, with letters, digits, _ or - only"
+
 func (u *User) IsValid() bool {
 	return len(u.Username) >= 3 && len(u.Username) <= 16 && usernameRx.MatchString(u.Username)
 }
@@ -17,6 +24,156 @@ type User struct {
 	Username string `json:"username"`
 }
 
+// maxCaptionLength is the maximum length of photo captions, in characters
+const maxCaptionLength = 2200
+
+// captionRule describes the valid captions (see validCaption), for error messages
+const captionRule = "must be at most 2200 characters long, without control characters other than new lines and tabs"
+
+// maxCommentLength is the maximum length of comments, in characters
+const maxCommentLength = 1000
+
+// commentRule describes the valid comments (see validComment), for error messages
+const commentRule = "must be between 1 and 1000 characters long, without control characters other than new lines and tabs"
+
+// normalizeText returns the text (a caption or a comment) without leading and trailing spaces, and with Unix new lines
+// (browsers send CRLF in forms).
+func normalizeText(text string) string {
+	return strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+}
+
+// validCaption returns whether the (normalized) caption is valid: UTF-8 text, at most maxCaptionLength characters
+// long, without control characters other than new lines and tabs. Empty captions are valid.
+func validCaption(caption string) bool {
+	return validText(caption, maxCaptionLength)
+}
+
+// validComment returns whether the (normalized) text of a comment is valid: as for captions, but it can't be empty and
+// it's at most maxCommentLength characters long.
+func validComment(text string) bool {
+	return text != "" && validText(text, maxCommentLength)
+}
+
+// validText returns whether the text is UTF-8, at most maxLength characters long, without control characters other
+// than new lines and tabs.
+func validText(text string, maxLength int) bool {
+	if !utf8.ValidString(text) || utf8.RuneCountInString(text) > maxLength {
+		return false
+	}
+	for _, r := range text {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	// maxTagLength is the maximum length of tags, in characters: longer hashtags are ignored
+	maxTagLength = 64
+
+	// maxPhotoTags is the maximum number of tags of a photo: further hashtags in the caption are ignored
+	maxPhotoTags = 30
+)
+
+// tagRule describes the valid tags (see tagName), for error messages
+const tagRule = "must be 1 to 64 letters, digits or _, not only digits, optionally starting with #"
+
+// isTagRune returns whether the character can be part of a tag.
+func isTagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// validTag returns whether the name (without '#') is a valid tag: 1 to maxTagLength letters, digits or underscores,
+// not only digits (e.g., "#1" is not a tag).
+func validTag(name string) bool {
+	letters := false
+	for _, r := range name {
+		if !isTagRune(r) {
+			return false
+		}
+		letters = letters || !unicode.IsDigit(r)
+	}
+	return letters && utf8.RuneCountInString(name) <= maxTagLength
+}
+
+// tagName returns the name of the tag in a request (with or without '#'), in lower case. The second value is false if
+// it's not a valid tag.
+func tagName(s string) (string, bool) {
+	name := strings.ToLower(strings.TrimPrefix(s, "#"))
+	return name, validTag(name)
+}
+
+// parseHashtags returns the tags in the text (e.g., a caption), in lower case, without '#' and without duplicates, in
+// order of appearance. A hashtag starts with '#', at the beginning of the text or after a character that can't be part
+// of a tag (so that "a#b" and "&#39;" are not hashtags).
+func parseHashtags(text string) []string {
+	tags := make([]string, 0)
+	runes := []rune(text)
+	for i := 0; i < len(runes) && len(tags) < maxPhotoTags; i++ {
+		if runes[i] != '#' || (i > 0 && isTagRune(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isTagRune(runes[end]) {
+			end++
+		}
+		name := strings.ToLower(string(runes[i+1 : end]))
+		i = end - 1
+		if !validTag(name) {
+			continue
+		}
+		duplicate := false
+		for _, t := range tags {
+			duplicate = duplicate || t == name
+		}
+		if !duplicate {
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+// maxMentions is the maximum number of mentions in a text: further mentions are ignored (and not notified)
+const maxMentions = 20
+
+// isUsernameRune returns whether the character can be part of a username (see User.IsValid).
+func isUsernameRune(r rune) bool {
+	return r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// parseMentions returns the mentions (`@username`) in the text, with the username only. As with hashtags, a mention
+// starts with '@' at the beginning of the text or after a character that can't be part of a username (so that e-mail
+// addresses are not mentions). Offsets and lengths are in characters, as in database.Mention.
+func parseMentions(text string) []database.Mention {
+	mentions := make([]database.Mention, 0)
+	runes := []rune(text)
+	for i := 0; i < len(runes) && len(mentions) < maxMentions; i++ {
+		if runes[i] != '@' || (i > 0 && isUsernameRune(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isUsernameRune(runes[end]) {
+			end++
+		}
+		user := User{Username: string(runes[i+1 : end])}
+		if user.IsValid() {
+			mentions = append(mentions, database.Mention{User: user.ToDatabase(), Offset: i, Length: end - i})
+		}
+		i = end - 1
+	}
+	return mentions
+}
+
+// entitiesFromDatabase returns the entities of the mentions in a text.
+func entitiesFromDatabase(mentions []database.Mention) []Entity {
+	entities := make([]Entity, 0, len(mentions))
+	for _, m := range mentions {
+		entities = append(entities, Entity{Type: entityMention, Offset: m.Offset, Length: m.Length, UserId: m.User.ID})
+	}
+	return entities
+}
+
 func (u *User) ToDatabase() database.User {
 	return database.User{
 		ID:       u.ID,
@@ -26,6 +183,7 @@ func (u *User) ToDatabase() database.User {
 
 func (u *User) FromDatabase(user database.User) {
 	u.ID = user.ID
+	u.Username = user.Username
 }
 
 func (p *Photo) ToDatabase() database.Photo {
@@ -35,7 +193,6 @@ func (p *Photo) ToDatabase() database.Photo {
 		UUID:     p.UUID,
 		Datetime: p.Datetime,
 		Likes:    p.Likes,
-		PhotoUrl: p.PhotoUrl,
 		UserId:   p.UserId,
 	}
 }
@@ -46,18 +203,89 @@ func (p *Photo) FromDatabase(d database.Photo) {
 	p.UUID = d.UUID
 	p.Datetime = d.Datetime
 	p.Likes = d.Likes
-	p.PhotoUrl = d.PhotoUrl
+	p.PhotoUrl = photoImageURL(d.UserId, d.Id)
 	p.UserId = d.UserId
+	p.Caption = d.Caption
+	if !d.EditedAt.IsZero() {
+		editedAt := d.EditedAt
+		p.EditedAt = &editedAt
+	}
+	if !d.TakenAt.IsZero() {
+		takenAt := d.TakenAt
+		p.TakenAt = &takenAt
+	}
+	p.Width = d.Width
+	p.Height = d.Height
+	if d.Author.ID != 0 {
+		p.Author = &User{}
+		p.Author.FromDatabase(d.Author)
+	}
+	p.CommentsCount = d.CommentsCount
+	p.LikedByMe = d.LikedByMe
+	if d.Mentions != nil {
+		p.CaptionEntities = entitiesFromDatabase(d.Mentions)
+	}
+	if d.Comments != nil {
+		p.Comments = make([]CommentResponse, 0, len(d.Comments))
+		for _, c := range d.Comments {
+			var cr CommentResponse
+			cr.FromDatabase(c)
+			p.Comments = append(p.Comments, cr)
+		}
+	}
 
 }
 
+// photoImageURL returns the API path serving the image of the photo (see getPhotoImage)
+func photoImageURL(userId uint64, photoId uint64) string {
+	return fmt.Sprintf("/users/%d/photos/%d/image", userId, photoId)
+}
+
+func (c *CommentResponse) FromDatabase(d database.Comment) {
+	c.Id = d.Id
+	if d.User != nil {
+		c.From = &User{}
+		c.From.FromDatabase(*d.User)
+	}
+	c.Comment = d.Comment
+	c.Datetime = d.Datetime
+	c.Entities = entitiesFromDatabase(d.Mentions)
+}
+
 func (c *CommentRequest) ToDatabase() database.Comment {
 
 	return database.Comment{
-		Comment: c.Text,
+		Comment:  c.Text,
+		Mentions: parseMentions(c.Text),
 	}
 }
 
+// Session is returned by the login, the token must be sent as "Authorization: Bearer <token>" in other requests
+type Session struct {
+	ID       uint64 `json:"id"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+// UserEntry is a user in a list, with the follow state of the logged in user
+type UserEntry struct {
+	ID           uint64 `json:"id"`
+	Username     string `json:"username"`
+	FollowedByMe bool   `json:"followed_by_me"`
+}
+
+func (u *UserEntry) FromDatabase(d database.UserEntry) {
+	u.ID = d.User.ID
+	u.Username = d.User.Username
+	u.FollowedByMe = d.FollowedByMe
+}
+
+type Users struct {
+	Users []UserEntry `json:"users"`
+	// NextCursor is the cursor of the next page, empty if this is the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
 type Profile struct {
 	User      *User   `json:"user"`
 	Photos    []Photo `json:"photos"`
@@ -73,6 +301,30 @@ type Photo struct {
 	UserId   uint64    `json:"userid"`
 	Likes    uint64    `json:"likes"`
 	PhotoUrl string    `json:"photourl"`
+
+	// Caption is the text of the photo (empty if missing), EditedAt when it was last edited (missing if never)
+	Caption  string     `json:"caption"`
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+
+	// CaptionEntities are the mentions in the caption, sent with the comments
+	CaptionEntities []Entity `json:"caption_entities,omitempty"`
+
+	// TakenAt is when the photo was taken, if known from the metadata of the image. Width and Height are the dimensions
+	// of the image, missing if unknown
+	TakenAt *time.Time `json:"taken_at,omitempty"`
+	Width   int        `json:"width,omitempty"`
+	Height  int        `json:"height,omitempty"`
+
+	// Author, comments and the like state of the viewer are sent only when listing photos (e.g., stream and profile)
+	Author        *User             `json:"author,omitempty"`
+	CommentsCount uint64            `json:"comments_count"`
+	LikedByMe     bool              `json:"liked_by_me"`
+	Comments      []CommentResponse `json:"comments,omitempty"`
+}
+
+// PhotoUpdate is the body of the request editing a photo: missing fields are not changed
+type PhotoUpdate struct {
+	Caption *string `json:"caption"`
 }
 
 type CommentResponse struct {
@@ -80,6 +332,133 @@ type CommentResponse struct {
 	From     *User     `json:"from"`
 	Comment  string    `json:"comment"`
 	Datetime time.Time `json:"datetime"`
+	Entities []Entity  `json:"entities"`
+}
+
+// entityMention is the type of the entities of mentioned users
+const entityMention = "mention"
+
+// Entity is a part of a text referring to something else: currently, only users mentioned with `@username`. Offset
+// and Length are in characters (Unicode code points), and include the '@'.
+type Entity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	UserId uint64 `json:"user_id"`
+}
+
+type Comments struct {
+	Comments []CommentResponse `json:"comments"`
+	// NextCursor is the cursor of the next page, empty if this is the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Liker is a user who liked a photo
+type Liker struct {
+	ID       uint64    `json:"id"`
+	Username string    `json:"username"`
+	LikedAt  time.Time `json:"liked_at"`
+}
+
+type Likes struct {
+	Likes []Liker `json:"likes"`
+	// NextCursor is the cursor of the next page, empty if this is the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type LikedPhoto struct {
+	Photo
+	LikedAt time.Time `json:"liked_at"`
+}
+
+type LikedPhotos struct {
+	Photos []LikedPhoto `json:"photos"`
+	// NextCursor is the cursor of the next page, empty if this is the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Tag is a tag found by the search, with the number of photos having it
+type Tag struct {
+	Name   string `json:"name"`
+	Photos uint64 `json:"photos"`
+}
+
+type Tags struct {
+	Tags []Tag `json:"tags"`
+}
+
+// Notification is a group of notifications of the logged in user (see database.AppDatabase.ListNotifications): the
+// fields are those of the most recent one, and Others is the number of other users in the group
+type Notification struct {
+	Id        uint64             `json:"id"`
+	Type      string             `json:"type"`
+	Actor     User               `json:"actor"`
+	Others    uint64             `json:"others"`
+	Photo     *NotificationPhoto `json:"photo,omitempty"`
+	CommentId uint64             `json:"comment_id,omitempty"`
+	Text      string             `json:"text"`
+	Datetime  time.Time          `json:"datetime"`
+	Read      bool               `json:"read"`
+}
+
+// NotificationPhoto is the photo of a notification
+type NotificationPhoto struct {
+	Id       uint64 `json:"id"`
+	UserId   uint64 `json:"userid"`
+	PhotoUrl string `json:"photourl"`
+}
+
+func (n *Notification) FromDatabase(d database.Notification) {
+	n.Id = d.Id
+	n.Type = d.Kind
+	n.Actor.FromDatabase(d.Actor)
+	n.Others = d.Others
+	if d.PhotoId != 0 {
+		n.Photo = &NotificationPhoto{Id: d.PhotoId, UserId: d.PhotoOwnerId, PhotoUrl: photoImageURL(d.PhotoOwnerId, d.PhotoId)}
+	}
+	n.CommentId = d.CommentId
+	n.Datetime = d.Datetime
+	n.Read = d.Read
+	n.Text = notificationText(d)
+}
+
+// notificationText returns the text of the notification, e.g. "alice and 12 others liked your photo".
+func notificationText(d database.Notification) string {
+	actors := d.Actor.Username
+	if d.Others == 1 {
+		actors += " and 1 other"
+	} else if d.Others > 1 {
+		actors += fmt.Sprintf(" and %d others", d.Others)
+	}
+	switch d.Kind {
+	case database.NotificationFollow:
+		return actors + " started following you"
+	case database.NotificationLike:
+		return actors + " liked your photo"
+	case database.NotificationComment:
+		return actors + " commented on your photo"
+	case database.NotificationMention:
+		if d.CommentId != 0 {
+			return actors + " mentioned you in a comment"
+		}
+		return actors + " mentioned you in a photo"
+	}
+	return actors
+}
+
+type Notifications struct {
+	Notifications []Notification `json:"notifications"`
+	// UnreadCount is the number of unread notifications (groups), in every page
+	UnreadCount int `json:"unread_count"`
+	// NextCursor is the cursor of the next page, empty if this is the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NotificationsRead is the (optional) body of the request marking the notifications as read
+type NotificationsRead struct {
+	// LastId is the ID of the last notification seen by the user: more recent ones are not marked as read. If missing,
+	// all the notifications are marked as read
+	LastId uint64 `json:"last_id"`
 }
 
 type CommentRequest struct {
@@ -88,9 +467,6 @@ type CommentRequest struct {
 
 type Stream struct {
 	Photos []Photo `json:"photos"`
-}
-
-type ApiResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	// NextCursor is the cursor of the next page, empty if this is the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
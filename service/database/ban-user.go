@@ -1,21 +1,45 @@
 package database
 
-func (db *appdbimpl) BanUser(userId uint64, bannedUser uint64) error {
+import "context"
 
-	_, err := db.c.Exec(`INSERT INTO bans (userId,bannedUser) VALUES (?, ?)`,
-		userId, bannedUser)
-	if err != nil {
-		return err
-	}
+func (db *appdbimpl) BanUser(ctx context.Context, userId uint64, bannedUser uint64) error {
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		_, err := tx.c.ExecContext(ctx, `INSERT INTO bans (userId,bannedUser) VALUES (?, ?)`,
+			userId, bannedUser)
+		if tx.dialect.isUniqueViolation(err) {
+			return ErrBanExists
+		} else if tx.dialect.isForeignKeyViolation(err) {
+			return ErrUserNotExists
+		} else if err != nil {
+			return err
+		}
+		return tx.updateBannedLikes(ctx, userId, bannedUser)
+	})
+}
+
+func (db *appdbimpl) DeleteBan(ctx context.Context, userId uint64, bannedUser uint64) error {
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		res, err := tx.c.ExecContext(ctx, `DELETE FROM bans WHERE userId=? AND bannedUser=?`, userId, bannedUser)
+		if err != nil {
+			return err
+		} else if err := checkDeleted(res, ErrBanNotExists); err != nil {
+			return err
+		}
+		return tx.updateBannedLikes(ctx, userId, bannedUser)
+	})
+}
 
-	return nil
+// updateBannedLikes refreshes the likes counters of the photos of the user liked by the (un)banned user.
+func (db *appdbimpl) updateBannedLikes(ctx context.Context, userId uint64, bannedUser uint64) error {
+	return db.updateLikesCounts(ctx, `userId=? AND id IN (SELECT photoId FROM likes WHERE userId=?)`, userId, bannedUser)
 }
 
-func (db *appdbimpl) DeleteBan(userId uint64, bannedUser uint64) error {
-	_, err := db.c.Exec(`DELETE FROM bans WHERE userId=? AND bannedUser=?`, userId, bannedUser)
+func (db *appdbimpl) IsBanned(ctx context.Context, userId uint64, bannedUser uint64) (bool, error) {
+	var cnt int
+	err := db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM bans WHERE userId=? AND bannedUser=?`, userId, bannedUser).Scan(&cnt)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return cnt > 0, nil
 }
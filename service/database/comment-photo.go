@@ -1,30 +1,54 @@
 package database
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
-func (db *appdbimpl) CommentPhoto(userId uint64, photoId uint64, c Comment) (*Comment, error) {
+func (db *appdbimpl) CommentPhoto(ctx context.Context, userId uint64, photoId uint64, c Comment) (*Comment, error) {
 
 	var username string
-	var date = time.Now()
-	errU := db.c.QueryRow(`SELECT username FROM users WHERE id=?`, userId).Scan(&username)
+	var date = time.Now().UTC()
+	errU := db.c.QueryRowContext(ctx, `SELECT username FROM users WHERE id=?`, userId).Scan(&username)
 	if errU != nil {
 		return nil, ErrUserNotExists
 	}
 
-	res, err := db.c.Exec(`INSERT INTO comments (id,userId,photoId,date,comment) VALUES (NULL, ?,?,?,?)`,
-		userId, photoId, date, c.Comment)
-	if err != nil {
-		return &c, err
-	}
+	var mentions []Mention
+	err := db.withTx(ctx, func(tx *appdbimpl) error {
+		err := tx.c.QueryRowContext(ctx, `INSERT INTO comments (userId,photoId,date,comment) VALUES (?,?,?,?) RETURNING id`,
+			userId, photoId, date, c.Comment).Scan(&c.Id)
+		if err != nil {
+			return err
+		}
+		mentions, err = tx.saveMentions(ctx, photoId, c.Id, c.Mentions)
+		if err != nil {
+			return err
+		}
 
-	lastInsertID, err := res.LastInsertId()
+		// The owner of the photo is notified of the comment, and not of the mentions in it
+		var ownerId uint64
+		if err := tx.c.QueryRowContext(ctx, `SELECT userId FROM photos WHERE id = ?`, photoId).Scan(&ownerId); err != nil {
+			return err
+		}
+		err = tx.notify(ctx, ownerId, Notification{
+			Kind:      NotificationComment,
+			Actor:     User{ID: userId},
+			PhotoId:   photoId,
+			CommentId: c.Id,
+			Datetime:  date,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.notifyMentions(ctx, userId, photoId, c.Id, mentions, map[uint64]bool{ownerId: true}, date)
+	})
 	if err != nil {
 		return &c, err
 	}
 
-	c.Id = uint64(lastInsertID)
-
 	u := User{
+		ID:       userId,
 		Username: username,
 	}
 	return &Comment{
@@ -32,14 +56,65 @@ func (db *appdbimpl) CommentPhoto(userId uint64, photoId uint64, c Comment) (*Co
 		User:     &u,
 		Datetime: date,
 		Comment:  c.Comment,
+		Mentions: mentions,
 	}, nil
 }
 
-func (db *appdbimpl) DeleteComment(commentId uint64, userId uint64, photoId uint64) error {
-	_, err := db.c.Exec(`DELETE FROM comments WHERE id=? AND userId=? AND photoId=?`, commentId, userId, photoId)
+func (db *appdbimpl) DeleteComment(ctx context.Context, commentId uint64, userId uint64, photoId uint64) error {
+	// Mentions and notifications are removed together with the comment (before it, as they reference it)
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		for _, query := range []string{
+			`DELETE FROM notifications WHERE commentId IN (SELECT id FROM comments WHERE id=? AND userId=? AND photoId=?)`,
+			`DELETE FROM mentions WHERE commentId IN (SELECT id FROM comments WHERE id=? AND userId=? AND photoId=?)`,
+		} {
+			if _, err := tx.c.ExecContext(ctx, query, commentId, userId, photoId); err != nil {
+				return err
+			}
+		}
+		res, err := tx.c.ExecContext(ctx, `DELETE FROM comments WHERE id=? AND userId=? AND photoId=?`, commentId, userId, photoId)
+		if err != nil {
+			return err
+		}
+		return checkDeleted(res, ErrCommentNotExists)
+	})
+}
+
+func (db *appdbimpl) ListComments(ctx context.Context, photoId uint64, page Page) ([]Comment, error) {
+	// Comments written by users banned by the owner of the photo are hidden
+	query := `SELECT c.id, c.userId, u.username, c.date, c.comment FROM comments c
+		INNER JOIN users u ON u.id = c.userId
+		INNER JOIN photos p ON p.id = c.photoId
+		WHERE c.photoId=?
+		AND c.userId NOT IN (SELECT bannedUser FROM bans WHERE userId = p.userId)`
+	args := []interface{}{photoId}
+	if page.After != nil {
+		query += ` AND (c.date > ? OR (c.date = ? AND c.id > ?))`
+		args = append(args, page.After.Time, page.After.Time, page.After.ID)
+	}
+	query += ` ORDER BY c.date, c.id LIMIT ?`
+	args = append(args, page.Limit)
+
+	rows, err := db.c.QueryContext(ctx, query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	comments := make([]Comment, 0)
+	for rows.Next() {
+		var c Comment
+		var u User
+		err := rows.Scan(&c.Id, &u.ID, &u.Username, &c.Datetime, &c.Comment)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		c.User = &u
+		comments = append(comments, c)
+	}
+	// As in GetPhotoDetails, the rows are closed before loading the mentions
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, db.attachCommentMentions(ctx, photoId, comments)
 }
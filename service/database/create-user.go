@@ -1,28 +1,13 @@
 package database
 
-func (db *appdbimpl) CreateUser(u User) (User, error) {
+import "context"
 
-	var cnt int
-	err := db.c.QueryRow(`SELECT COUNT(*) FROM users WHERE username=?`, u.Username).Scan(&cnt)
-	if err != nil {
-		return u, err
-	}
-
-	if cnt > 0 {
+func (db *appdbimpl) CreateUser(ctx context.Context, u User) (User, error) {
+	// The unique index on the username rejects existing users: a check before the insert would still let two users
+	// register the same username at once (both checks can run before the inserts)
+	err := db.c.QueryRowContext(ctx, `INSERT INTO users (username) VALUES (?) RETURNING id`, u.Username).Scan(&u.ID)
+	if db.dialect.isUniqueViolation(err) {
 		return u, ErrUserExists
 	}
-
-	res, err := db.c.Exec(`INSERT INTO users (id,username) VALUES (NULL, ?)`,
-		u.Username)
-	if err != nil {
-		return u, err
-	}
-
-	lastInsertID, err := res.LastInsertId()
-	if err != nil {
-		return u, err
-	}
-
-	u.ID = uint64(lastInsertID)
-	return u, nil
+	return u, err
 }
@@ -3,7 +3,14 @@ Package database is the middleware between the app database and the code. All da
 persistent database are handled here. Database specific logic should never escape this package.
 
 To use this package you need to apply migrations to the database if needed/wanted, connect to it (using the database
-data source name from config), and then initialize an instance of AppDatabase from the DB connection.
+data source name from config), and then initialize an instance of AppDatabase from the DB connection. Migrations are
+SQL files embedded in the executable (see the `migrations` directory, with a subdirectory for each supported driver),
+applied in order by MigrateUp and tracked in the `schema_migrations` table. New refuses to work on a database with
+pending migrations.
+
+Two database engines are supported: SQLite (New, driver DriverSQLite) and PostgreSQL (NewPostgres, driver
+DriverPostgres). Both share the same queries and the same migration versions; the differences between the two SQL
+dialects are handled in dialect.go.
 
 For example, this code adds a parameter in `webapi` executable for the database data source name (add it to the
 main.WebAPIConfiguration structure):
@@ -25,12 +32,17 @@ This is an example on how to migrate the DB and connect to it:
 		logger.Debug("database stopping")
 		_ = db.Close()
 	}()
+	if _, err := database.MigrateUp(db, database.DriverSQLite); err != nil {
+		logger.WithError(err).Error("error migrating the database")
+		return fmt.Errorf("migrating the database: %w", err)
+	}
 
 Then you can initialize the AppDatabase and pass it to the api package.
 */
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -40,19 +52,88 @@ import (
 var ErrUserExists = errors.New("user exists")
 var ErrUserNotExists = errors.New("user not exists")
 var ErrLikesExists = errors.New("The user has already liked")
+var ErrSessionNotExists = errors.New("session not exists")
+var ErrPhotoNotExists = errors.New("photo not exists")
+var ErrFollowExists = errors.New("the user already follows the other user")
+var ErrBanExists = errors.New("the user already banned the other user")
+var ErrCommentNotExists = errors.New("comment not exists")
+var ErrLikeNotExists = errors.New("the user doesn't like the photo")
+var ErrFollowNotExists = errors.New("the user doesn't follow the other user")
+var ErrBanNotExists = errors.New("the user didn't ban the other user")
+var ErrSchemaNotUpToDate = errors.New("database schema is not up to date, migrations are pending")
 
 type User struct {
 	ID       uint64
 	Username string
 }
 
+// UserEntry is a user in a list, as seen by the user requesting the list (the viewer)
+type UserEntry struct {
+	User         User
+	FollowedByMe bool
+}
+
 type Photo struct {
 	Id       uint64
 	Datetime time.Time
 	UUID     string
-	PhotoUrl string
+	Path     string // the key of the image file in the storage (see the storage package)
 	Likes    uint64
 	UserId   uint64
+
+	// Fields read from the metadata of the image. Width and Height are 0 if unknown (photos uploaded before they were
+	// saved)
+	TakenAt     time.Time // when the photo was taken, zero if unknown
+	Orientation int       // EXIF orientation of the uploaded image (1 to 8), already applied to the stored image
+	Width       int
+	Height      int
+
+	// Caption is the text of the photo, EditedAt when it was last edited (zero if never)
+	Caption  string
+	EditedAt time.Time
+
+	// Tags are the hashtags of the caption (lower case, without '#'), saved by CreatePhoto. They are not read back.
+	Tags []string
+
+	// Mentions are the mentions in the caption. When saving the photo, only the usernames are needed: mentions of
+	// users who don't exist are dropped. They are read together with the comments (see Comments).
+	Mentions []Mention
+
+	// The following fields are filled only when listing photos (e.g., stream and profile)
+	Author        User
+	CommentsCount uint64
+	LikedByMe     bool      // whether the user requesting the photo liked it
+	Comments      []Comment // the first CommentsPreviewSize comments, oldest first
+
+	// Renditions are saved by CreatePhoto, and read with ListRenditions only
+	Renditions []Rendition
+}
+
+// Rendition is a resized version of the image of a photo (e.g., the thumbnail)
+type Rendition struct {
+	Size   string // the name of the size (e.g., "thumb")
+	Path   string // the key of the image file in the storage
+	Width  int
+	Height int
+}
+
+// Cursor is the position of an item in a list sorted by time and ID, used for keyset pagination. The next page
+// contains the items after the cursor.
+type Cursor struct {
+	Time time.Time
+	ID   uint64
+}
+
+// Page selects a page of a list: at most Limit items after the cursor (from the beginning of the list if After is nil)
+type Page struct {
+	Limit int
+	After *Cursor
+}
+
+// Tag is a hashtag, with the number of photos having it
+type Tag struct {
+	Name   string
+	Photos uint64
 }
 
 type Profile struct {
@@ -63,136 +144,266 @@ type Profile struct {
 	Following int
 }
 
+// Like is the like of User to Photo
+type Like struct {
+	User     User
+	Photo    Photo
+	Datetime time.Time
+}
+
 type Comment struct {
 	Id       uint64
 	User     *User
 	Datetime time.Time
 	Comment  string
+
+	// Mentions are the mentions in the text. As in Photo, only the usernames are needed when saving the comment.
+	Mentions []Mention
+}
+
+// Mention is a mention of User (`@username`) in a text: Offset and Length are in characters (Unicode code points),
+// and the mention includes the '@'
+type Mention struct {
+	User   User
+	Offset int
+	Length int
+}
+
+// Kinds of notifications
+const (
+	// NotificationFollow is sent to the followed user
+	NotificationFollow = "follow"
+	// NotificationLike is sent to the owner of the liked photo
+	NotificationLike = "like"
+	// NotificationComment is sent to the owner of the commented photo
+	NotificationComment = "comment"
+	// NotificationMention is sent to the users mentioned in a caption or in a comment (CommentId is 0 for captions)
+	NotificationMention = "mention"
+)
+
+// Notification is sent to a user when Actor does something concerning them (see the Notification* kinds). When
+// listed, notifications are grouped (see ListNotifications): the fields are those of the most recent notification of
+// the group.
+type Notification struct {
+	Id           uint64
+	Kind         string
+	Actor        User
+	PhotoId      uint64 // 0 if not about a photo
+	PhotoOwnerId uint64 // the owner of the photo, filled when listing
+	CommentId    uint64 // 0 if not about a comment
+	Datetime     time.Time
+
+	// Filled when listing: the number of other users in the group, and whether it was marked as read
+	Others uint64
+	Read   bool
 }
 
 // AppDatabase is the high level interface for the DB
 type AppDatabase interface {
 	// CreateUser creates a new user if he/she doesn't exist
-	CreateUser(User) (User, error)
-	// UpdateUser updates the user, replacing every value with those provided in the argument
-	UpdateUser(User) (User, error)
-	// Insert and Delete ban user with the given ID
-	BanUser(uint64, uint64) error
-	DeleteBan(uint64, uint64) error
-	// Insert and Delete follower user with the given ID
-	FollowerUser(uint64, uint64) error
-	DeleteFollowerUser(uint64, uint64) error
-	// Gets Stream
-	GetStream(uint64) ([]Photo, error)
-	GetUserProfile(uint64) (*Profile, error)
-	LikePhoto(uint64, uint64) error
-	DeleteLike(uint64, uint64) error
-	// Get Photo
-	GetPhoto(uint64, uint64) (*Photo, error)
-	// Insert Photo
-	CreatePhoto(Photo) (Photo, error)
+	CreateUser(context.Context, User) (User, error)
+	// UpdateUser updates the user, replacing every value with those provided in the argument. It returns
+	// ErrUserNotExists if the user doesn't exist, and ErrUserExists if the username is taken by another user
+	UpdateUser(context.Context, User) (User, error)
+	// GetUserByUsername returns the user with the given username, or ErrUserNotExists
+	GetUserByUsername(context.Context, string) (User, error)
+	// CreateSession stores a new session token for the given user ID, and deletes the sessions (of every user)
+	// created before the given time, which are expired
+	CreateSession(context.Context, uint64, string, time.Time) error
+	// GetSessionUser returns the user owning the session token, or ErrSessionNotExists if the token doesn't exist or
+	// the session was created before the given time (it's expired)
+	GetSessionUser(context.Context, string, time.Time) (User, error)
+	// Insert and Delete ban user with the given ID. BanUser returns ErrBanExists if the ban exists, and
+	// ErrUserNotExists if one of the users doesn't exist. DeleteBan returns ErrBanNotExists if there is no ban. Likes of
+	// banned users are not counted in the likes of the photos of the user who banned them (see ListLikes)
+	BanUser(context.Context, uint64, uint64) error
+	DeleteBan(context.Context, uint64, uint64) error
+	// IsBanned returns whether the first user banned the second one
+	IsBanned(context.Context, uint64, uint64) (bool, error)
+	// Insert and Delete follower user with the given ID, notifying the followed user (the notification is removed
+	// together with the follow). FollowerUser returns ErrFollowExists if the first user already follows the second
+	// one, and ErrUserNotExists if one of the users doesn't exist. DeleteFollowerUser returns ErrFollowNotExists if the
+	// first user doesn't follow the second one
+	FollowerUser(context.Context, uint64, uint64) error
+	DeleteFollowerUser(context.Context, uint64, uint64) error
+	// ListFollowers and ListFollowing return a page of followers/followed users of the first user, as seen by the second
+	ListFollowers(context.Context, uint64, uint64, Page) ([]UserEntry, error)
+	ListFollowing(context.Context, uint64, uint64, Page) ([]UserEntry, error)
+	// Gets a page of the stream of the user, from the most recent photo
+	GetStream(context.Context, uint64, Page) ([]Photo, error)
+	// GetUserProfile returns the profile of the first user as seen by the second one (the viewer): as in ListFollowers
+	// and ListFollowing, the follower and following counts don't include the users hidden to the viewer
+	GetUserProfile(context.Context, uint64, uint64) (*Profile, error)
+	// SearchUsers returns the users whose username starts with the (non-empty) prefix, case-insensitive, as seen by the
+	// viewer (first argument). Users who banned the viewer are excluded.
+	SearchUsers(context.Context, uint64, string, int) ([]UserEntry, error)
+	// LikePhoto and DeleteLike add and remove the like of the user to the photo. The owner of the photo is notified of
+	// the like, and the notification is removed together with the like. DeleteLike returns ErrLikeNotExists if the user
+	// doesn't like the photo
+	LikePhoto(context.Context, uint64, uint64) error
+	DeleteLike(context.Context, uint64, uint64) error
+	// ListLikes returns a page of the likes of the photo (only User is filled), most recent first
+	ListLikes(context.Context, uint64, Page) ([]Like, error)
+	// ListLikedPhotos returns a page of the photos liked by the user (only Photo is filled), most recent like first
+	ListLikedPhotos(context.Context, uint64, Page) ([]Like, error)
+	// Get Photo, returns ErrPhotoNotExists if the user has no photo with the given ID
+	GetPhoto(context.Context, uint64, uint64) (*Photo, error)
+	// GetPhotoByID returns the photo with the given ID (of any user), or ErrPhotoNotExists
+	GetPhotoByID(context.Context, uint64) (*Photo, error)
+	// GetPhotoDetails returns the photo with the given ID with its details, as in the stream, as seen by the viewer
+	// (second argument). It returns ErrPhotoNotExists if the photo doesn't exist
+	GetPhotoDetails(context.Context, uint64, uint64) (Photo, error)
+	// UpdatePhotoCaption sets the caption of the photo of the user and replaces its tags and mentions, edited at the
+	// given time. Users mentioned for the first time are notified. It returns ErrPhotoNotExists if the user has no photo
+	// with the given ID
+	UpdatePhotoCaption(context.Context, uint64, uint64, string, []string, []Mention, time.Time) error
+	// ListTagPhotos returns a page of the photos with the tag, most recent first, as seen by the viewer (first argument).
+	// As in the stream, photos of users who banned the viewer, or banned by the viewer, are excluded
+	ListTagPhotos(context.Context, uint64, string, Page) ([]Photo, error)
+	// SearchTags returns the tags starting with the prefix (possibly empty), most used first, as seen by the viewer
+	// (first argument): only the photos visible to the viewer are counted, and tags without such photos are excluded
+	SearchTags(context.Context, uint64, string, int) ([]Tag, error)
+	// Insert Photo, together with its renditions, tags and mentions (notifying the mentioned users)
+	CreatePhoto(context.Context, Photo) (Photo, error)
+	// ListRenditions returns the renditions of the photo, sorted by size name
+	ListRenditions(context.Context, uint64) ([]Rendition, error)
 	// Delete Photo
-	DeletePhoto(uint64, uint64) error
-	CommentPhoto(uint64, uint64, Comment) (*Comment, error)
-	DeleteComment(uint64, uint64, uint64) error
-	Ping() error
+	DeletePhoto(context.Context, uint64, uint64) error
+	// CommentPhoto saves the comment of the user, with its mentions, and notifies the owner of the photo. Mentioned
+	// users are notified too, unless they banned the author of the comment or they can't see the photo (the owner is
+	// notified only once).
+	CommentPhoto(context.Context, uint64, uint64, Comment) (*Comment, error)
+	// DeleteComment deletes the comment (first argument) of the user on the photo. It returns ErrCommentNotExists if
+	// there is no such comment
+	DeleteComment(context.Context, uint64, uint64, uint64) error
+	// ListComments returns a page of the comments of the photo, oldest first
+	ListComments(context.Context, uint64, Page) ([]Comment, error)
+	// ListNotifications returns a page of the notifications of the user, most recent first. Notifications of the same
+	// kind about the same photo (or follows) are grouped, unless they are mentions: there is a group for the unread
+	// notifications, and a group for each time they were marked as read. Notifications from users banned by the user,
+	// or about photos of users who banned them, are hidden.
+	ListNotifications(context.Context, uint64, Page) ([]Notification, error)
+	// CountUnreadNotifications returns the number of groups of unread notifications of the user (see ListNotifications)
+	CountUnreadNotifications(context.Context, uint64) (int, error)
+	// MarkNotificationsRead marks the unread notifications of the user as read at the given time: all of them if the
+	// second argument is 0, otherwise only those with an ID up to it
+	MarkNotificationsRead(context.Context, uint64, uint64, time.Time) error
+	Ping(context.Context) error
+	// CheckSchema returns ErrSchemaNotUpToDate if there are migrations not applied to the database (e.g., the schema
+	// was reverted while the server is running)
+	CheckSchema(context.Context) error
+
+	// WithTx runs fn in a transaction: the AppDatabase passed to fn executes every operation in the transaction, which
+	// is committed if fn returns nil and rolled back otherwise. Calling WithTx inside fn joins the same transaction.
+	WithTx(context.Context, func(AppDatabase) error) error
+}
+
+// dbtx is the subset of methods shared by *sql.DB and *sql.Tx used to run queries
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 type appdbimpl struct {
-	c *sql.DB
+	// c runs the queries: it is either the connection pool or, inside WithTx, the transaction
+	c dbtx
+
+	// db is the connection pool, nil inside a transaction
+	db *sql.DB
+
+	dialect dialect
 }
 
 // New returns a new instance of AppDatabase based on the SQLite connection `db`.
 // `db` is required - an error will be returned if `db` is `nil`.
 func New(db *sql.DB) (AppDatabase, error) {
+	return newAppDatabase(db, dialectSQLite)
+}
+
+// NewPostgres returns a new instance of AppDatabase based on the PostgreSQL connection `db` (opened with the
+// DriverPostgres driver). `db` is required - an error will be returned if `db` is `nil`.
+func NewPostgres(db *sql.DB) (AppDatabase, error) {
+	return newAppDatabase(db, dialectPostgres)
+}
+
+func newAppDatabase(db *sql.DB, d dialect) (AppDatabase, error) {
 	if db == nil {
 		return nil, errors.New("database is required when building a AppDatabase")
 	}
-	// Check if table exists. If not, the database is empty, and we need to create the structure
-	var tableName string
-	errU := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='users';`).Scan(&tableName)
-	if errors.Is(errU, sql.ErrNoRows) {
-		sqlStmt := `CREATE TABLE users (
-    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-    username TEXT NOT NULL);`
-		_, errU = db.Exec(sqlStmt)
-		if errU != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", errU)
-		}
+	// The schema is created and updated by MigrateUp, here we only check that it's at the latest version
+	state, err := migrationStatus(db, d)
+	if err != nil {
+		return nil, fmt.Errorf("checking database schema: %w", err)
+	} else if len(state.Pending) > 0 {
+		return nil, ErrSchemaNotUpToDate
 	}
-	errB := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='bans';`).Scan(&tableName)
-	if errors.Is(errB, sql.ErrNoRows) {
-		sqlStmt := `CREATE TABLE bans (
-			userId INTEGER NOT NULL,
-			bannedUser INTEGER NOT NULL,
-			PRIMARY KEY(userId, bannedUser),
-			FOREIGN KEY(userId) REFERENCES users(id),
-			FOREIGN KEY(bannedUser) REFERENCES users(id));`
-		_, errB = db.Exec(sqlStmt)
-		if errB != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", errB)
-		}
+	return &appdbimpl{
+		c:       d.wrap(db),
+		db:      db,
+		dialect: d,
+	}, nil
+}
+
+func (db *appdbimpl) Ping(ctx context.Context) error {
+	if db.db == nil {
+		return nil
 	}
-	errF := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='followers';`).Scan(&tableName)
-	if errors.Is(errF, sql.ErrNoRows) {
-		sqlStmt := `CREATE TABLE followers (
-			followerId INTEGER NOT NULL,
-			followedId INTEGER NOT NULL,
-			PRIMARY KEY(followerId, followedId),
-			FOREIGN KEY(followerId) REFERENCES users(id),
-			FOREIGN KEY(followedId) REFERENCES users(id));`
-		_, errF = db.Exec(sqlStmt)
-		if errF != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", errF)
-		}
+	return db.db.PingContext(ctx)
+}
+
+func (db *appdbimpl) CheckSchema(ctx context.Context) error {
+	all, err := migrations(db.dialect)
+	if err != nil {
+		return err
 	}
-	errP := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='photos';`).Scan(&tableName)
-	if errors.Is(errP, sql.ErrNoRows) {
-		sqlStmt := `CREATE TABLE photos (
-			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			uuid TEXT NOT NULL,
-			date TIMESTAMP NOT NULL,
-			userId INTEGER NOT NULL,
-			likes INTEGER NOT NULL,
-			photoUrl TEXT NOT NULL,
-			FOREIGN KEY(userId) REFERENCES users(id));`
-		_, errP = db.Exec(sqlStmt)
-		if errP != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", errP)
-		}
+	var current int
+	err = db.c.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	} else if len(all) > 0 && current < all[len(all)-1].Version {
+		return ErrSchemaNotUpToDate
 	}
-	errL := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='likes';`).Scan(&tableName)
-	if errors.Is(errL, sql.ErrNoRows) {
-		sqlStmt := `CREATE TABLE likes (
-			userId INTEGER NOT NULL,
-			photoId INTEGER NOT NULL,
-			FOREIGN KEY(userId) REFERENCES users(id),
-			FOREIGN KEY(photoId) REFERENCES photos(id));`
-		_, errL = db.Exec(sqlStmt)
-		if errL != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", errL)
-		}
+	return nil
+}
+
+func (db *appdbimpl) WithTx(ctx context.Context, fn func(AppDatabase) error) error {
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		return fn(tx)
+	})
+}
+
+// withTx runs fn in a transaction (or in the current one, if db is already in a transaction). See WithTx.
+func (db *appdbimpl) withTx(ctx context.Context, fn func(*appdbimpl) error) (err error) {
+	if db.db == nil {
+		return fn(db)
+	}
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	errC := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='comments';`).Scan(&tableName)
-	if errors.Is(errC, sql.ErrNoRows) {
-		sqlStmt := `CREATE TABLE comments (
-			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			userId INTEGER NOT NULL,
-			photoId INTEGER NOT NULL,
-			date TIMESTAMP NOT NULL,
-			comment TEXT NOT NULL,
-			FOREIGN KEY(userId) REFERENCES users(id),
-			FOREIGN KEY(photoId) REFERENCES photos(id));`
-		_, errC = db.Exec(sqlStmt)
-		if errC != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", errC)
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			_ = tx.Rollback()
 		}
+	}()
+
+	if err = fn(&appdbimpl{c: db.dialect.wrap(tx), dialect: db.dialect}); err != nil {
+		return err
 	}
-	return &appdbimpl{
-		c: db,
-	}, nil
+	return tx.Commit()
 }
 
-func (db *appdbimpl) Ping() error {
-	return db.c.Ping()
+// checkDeleted returns notFound if the DELETE statement with the result didn't delete any row.
+func checkDeleted(res sql.Result, notFound error) error {
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return notFound
+	}
+	return nil
 }
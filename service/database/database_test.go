@@ -0,0 +1,171 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+	"sapienza/azzurra/wasaphoto/service/database/dbtest"
+	"sapienza/azzurra/wasaphoto/service/database/memdb"
+
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// postgresDSNEnv is the environment variable with the DSN of the PostgreSQL server used by tests. PostgreSQL tests are
+// skipped when it's not set. Each test runs in a new schema, dropped at the end of the test.
+const postgresDSNEnv = "WASA_TEST_POSTGRES_DSN"
+
+func TestSQLite(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) database.AppDatabase {
+		dbconn, err := sql.Open(database.DriverSQLite, filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on&_txlock=immediate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = dbconn.Close() })
+		return migrate(t, dbconn, database.DriverSQLite, database.New)
+	})
+}
+
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresDSNEnv)
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		if dsn, err = pq.ParseURL(dsn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin, err := sql.Open(database.DriverPostgres, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	var n int32
+	dbtest.Run(t, func(t *testing.T) database.AppDatabase {
+		schema := fmt.Sprintf("wasa_test_%d_%d", time.Now().UnixNano(), atomic.AddInt32(&n, 1))
+		if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+			t.Fatal(err)
+		}
+		dbconn, err := sql.Open(database.DriverPostgres, dsn+" search_path="+schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = dbconn.Close()
+			_, _ = admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		})
+		return migrate(t, dbconn, database.DriverPostgres, database.NewPostgres)
+	})
+}
+
+// TestInstrument checks that the instrumented database behaves as the wrapped one, and that operations (in and out of
+// transactions) are observed.
+func TestInstrument(t *testing.T) {
+	var mu sync.Mutex
+	observed := map[string]int{}
+	dbtest.Run(t, func(t *testing.T) database.AppDatabase {
+		return database.Instrument(memdb.New(), func(operation string, _ time.Duration, _ error) {
+			mu.Lock()
+			defer mu.Unlock()
+			observed[operation]++
+		})
+	})
+
+	for _, op := range []string{"CreateUser", "GetStream", "LikePhoto", "WithTx"} {
+		if observed[op] == 0 {
+			t.Errorf("%s not observed", op)
+		}
+	}
+}
+
+// TestMigrations checks that every migration can be reverted.
+func TestMigrations(t *testing.T) {
+	dbconn, err := sql.Open(database.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbconn.Close()
+
+	applied, err := database.MigrateUp(dbconn, database.DriverSQLite)
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	db, err := database.New(dbconn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// Reverting a migration of a running database is detected by CheckSchema
+	if _, err := database.MigrateDown(dbconn, database.DriverSQLite, 1); err != nil {
+		t.Fatalf("MigrateDown: %v", err)
+	}
+	if err := db.CheckSchema(context.Background()); !errors.Is(err, database.ErrSchemaNotUpToDate) {
+		t.Errorf("CheckSchema: got %v, want ErrSchemaNotUpToDate", err)
+	}
+
+	reverted, err := database.MigrateDown(dbconn, database.DriverSQLite, applied-1)
+	if err != nil || reverted != applied-1 {
+		t.Fatalf("MigrateDown: got %d, %v, want %d", reverted, err, applied-1)
+	}
+	state, err := database.MigrationStatus(dbconn, database.DriverSQLite)
+	if err != nil || state.Current != 0 || len(state.Pending) != applied {
+		t.Fatalf("MigrationStatus: got %+v, %v", state, err)
+	}
+
+	// Both drivers have the same migrations
+	sqlite, _ := database.Migrations(database.DriverSQLite)
+	postgres, err := database.Migrations(database.DriverPostgres)
+	if err != nil || len(sqlite) != len(postgres) {
+		t.Fatalf("Migrations: got %d SQLite and %d PostgreSQL migrations, %v", len(sqlite), len(postgres), err)
+	}
+	for i := range sqlite {
+		if sqlite[i].Version != postgres[i].Version || sqlite[i].Name != postgres[i].Name {
+			t.Errorf("migration %d_%s has no PostgreSQL counterpart", sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+}
+
+// TestCanceledContext checks that the errors of the database are not reported as missing records.
+func TestCanceledContext(t *testing.T) {
+	dbconn, err := sql.Open(database.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbconn.Close()
+	db := migrate(t, dbconn, database.DriverSQLite, database.New)
+	alice, err := db.CreateUser(context.Background(), database.User{Username: "alice"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.GetUserProfile(ctx, alice.ID, alice.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetUserProfile with a canceled context: got %v, want context.Canceled", err)
+	}
+}
+
+func migrate(t *testing.T, dbconn *sql.DB, driver string, newDB func(*sql.DB) (database.AppDatabase, error)) database.AppDatabase {
+	t.Helper()
+	if _, err := database.MigrateUp(dbconn, driver); err != nil {
+		t.Fatal(err)
+	}
+	db, err := newDB(dbconn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,1168 @@
+/*
+Package dbtest contains the conformance test suite for the implementations of database.AppDatabase. Every
+implementation must pass it, so that the rest of the code can rely on the same behavior regardless of the database
+engine in use.
+
+To run the suite, call Run from a test with a function that returns a new, empty AppDatabase:
+
+	func TestConformance(t *testing.T) {
+		dbtest.Run(t, func(t *testing.T) database.AppDatabase {
+			...
+		})
+	}
+*/
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+)
+
+// Factory returns a new, empty and ready to use AppDatabase. It's called once for each test of the suite.
+type Factory func(t *testing.T) database.AppDatabase
+
+// Run runs the conformance test suite against the AppDatabase instances returned by newDB.
+func Run(t *testing.T, newDB Factory) {
+	var tests = []struct {
+		name string
+		fn   func(*testing.T, database.AppDatabase)
+	}{
+		{"Users", testUsers},
+		{"Sessions", testSessions},
+		{"Photos", testPhotos},
+		{"Renditions", testRenditions},
+		{"Captions", testCaptions},
+		{"Tags", testTags},
+		{"Likes", testLikes},
+		{"Comments", testComments},
+		{"Mentions", testMentions},
+		{"Notifications", testNotifications},
+		{"Follows", testFollows},
+		{"Stream", testStream},
+		{"Profile", testProfile},
+		{"SearchUsers", testSearchUsers},
+		{"Bans", testBans},
+		{"Transactions", testTransactions},
+		{"Health", testHealth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newDB(t))
+		})
+	}
+}
+
+// epoch is the date of the first photo created in tests. Dates are rounded to the second, as not every database stores
+// nanoseconds.
+var epoch = time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func createUser(t *testing.T, db database.AppDatabase, username string) database.User {
+	t.Helper()
+	u, err := db.CreateUser(context.Background(), database.User{Username: username})
+	if err != nil {
+		t.Fatalf("CreateUser(%q): %v", username, err)
+	}
+	return u
+}
+
+// createPhoto creates a photo of the user, taken `n` minutes after epoch.
+func createPhoto(t *testing.T, db database.AppDatabase, userId uint64, n int) database.Photo {
+	t.Helper()
+	p, err := db.CreatePhoto(context.Background(), database.Photo{
+		Datetime: epoch.Add(time.Duration(n) * time.Minute),
+		UUID:     "uuid",
+		Path:     "/images/photo.png",
+		UserId:   userId,
+	})
+	if err != nil {
+		t.Fatalf("CreatePhoto: %v", err)
+	}
+	return p
+}
+
+func photoIDs(photos []database.Photo) []uint64 {
+	ids := make([]uint64, 0, len(photos))
+	for _, p := range photos {
+		ids = append(ids, p.Id)
+	}
+	return ids
+}
+
+func userIDs(users []database.UserEntry) []uint64 {
+	ids := make([]uint64, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.User.ID)
+	}
+	return ids
+}
+
+func equalIDs(a []uint64, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testUsers(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	if alice.ID == 0 || bob.ID == 0 || alice.ID == bob.ID {
+		t.Fatalf("CreateUser returned invalid IDs %d and %d", alice.ID, bob.ID)
+	}
+
+	if _, err := db.CreateUser(ctx, database.User{Username: "alice"}); !errors.Is(err, database.ErrUserExists) {
+		t.Errorf("CreateUser of an existing username: got %v, want ErrUserExists", err)
+	}
+
+	u, err := db.GetUserByUsername(ctx, "bob")
+	if err != nil || u != bob {
+		t.Errorf("GetUserByUsername: got %v, %v, want %v", u, err, bob)
+	}
+	if _, err := db.GetUserByUsername(ctx, "carol"); !errors.Is(err, database.ErrUserNotExists) {
+		t.Errorf("GetUserByUsername of a missing user: got %v, want ErrUserNotExists", err)
+	}
+
+	bob.Username = "bobby"
+	if _, err := db.UpdateUser(ctx, bob); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if u, err := db.GetUserByUsername(ctx, "bobby"); err != nil || u.ID != bob.ID {
+		t.Errorf("GetUserByUsername after UpdateUser: got %v, %v", u, err)
+	}
+	if _, err := db.UpdateUser(ctx, database.User{ID: 1000, Username: "nobody"}); !errors.Is(err, database.ErrUserNotExists) {
+		t.Errorf("UpdateUser of a missing user: got %v, want ErrUserNotExists", err)
+	}
+	if _, err := db.UpdateUser(ctx, database.User{ID: bob.ID, Username: alice.Username}); !errors.Is(err, database.ErrUserExists) {
+		t.Errorf("UpdateUser with a taken username: got %v, want ErrUserExists", err)
+	}
+}
+
+func testSessions(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	longAgo := time.Now().Add(-time.Hour)
+	if err := db.CreateSession(ctx, alice.ID, "token", longAgo); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	u, err := db.GetSessionUser(ctx, "token", longAgo)
+	if err != nil || u != alice {
+		t.Errorf("GetSessionUser: got %v, %v, want %v", u, err, alice)
+	}
+	if _, err := db.GetSessionUser(ctx, "other", longAgo); !errors.Is(err, database.ErrSessionNotExists) {
+		t.Errorf("GetSessionUser of a missing token: got %v, want ErrSessionNotExists", err)
+	}
+	if _, err := db.GetSessionUser(ctx, "token", time.Now().Add(time.Hour)); !errors.Is(err, database.ErrSessionNotExists) {
+		t.Errorf("GetSessionUser of an expired session: got %v, want ErrSessionNotExists", err)
+	}
+
+	// Expired sessions are deleted by the next login
+	time.Sleep(10 * time.Millisecond)
+	expiredBefore := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if err := db.CreateSession(ctx, alice.ID, "new", expiredBefore); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := db.GetSessionUser(ctx, "token", longAgo); !errors.Is(err, database.ErrSessionNotExists) {
+		t.Errorf("GetSessionUser of a deleted session: got %v, want ErrSessionNotExists", err)
+	}
+	if u, err := db.GetSessionUser(ctx, "new", longAgo); err != nil || u != alice {
+		t.Errorf("GetSessionUser of the new session: got %v, %v, want %v", u, err, alice)
+	}
+}
+
+func testPhotos(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	p := createPhoto(t, db, alice.ID, 0)
+
+	got, err := db.GetPhoto(ctx, alice.ID, p.Id)
+	if err != nil {
+		t.Fatalf("GetPhoto: %v", err)
+	}
+	if got.Id != p.Id || got.UserId != alice.ID || got.UUID != p.UUID || got.Path != p.Path || !got.Datetime.Equal(p.Datetime) {
+		t.Errorf("GetPhoto: got %+v, want %+v", got, p)
+	}
+	if _, err := db.GetPhoto(ctx, bob.ID, p.Id); !errors.Is(err, database.ErrPhotoNotExists) {
+		t.Errorf("GetPhoto of another user: got %v, want ErrPhotoNotExists", err)
+	}
+	if got, err := db.GetPhotoByID(ctx, p.Id); err != nil || got.UserId != alice.ID {
+		t.Errorf("GetPhotoByID: got %+v, %v", got, err)
+	}
+	if !got.TakenAt.IsZero() || got.Width != 0 || got.Height != 0 {
+		t.Errorf("GetPhoto without metadata: got %+v", got)
+	}
+
+	// Fields from the metadata of the image are returned by GetPhoto and when listing photos
+	withMetadata, err := db.CreatePhoto(ctx, database.Photo{
+		Datetime:    epoch.Add(time.Hour),
+		UUID:        "uuid2",
+		Path:        "/images/photo2.jpg",
+		UserId:      alice.ID,
+		TakenAt:     time.Date(2022, 8, 1, 10, 30, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		Orientation: 6,
+		Width:       3000,
+		Height:      4000,
+	})
+	if err != nil {
+		t.Fatalf("CreatePhoto: %v", err)
+	}
+	wantTaken := time.Date(2022, 8, 1, 8, 30, 0, 0, time.UTC)
+	if got, err := db.GetPhoto(ctx, alice.ID, withMetadata.Id); err != nil {
+		t.Errorf("GetPhoto: %v", err)
+	} else if !got.TakenAt.Equal(wantTaken) || got.Orientation != 6 || got.Width != 3000 || got.Height != 4000 {
+		t.Errorf("GetPhoto with metadata: got taken at %v, orientation %d and %dx%d", got.TakenAt, got.Orientation, got.Width, got.Height)
+	}
+	if profile, err := db.GetUserProfile(ctx, alice.ID, bob.ID); err != nil || len(profile.Photos) != 2 {
+		t.Errorf("GetUserProfile: got %+v, %v", profile, err)
+	} else if got := profile.Photos[0]; got.Id != withMetadata.Id || !got.TakenAt.Equal(wantTaken) || got.Width != 3000 || got.Height != 4000 {
+		t.Errorf("GetUserProfile: got photo %+v, want the metadata", got)
+	} else if !profile.Photos[1].TakenAt.IsZero() {
+		t.Errorf("GetUserProfile: got taken at %v for the photo without metadata", profile.Photos[1].TakenAt)
+	}
+
+	// Deleting the photo removes its likes and comments too
+	if err := db.LikePhoto(ctx, bob.ID, p.Id); err != nil {
+		t.Fatalf("LikePhoto: %v", err)
+	}
+	if _, err := db.CommentPhoto(ctx, bob.ID, p.Id, database.Comment{Comment: "nice"}); err != nil {
+		t.Fatalf("CommentPhoto: %v", err)
+	}
+	if err := db.DeletePhoto(ctx, bob.ID, p.Id); err != nil {
+		t.Fatalf("DeletePhoto of another user: %v", err)
+	}
+	if _, err := db.GetPhotoByID(ctx, p.Id); err != nil {
+		t.Errorf("DeletePhoto of another user deleted the photo")
+	}
+	if err := db.DeletePhoto(ctx, alice.ID, p.Id); err != nil {
+		t.Fatalf("DeletePhoto: %v", err)
+	}
+	if _, err := db.GetPhotoByID(ctx, p.Id); !errors.Is(err, database.ErrPhotoNotExists) {
+		t.Errorf("GetPhotoByID after DeletePhoto: got %v, want ErrPhotoNotExists", err)
+	}
+	if likes, err := db.ListLikedPhotos(ctx, bob.ID, database.Page{Limit: 10}); err != nil || len(likes) != 0 {
+		t.Errorf("ListLikedPhotos after DeletePhoto: got %d likes, %v", len(likes), err)
+	}
+}
+
+func testCaptions(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	p, err := db.CreatePhoto(ctx, database.Photo{
+		Datetime: epoch,
+		UUID:     "uuid1",
+		Path:     "/images/photo1.jpg",
+		UserId:   alice.ID,
+		Caption:  "Sunset in Rome",
+	})
+	if err != nil {
+		t.Fatalf("CreatePhoto: %v", err)
+	}
+	if got, err := db.GetPhoto(ctx, alice.ID, p.Id); err != nil || got.Caption != "Sunset in Rome" || !got.EditedAt.IsZero() {
+		t.Errorf("GetPhoto: got %+v, %v", got, err)
+	}
+
+	// GetPhotoDetails returns the photo as seen by the viewer
+	if err := db.LikePhoto(ctx, bob.ID, p.Id); err != nil {
+		t.Fatalf("LikePhoto: %v", err)
+	}
+	if _, err := db.CommentPhoto(ctx, bob.ID, p.Id, database.Comment{Comment: "wow"}); err != nil {
+		t.Fatalf("CommentPhoto: %v", err)
+	}
+	got, err := db.GetPhotoDetails(ctx, p.Id, bob.ID)
+	if err != nil {
+		t.Fatalf("GetPhotoDetails: %v", err)
+	}
+	if got.Author != alice || got.Caption != "Sunset in Rome" || got.CommentsCount != 1 || !got.LikedByMe || got.Path != p.Path {
+		t.Errorf("GetPhotoDetails: got %+v", got)
+	} else if len(got.Comments) != 1 || got.Comments[0].Comment != "wow" {
+		t.Errorf("GetPhotoDetails: got comments %+v", got.Comments)
+	}
+	if got, err := db.GetPhotoDetails(ctx, p.Id, alice.ID); err != nil || got.LikedByMe {
+		t.Errorf("GetPhotoDetails of the author: got %+v, %v", got, err)
+	}
+	if _, err := db.GetPhotoDetails(ctx, p.Id+100, bob.ID); !errors.Is(err, database.ErrPhotoNotExists) {
+		t.Errorf("GetPhotoDetails of a missing photo: got %v, want ErrPhotoNotExists", err)
+	}
+
+	// Only the author can edit the caption
+	editedAt := epoch.Add(time.Hour)
+	if err := db.UpdatePhotoCaption(ctx, bob.ID, p.Id, "mine", nil, nil, editedAt); !errors.Is(err, database.ErrPhotoNotExists) {
+		t.Errorf("UpdatePhotoCaption of another user: got %v, want ErrPhotoNotExists", err)
+	}
+	if err := db.UpdatePhotoCaption(ctx, alice.ID, p.Id, "Sunset in Roma", nil, nil, editedAt); err != nil {
+		t.Fatalf("UpdatePhotoCaption: %v", err)
+	}
+	if got, err := db.GetPhoto(ctx, alice.ID, p.Id); err != nil || got.Caption != "Sunset in Roma" || !got.EditedAt.Equal(editedAt) {
+		t.Errorf("GetPhoto after UpdatePhotoCaption: got %+v, %v", got, err)
+	}
+	if profile, err := db.GetUserProfile(ctx, alice.ID, bob.ID); err != nil || len(profile.Photos) != 1 {
+		t.Errorf("GetUserProfile: got %+v, %v", profile, err)
+	} else if got := profile.Photos[0]; got.Caption != "Sunset in Roma" || !got.EditedAt.Equal(editedAt) {
+		t.Errorf("GetUserProfile: got caption %q edited at %v", got.Caption, got.EditedAt)
+	}
+
+	// An empty caption removes it
+	if err := db.UpdatePhotoCaption(ctx, alice.ID, p.Id, "", nil, nil, editedAt.Add(time.Hour)); err != nil {
+		t.Fatalf("UpdatePhotoCaption: %v", err)
+	}
+	if got, err := db.GetPhotoDetails(ctx, p.Id, alice.ID); err != nil || got.Caption != "" || !got.EditedAt.Equal(editedAt.Add(time.Hour)) {
+		t.Errorf("GetPhotoDetails after removing the caption: got %+v, %v", got, err)
+	}
+}
+
+// createTaggedPhoto creates a photo of the user, taken `n` minutes after epoch, with the tags.
+func createTaggedPhoto(t *testing.T, db database.AppDatabase, userId uint64, n int, tags ...string) database.Photo {
+	t.Helper()
+	p, err := db.CreatePhoto(context.Background(), database.Photo{
+		Datetime: epoch.Add(time.Duration(n) * time.Minute),
+		UUID:     "uuid",
+		Path:     "/images/photo.png",
+		UserId:   userId,
+		Tags:     tags,
+	})
+	if err != nil {
+		t.Fatalf("CreatePhoto: %v", err)
+	}
+	return p
+}
+
+func testTags(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	carol := createUser(t, db, "carol")
+
+	p1 := createTaggedPhoto(t, db, alice.ID, 0, "rome", "sunset")
+	p2 := createTaggedPhoto(t, db, bob.ID, 1, "rome")
+	p3 := createTaggedPhoto(t, db, bob.ID, 1, "rome", "roma", "rome")
+	p4 := createTaggedPhoto(t, db, carol.ID, 2, "rome", "città")
+	if err := db.LikePhoto(ctx, alice.ID, p3.Id); err != nil {
+		t.Fatalf("LikePhoto: %v", err)
+	}
+
+	page := database.Page{Limit: 2}
+	first, err := db.ListTagPhotos(ctx, alice.ID, "rome", page)
+	if err != nil {
+		t.Fatalf("ListTagPhotos: %v", err)
+	}
+	if !equalIDs(photoIDs(first), []uint64{p4.Id, p3.Id}) {
+		t.Fatalf("ListTagPhotos: got %v, want %v", photoIDs(first), []uint64{p4.Id, p3.Id})
+	} else if top := first[1]; top.Author != bob || !top.LikedByMe || top.Comments == nil {
+		t.Errorf("ListTagPhotos: incomplete photo details %+v", top)
+	}
+	last := first[len(first)-1]
+	page.After = &database.Cursor{Time: last.Datetime, ID: last.Id}
+	if second, err := db.ListTagPhotos(ctx, alice.ID, "rome", page); err != nil || !equalIDs(photoIDs(second), []uint64{p2.Id, p1.Id}) {
+		t.Errorf("ListTagPhotos second page: got %v, %v", photoIDs(second), err)
+	}
+	if photos, err := db.ListTagPhotos(ctx, alice.ID, "Rome", database.Page{Limit: 10}); err != nil || len(photos) != 0 {
+		t.Errorf("ListTagPhotos of a missing tag: got %v, %v", photoIDs(photos), err)
+	}
+
+	// Tags are sorted by number of photos, then by name
+	tags, err := db.SearchTags(ctx, alice.ID, "", 10)
+	want := []database.Tag{{Name: "rome", Photos: 4}, {Name: "città", Photos: 1}, {Name: "roma", Photos: 1}, {Name: "sunset", Photos: 1}}
+	if err != nil || fmt.Sprint(tags) != fmt.Sprint(want) {
+		t.Errorf("SearchTags: got %v, %v, want %v", tags, err, want)
+	}
+	if tags, err := db.SearchTags(ctx, alice.ID, "rom", 1); err != nil || fmt.Sprint(tags) != fmt.Sprint(want[:1]) {
+		t.Errorf("SearchTags with limit: got %v, %v", tags, err)
+	}
+	if tags, err := db.SearchTags(ctx, alice.ID, "cit", 10); err != nil || fmt.Sprint(tags) != fmt.Sprint(want[1:2]) {
+		t.Errorf("SearchTags of a non-ASCII tag: got %v, %v", tags, err)
+	}
+
+	// Editing the caption replaces the tags
+	if err := db.UpdatePhotoCaption(ctx, bob.ID, p3.Id, "", []string{"sunset"}, nil, epoch.Add(time.Hour)); err != nil {
+		t.Fatalf("UpdatePhotoCaption: %v", err)
+	}
+	if tags, err := db.SearchTags(ctx, alice.ID, "", 10); err != nil || fmt.Sprint(tags) != "[{rome 3} {sunset 2} {città 1}]" {
+		t.Errorf("SearchTags after UpdatePhotoCaption: got %v, %v", tags, err)
+	}
+
+	// Photos of users who banned the viewer, or banned by the viewer, are hidden and not counted
+	if err := db.BanUser(ctx, carol.ID, alice.ID); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	if err := db.BanUser(ctx, alice.ID, bob.ID); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	if photos, err := db.ListTagPhotos(ctx, alice.ID, "rome", database.Page{Limit: 10}); err != nil || !equalIDs(photoIDs(photos), []uint64{p1.Id}) {
+		t.Errorf("ListTagPhotos with bans: got %v, %v", photoIDs(photos), err)
+	}
+	if tags, err := db.SearchTags(ctx, alice.ID, "", 10); err != nil || fmt.Sprint(tags) != "[{rome 1} {sunset 1}]" {
+		t.Errorf("SearchTags with bans: got %v, %v", tags, err)
+	}
+
+	// Deleting a photo removes its tags
+	if err := db.DeletePhoto(ctx, carol.ID, p4.Id); err != nil {
+		t.Fatalf("DeletePhoto: %v", err)
+	}
+	if tags, err := db.SearchTags(ctx, bob.ID, "c", 10); err != nil || len(tags) != 0 {
+		t.Errorf("SearchTags after DeletePhoto: got %v, %v", tags, err)
+	}
+}
+
+func testRenditions(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	renditions := []database.Rendition{
+		{Size: "thumb", Path: "/images/photo_thumb.jpg", Width: 150, Height: 150},
+		{Size: "medium", Path: "/images/photo_medium.jpg", Width: 640, Height: 480},
+	}
+	p, err := db.CreatePhoto(ctx, database.Photo{
+		Datetime:   epoch,
+		UUID:       "uuid",
+		Path:       "/images/photo.png",
+		UserId:     alice.ID,
+		Renditions: renditions,
+	})
+	if err != nil {
+		t.Fatalf("CreatePhoto: %v", err)
+	}
+	other := createPhoto(t, db, alice.ID, 1)
+
+	got, err := db.ListRenditions(ctx, p.Id)
+	if err != nil {
+		t.Fatalf("ListRenditions: %v", err)
+	} else if len(got) != 2 || got[0] != renditions[1] || got[1] != renditions[0] {
+		t.Errorf("ListRenditions: got %+v, want medium and thumb", got)
+	}
+	if got, err := db.ListRenditions(ctx, other.Id); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("ListRenditions of a photo without renditions: got %#v, %v", got, err)
+	}
+
+	// The photo is not created if a rendition is not valid
+	_, err = db.CreatePhoto(ctx, database.Photo{
+		Datetime:   epoch,
+		UUID:       "uuid",
+		Path:       "/images/photo.png",
+		UserId:     alice.ID,
+		Renditions: []database.Rendition{renditions[0], renditions[0]},
+	})
+	if err == nil {
+		t.Errorf("CreatePhoto with a duplicated rendition: got no error")
+	}
+	if profile, err := db.GetUserProfile(ctx, alice.ID, alice.ID); err != nil || profile.Post != 2 {
+		t.Errorf("GetUserProfile after a failed CreatePhoto: got %+v, %v, want 2 posts", profile, err)
+	}
+
+	if err := db.DeletePhoto(ctx, alice.ID, p.Id); err != nil {
+		t.Fatalf("DeletePhoto: %v", err)
+	}
+	if got, err := db.ListRenditions(ctx, p.Id); err != nil || len(got) != 0 {
+		t.Errorf("ListRenditions after DeletePhoto: got %+v, %v", got, err)
+	}
+}
+
+func testLikes(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	carol := createUser(t, db, "carol")
+	p1 := createPhoto(t, db, alice.ID, 0)
+	p2 := createPhoto(t, db, alice.ID, 1)
+
+	for _, u := range []database.User{bob, carol} {
+		if err := db.LikePhoto(ctx, u.ID, p1.Id); err != nil {
+			t.Fatalf("LikePhoto: %v", err)
+		}
+	}
+	if err := db.LikePhoto(ctx, bob.ID, p1.Id); !errors.Is(err, database.ErrLikesExists) {
+		t.Errorf("LikePhoto twice: got %v, want ErrLikesExists", err)
+	}
+	if err := db.LikePhoto(ctx, bob.ID, p2.Id); err != nil {
+		t.Fatalf("LikePhoto: %v", err)
+	}
+	if p, _ := db.GetPhotoByID(ctx, p1.Id); p == nil || p.Likes != 2 {
+		t.Errorf("likes counter: got %+v, want 2 likes", p)
+	}
+
+	// Most recent like first, one per page
+	page := database.Page{Limit: 1}
+	var likers []uint64
+	for {
+		likes, err := db.ListLikes(ctx, p1.Id, page)
+		if err != nil {
+			t.Fatalf("ListLikes: %v", err)
+		}
+		if len(likes) == 0 {
+			break
+		}
+		last := likes[len(likes)-1]
+		if last.User.Username == "" || last.Datetime.IsZero() {
+			t.Errorf("ListLikes: incomplete like %+v", last)
+		}
+		likers = append(likers, last.User.ID)
+		page.After = &database.Cursor{Time: last.Datetime, ID: last.User.ID}
+	}
+	if len(likers) != 2 {
+		t.Errorf("ListLikes: got likers %v, want bob and carol", likers)
+	}
+
+	liked, err := db.ListLikedPhotos(ctx, bob.ID, database.Page{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListLikedPhotos: %v", err)
+	}
+	if len(liked) != 2 || liked[0].Photo.Id != p2.Id || liked[1].Photo.Id != p1.Id || liked[0].Photo.Author.ID != alice.ID {
+		t.Errorf("ListLikedPhotos: got %+v, want p2 and p1 of alice", liked)
+	}
+
+	if err := db.DeleteLike(ctx, bob.ID, p1.Id); err != nil {
+		t.Fatalf("DeleteLike: %v", err)
+	}
+	if p, _ := db.GetPhotoByID(ctx, p1.Id); p == nil || p.Likes != 1 {
+		t.Errorf("likes counter after DeleteLike: got %+v, want 1 like", p)
+	}
+	if err := db.DeleteLike(ctx, bob.ID, p1.Id); !errors.Is(err, database.ErrLikeNotExists) {
+		t.Errorf("DeleteLike of a missing like: got %v, want ErrLikeNotExists", err)
+	}
+	if p, _ := db.GetPhotoByID(ctx, p1.Id); p == nil || p.Likes != 1 {
+		t.Errorf("likes counter after deleting a missing like: got %+v, want 1 like", p)
+	}
+}
+
+// mention returns a mention of the username (only the username is needed to save it).
+func mention(username string, offset int) database.Mention {
+	return database.Mention{User: database.User{Username: username}, Offset: offset, Length: len(username) + 1}
+}
+
+// mentionedIDs returns the IDs of the mentioned users, and fails if the usernames are not filled.
+func mentionedIDs(t *testing.T, mentions []database.Mention) []uint64 {
+	t.Helper()
+	ids := make([]uint64, 0, len(mentions))
+	for _, m := range mentions {
+		if m.User.Username == "" {
+			t.Errorf("mention without username: %+v", m)
+		}
+		ids = append(ids, m.User.ID)
+	}
+	return ids
+}
+
+func listNotifications(t *testing.T, db database.AppDatabase, userId uint64) []database.Notification {
+	t.Helper()
+	notifications, err := db.ListNotifications(context.Background(), userId, database.Page{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	return notifications
+}
+
+func testMentions(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	carol := createUser(t, db, "carol")
+	dave := createUser(t, db, "dave")
+	erin := createUser(t, db, "erin")
+
+	// Mentions of missing users are dropped, and the author is not notified
+	p, err := db.CreatePhoto(ctx, database.Photo{
+		Datetime: epoch,
+		UUID:     "uuid",
+		Path:     "/images/photo.png",
+		UserId:   alice.ID,
+		Caption:  "@bob @nobody @alice",
+		Mentions: []database.Mention{mention("bob", 0), mention("nobody", 5), mention("alice", 13)},
+	})
+	if err != nil {
+		t.Fatalf("CreatePhoto: %v", err)
+	}
+	if !equalIDs(mentionedIDs(t, p.Mentions), []uint64{bob.ID, alice.ID}) {
+		t.Errorf("CreatePhoto: got mentions %+v", p.Mentions)
+	}
+	got, err := db.GetPhotoDetails(ctx, p.Id, carol.ID)
+	if err != nil {
+		t.Fatalf("GetPhotoDetails: %v", err)
+	} else if want := []database.Mention{{User: bob, Offset: 0, Length: 4}, {User: alice, Offset: 13, Length: 6}}; fmt.Sprint(got.Mentions) != fmt.Sprint(want) {
+		t.Errorf("GetPhotoDetails: got mentions %+v, want %+v", got.Mentions, want)
+	}
+	if n := listNotifications(t, db, bob.ID); len(n) != 1 || n[0].Kind != database.NotificationMention ||
+		n[0].Actor != alice || n[0].PhotoId != p.Id || n[0].CommentId != 0 || !n[0].Datetime.Equal(epoch) {
+		t.Errorf("notifications of the caption: got %+v", n)
+	}
+	if n := listNotifications(t, db, alice.ID); len(n) != 0 {
+		t.Errorf("notifications of the author: got %+v", n)
+	}
+
+	// Users who banned the author of the comment, or who can't see the photo, are not notified. Users mentioned twice
+	// are notified once.
+	if err := db.BanUser(ctx, dave.ID, carol.ID); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	if err := db.BanUser(ctx, alice.ID, erin.ID); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	c, err := db.CommentPhoto(ctx, carol.ID, p.Id, database.Comment{
+		Comment:  "@bob @dave @erin @bob",
+		Mentions: []database.Mention{mention("bob", 0), mention("dave", 5), mention("erin", 11), mention("bob", 17)},
+	})
+	if err != nil {
+		t.Fatalf("CommentPhoto: %v", err)
+	} else if !equalIDs(mentionedIDs(t, c.Mentions), []uint64{bob.ID, dave.ID, erin.ID, bob.ID}) {
+		t.Errorf("CommentPhoto: got mentions %+v", c.Mentions)
+	}
+	if n := listNotifications(t, db, bob.ID); len(n) != 2 || n[0].Actor != carol || n[0].CommentId != c.Id || n[0].PhotoId != p.Id {
+		t.Errorf("notifications of the comment: got %+v", n)
+	}
+	for _, u := range []database.User{dave, erin} {
+		if n := listNotifications(t, db, u.ID); len(n) != 0 {
+			t.Errorf("notifications of %s: got %+v", u.Username, n)
+		}
+	}
+
+	// Mentions are read with the current username
+	bob.Username = "bobby"
+	if _, err := db.UpdateUser(ctx, bob); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	comments, err := db.ListComments(ctx, p.Id, database.Page{Limit: 10})
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("ListComments: got %+v, %v", comments, err)
+	} else if m := comments[0].Mentions; len(m) != 4 || m[0].User != bob || m[3].Offset != 17 || m[3].Length != 4 {
+		t.Errorf("ListComments: got mentions %+v", m)
+	}
+	if got, err := db.GetPhotoDetails(ctx, p.Id, alice.ID); err != nil || len(got.Comments) != 1 || len(got.Comments[0].Mentions) != 4 {
+		t.Errorf("GetPhotoDetails: got comments %+v, %v", got.Comments, err)
+	} else if got.Mentions[0].User != bob {
+		t.Errorf("GetPhotoDetails: got mentions %+v", got.Mentions)
+	}
+
+	// Editing the caption notifies only the users mentioned for the first time, and removes the notifications of the
+	// users not mentioned anymore
+	for i := 0; i < 2; i++ {
+		err := db.UpdatePhotoCaption(ctx, alice.ID, p.Id, "@carol", nil, []database.Mention{mention("carol", 0)}, epoch.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("UpdatePhotoCaption: %v", err)
+		}
+	}
+	if n := listNotifications(t, db, carol.ID); len(n) != 1 || n[0].Actor != alice || !n[0].Datetime.Equal(epoch.Add(time.Hour)) {
+		t.Errorf("notifications after the edit: got %+v", n)
+	}
+	if n := listNotifications(t, db, bob.ID); len(n) != 1 || n[0].CommentId != c.Id {
+		t.Errorf("notifications of a user not mentioned anymore: got %+v", n)
+	}
+	if got, err := db.GetPhotoDetails(ctx, p.Id, alice.ID); err != nil || !equalIDs(mentionedIDs(t, got.Mentions), []uint64{carol.ID}) {
+		t.Errorf("GetPhotoDetails after the edit: got %+v, %v", got.Mentions, err)
+	}
+
+	// Deleting the comment and the photo removes mentions and notifications
+	if err := db.DeleteComment(ctx, c.Id, carol.ID, p.Id); err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+	if n := listNotifications(t, db, bob.ID); len(n) != 0 {
+		t.Errorf("notifications after DeleteComment: got %+v", n)
+	}
+	if err := db.DeletePhoto(ctx, alice.ID, p.Id); err != nil {
+		t.Fatalf("DeletePhoto: %v", err)
+	}
+	if n := listNotifications(t, db, carol.ID); len(n) != 0 {
+		t.Errorf("notifications after DeletePhoto: got %+v", n)
+	}
+}
+
+// groupsString describes the groups of notifications, e.g. "like:carol+1" for a group of likes of carol and another
+// user, with a '*' if read.
+func groupsString(notifications []database.Notification) string {
+	groups := make([]string, 0, len(notifications))
+	for _, n := range notifications {
+		g := fmt.Sprintf("%s:%s+%d", n.Kind, n.Actor.Username, n.Others)
+		if n.Read {
+			g += "*"
+		}
+		groups = append(groups, g)
+	}
+	return strings.Join(groups, " ")
+}
+
+func testNotifications(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	carol := createUser(t, db, "carol")
+	dave := createUser(t, db, "dave")
+	p := createPhoto(t, db, alice.ID, 0)
+
+	// Likes, follows and comments are notified (except those of the user), and grouped
+	for _, u := range []database.User{alice, bob, carol, dave} {
+		if err := db.LikePhoto(ctx, u.ID, p.Id); err != nil {
+			t.Fatalf("LikePhoto: %v", err)
+		}
+	}
+	for _, u := range []database.User{bob, carol} {
+		if err := db.FollowerUser(ctx, u.ID, alice.ID); err != nil {
+			t.Fatalf("FollowerUser: %v", err)
+		}
+	}
+	// The owner is not notified of the mention in the comment
+	c, err := db.CommentPhoto(ctx, carol.ID, p.Id, database.Comment{Comment: "@alice", Mentions: []database.Mention{mention("alice", 0)}})
+	if err != nil {
+		t.Fatalf("CommentPhoto: %v", err)
+	}
+	got := listNotifications(t, db, alice.ID)
+	if s := groupsString(got); s != "comment:carol+0 follow:carol+1 like:dave+2" {
+		t.Fatalf("ListNotifications: got %s", s)
+	} else if got[0].PhotoId != p.Id || got[0].PhotoOwnerId != alice.ID || got[0].CommentId != c.Id || got[1].PhotoId != 0 {
+		t.Errorf("ListNotifications: got %+v", got)
+	}
+	if n, err := db.CountUnreadNotifications(ctx, alice.ID); err != nil || n != 3 {
+		t.Errorf("CountUnreadNotifications: got %d, %v", n, err)
+	}
+
+	// Pages of groups
+	first, err := db.ListNotifications(ctx, alice.ID, database.Page{Limit: 2})
+	if err != nil || len(first) != 2 {
+		t.Fatalf("ListNotifications first page: got %+v, %v", first, err)
+	}
+	last := first[len(first)-1]
+	second, err := db.ListNotifications(ctx, alice.ID, database.Page{Limit: 2, After: &database.Cursor{Time: last.Datetime, ID: last.Id}})
+	if err != nil || groupsString(second) != "like:dave+2" {
+		t.Errorf("ListNotifications second page: got %s, %v", groupsString(second), err)
+	}
+
+	// Removing the like removes its notification
+	if err := db.DeleteLike(ctx, dave.ID, p.Id); err != nil {
+		t.Fatalf("DeleteLike: %v", err)
+	}
+	if s := groupsString(listNotifications(t, db, alice.ID)); s != "comment:carol+0 follow:carol+1 like:carol+1" {
+		t.Errorf("ListNotifications after DeleteLike: got %s", s)
+	}
+
+	// Notifications read together stay grouped, and new ones start a new group
+	readAt := epoch.Add(time.Hour)
+	if err := db.MarkNotificationsRead(ctx, alice.ID, 0, readAt); err != nil {
+		t.Fatalf("MarkNotificationsRead: %v", err)
+	}
+	if n, err := db.CountUnreadNotifications(ctx, alice.ID); err != nil || n != 0 {
+		t.Errorf("CountUnreadNotifications after MarkNotificationsRead: got %d, %v", n, err)
+	}
+	if err := db.LikePhoto(ctx, dave.ID, p.Id); err != nil {
+		t.Fatalf("LikePhoto: %v", err)
+	}
+	if err := db.FollowerUser(ctx, dave.ID, alice.ID); err != nil {
+		t.Fatalf("FollowerUser: %v", err)
+	}
+	got = listNotifications(t, db, alice.ID)
+	if s := groupsString(got); s != "follow:dave+0 like:dave+0 comment:carol+0* follow:carol+1* like:carol+1*" {
+		t.Errorf("ListNotifications after MarkNotificationsRead: got %s", s)
+	}
+
+	// Only the notifications up to the given ID are marked as read
+	if err := db.MarkNotificationsRead(ctx, alice.ID, got[1].Id, readAt.Add(time.Hour)); err != nil {
+		t.Fatalf("MarkNotificationsRead: %v", err)
+	}
+	if n, err := db.CountUnreadNotifications(ctx, alice.ID); err != nil || n != 1 {
+		t.Errorf("CountUnreadNotifications: got %d, %v, want 1", n, err)
+	}
+
+	// Notifications of users banned by the user are hidden, and unfollowing removes the notification
+	if err := db.BanUser(ctx, alice.ID, carol.ID); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	if err := db.DeleteFollowerUser(ctx, dave.ID, alice.ID); err != nil {
+		t.Fatalf("DeleteFollowerUser: %v", err)
+	}
+	if s := groupsString(listNotifications(t, db, alice.ID)); s != "like:dave+0* follow:bob+0* like:bob+0*" {
+		t.Errorf("ListNotifications with a ban: got %s", s)
+	}
+
+	// As are notifications about photos of users who banned the user
+	q, err := db.CreatePhoto(ctx, database.Photo{
+		Datetime: epoch,
+		UUID:     "uuid",
+		Path:     "/images/photo.png",
+		UserId:   dave.ID,
+		Mentions: []database.Mention{mention("bob", 0)},
+	})
+	if err != nil {
+		t.Fatalf("CreatePhoto: %v", err)
+	}
+	if got := listNotifications(t, db, bob.ID); len(got) != 1 || got[0].PhotoId != q.Id || got[0].PhotoOwnerId != dave.ID {
+		t.Errorf("ListNotifications of the mention: got %+v", got)
+	}
+	if err := db.BanUser(ctx, dave.ID, bob.ID); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	if got := listNotifications(t, db, bob.ID); len(got) != 0 {
+		t.Errorf("ListNotifications with a ban of the owner: got %+v", got)
+	}
+	if n, err := db.CountUnreadNotifications(ctx, bob.ID); err != nil || n != 0 {
+		t.Errorf("CountUnreadNotifications with a ban of the owner: got %d, %v", n, err)
+	}
+}
+
+func testComments(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	p := createPhoto(t, db, alice.ID, 0)
+
+	var ids []uint64
+	for _, text := range []string{"first", "second", "third"} {
+		c, err := db.CommentPhoto(ctx, bob.ID, p.Id, database.Comment{Comment: text})
+		if err != nil {
+			t.Fatalf("CommentPhoto: %v", err)
+		}
+		if c.Id == 0 || c.User == nil || c.User.ID != bob.ID || c.User.Username != "bob" || c.Comment != text {
+			t.Errorf("CommentPhoto: got %+v", c)
+		}
+		ids = append(ids, c.Id)
+	}
+	if _, err := db.CommentPhoto(ctx, 1000, p.Id, database.Comment{Comment: "ghost"}); !errors.Is(err, database.ErrUserNotExists) {
+		t.Errorf("CommentPhoto of a missing user: got %v, want ErrUserNotExists", err)
+	}
+
+	// Oldest first, two per page
+	page := database.Page{Limit: 2}
+	var got []uint64
+	for {
+		comments, err := db.ListComments(ctx, p.Id, page)
+		if err != nil {
+			t.Fatalf("ListComments: %v", err)
+		}
+		if len(comments) == 0 {
+			break
+		}
+		for _, c := range comments {
+			got = append(got, c.Id)
+		}
+		last := comments[len(comments)-1]
+		page.After = &database.Cursor{Time: last.Datetime, ID: last.Id}
+	}
+	if !equalIDs(got, ids) {
+		t.Errorf("ListComments: got %v, want %v", got, ids)
+	}
+
+	if err := db.DeleteComment(ctx, ids[0], bob.ID, p.Id); err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+	if comments, err := db.ListComments(ctx, p.Id, database.Page{Limit: 10}); err != nil || len(comments) != 2 {
+		t.Errorf("ListComments after DeleteComment: got %d comments, %v", len(comments), err)
+	}
+	if err := db.DeleteComment(ctx, ids[0], bob.ID, p.Id); !errors.Is(err, database.ErrCommentNotExists) {
+		t.Errorf("DeleteComment of a deleted comment: got %v, want ErrCommentNotExists", err)
+	}
+	if err := db.DeleteComment(ctx, ids[1], alice.ID, p.Id); !errors.Is(err, database.ErrCommentNotExists) {
+		t.Errorf("DeleteComment of the comment of another user: got %v, want ErrCommentNotExists", err)
+	}
+}
+
+func testFollows(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	carol := createUser(t, db, "carol")
+
+	for _, f := range [][2]uint64{{bob.ID, alice.ID}, {carol.ID, alice.ID}, {alice.ID, carol.ID}} {
+		if err := db.FollowerUser(ctx, f[0], f[1]); err != nil {
+			t.Fatalf("FollowerUser: %v", err)
+		}
+	}
+	if err := db.FollowerUser(ctx, bob.ID, alice.ID); !errors.Is(err, database.ErrFollowExists) {
+		t.Errorf("FollowerUser twice: got %v, want ErrFollowExists", err)
+	}
+	if err := db.FollowerUser(ctx, bob.ID, 1000); !errors.Is(err, database.ErrUserNotExists) {
+		t.Errorf("FollowerUser of a missing user: got %v, want ErrUserNotExists", err)
+	}
+
+	// Followers of alice, as seen by alice (who follows carol only), one per page
+	page := database.Page{Limit: 1}
+	var got []database.UserEntry
+	for {
+		users, err := db.ListFollowers(ctx, alice.ID, alice.ID, page)
+		if err != nil {
+			t.Fatalf("ListFollowers: %v", err)
+		}
+		if len(users) == 0 {
+			break
+		}
+		got = append(got, users...)
+		page.After = &database.Cursor{ID: users[len(users)-1].User.ID}
+	}
+	if !equalIDs(userIDs(got), []uint64{bob.ID, carol.ID}) {
+		t.Fatalf("ListFollowers: got %v, want bob and carol", userIDs(got))
+	}
+	if got[0].FollowedByMe || !got[1].FollowedByMe || got[1].User.Username != "carol" {
+		t.Errorf("ListFollowers: got %+v, want only carol followed by the viewer", got)
+	}
+
+	following, err := db.ListFollowing(ctx, alice.ID, bob.ID, database.Page{Limit: 10})
+	if err != nil || !equalIDs(userIDs(following), []uint64{carol.ID}) {
+		t.Errorf("ListFollowing: got %v, %v, want carol", userIDs(following), err)
+	}
+
+	if err := db.DeleteFollowerUser(ctx, bob.ID, alice.ID); err != nil {
+		t.Fatalf("DeleteFollowerUser: %v", err)
+	}
+	if users, err := db.ListFollowers(ctx, alice.ID, alice.ID, database.Page{Limit: 10}); err != nil || len(users) != 1 {
+		t.Errorf("ListFollowers after DeleteFollowerUser: got %v, %v", userIDs(users), err)
+	}
+	if err := db.DeleteFollowerUser(ctx, bob.ID, alice.ID); !errors.Is(err, database.ErrFollowNotExists) {
+		t.Errorf("DeleteFollowerUser of a missing follow: got %v, want ErrFollowNotExists", err)
+	}
+}
+
+func testStream(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	carol := createUser(t, db, "carol")
+	if err := db.FollowerUser(ctx, alice.ID, bob.ID); err != nil {
+		t.Fatalf("FollowerUser: %v", err)
+	}
+
+	// Two photos with the same date: the ID breaks the tie
+	p1 := createPhoto(t, db, bob.ID, 0)
+	p2 := createPhoto(t, db, bob.ID, 1)
+	p3 := createPhoto(t, db, bob.ID, 1)
+	createPhoto(t, db, carol.ID, 2)
+	for i := 0; i < database.CommentsPreviewSize+1; i++ {
+		if _, err := db.CommentPhoto(ctx, carol.ID, p3.Id, database.Comment{Comment: "comment"}); err != nil {
+			t.Fatalf("CommentPhoto: %v", err)
+		}
+	}
+	if err := db.LikePhoto(ctx, alice.ID, p3.Id); err != nil {
+		t.Fatalf("LikePhoto: %v", err)
+	}
+
+	page := database.Page{Limit: 2}
+	first, err := db.GetStream(ctx, alice.ID, page)
+	if err != nil {
+		t.Fatalf("GetStream: %v", err)
+	}
+	if !equalIDs(photoIDs(first), []uint64{p3.Id, p2.Id}) {
+		t.Fatalf("GetStream: got %v, want %v", photoIDs(first), []uint64{p3.Id, p2.Id})
+	}
+	top := first[0]
+	if top.Author != bob || top.Likes != 1 || !top.LikedByMe || top.CommentsCount != uint64(database.CommentsPreviewSize+1) ||
+		len(top.Comments) != database.CommentsPreviewSize || top.Comments[0].User == nil || top.Comments[0].User.ID != carol.ID {
+		t.Errorf("GetStream: incomplete photo details %+v", top)
+	}
+	if first[1].LikedByMe || first[1].CommentsCount != 0 || len(first[1].Comments) != 0 {
+		t.Errorf("GetStream: unexpected details %+v", first[1])
+	}
+
+	last := first[len(first)-1]
+	page.After = &database.Cursor{Time: last.Datetime, ID: last.Id}
+	second, err := db.GetStream(ctx, alice.ID, page)
+	if err != nil {
+		t.Fatalf("GetStream: %v", err)
+	}
+	if !equalIDs(photoIDs(second), []uint64{p1.Id}) {
+		t.Errorf("GetStream second page: got %v, want %v", photoIDs(second), []uint64{p1.Id})
+	}
+}
+
+func testProfile(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	p1 := createPhoto(t, db, alice.ID, 0)
+	p2 := createPhoto(t, db, alice.ID, 1)
+	if err := db.FollowerUser(ctx, bob.ID, alice.ID); err != nil {
+		t.Fatalf("FollowerUser: %v", err)
+	}
+	if err := db.LikePhoto(ctx, bob.ID, p1.Id); err != nil {
+		t.Fatalf("LikePhoto: %v", err)
+	}
+
+	profile, err := db.GetUserProfile(ctx, alice.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("GetUserProfile: %v", err)
+	}
+	if profile.User == nil || *profile.User != alice || profile.Post != 2 || profile.Follower != 1 || profile.Following != 0 {
+		t.Errorf("GetUserProfile: got %+v", profile)
+	}
+	if !equalIDs(photoIDs(profile.Photos), []uint64{p2.Id, p1.Id}) || !profile.Photos[1].LikedByMe || profile.Photos[0].LikedByMe {
+		t.Errorf("GetUserProfile: got photos %+v", profile.Photos)
+	}
+
+	if _, err := db.GetUserProfile(ctx, 1000, bob.ID); !errors.Is(err, database.ErrUserNotExists) {
+		t.Errorf("GetUserProfile of a missing user: got %v, want ErrUserNotExists", err)
+	}
+}
+
+func testSearchUsers(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	viewer := createUser(t, db, "viewer")
+	anna := createUser(t, db, "Anna")
+	annie := createUser(t, db, "annie")
+	createUser(t, db, "bob")
+	if err := db.FollowerUser(ctx, viewer.ID, annie.ID); err != nil {
+		t.Fatalf("FollowerUser: %v", err)
+	}
+
+	users, err := db.SearchUsers(ctx, viewer.ID, "AN", 10)
+	if err != nil {
+		t.Fatalf("SearchUsers: %v", err)
+	}
+	if !equalIDs(userIDs(users), []uint64{anna.ID, annie.ID}) {
+		t.Fatalf("SearchUsers: got %v, want Anna and annie", userIDs(users))
+	}
+	if users[0].FollowedByMe || !users[1].FollowedByMe {
+		t.Errorf("SearchUsers: wrong follow state %+v", users)
+	}
+
+	if users, err := db.SearchUsers(ctx, viewer.ID, "an", 1); err != nil || len(users) != 1 {
+		t.Errorf("SearchUsers with limit: got %v, %v", userIDs(users), err)
+	}
+}
+
+func testBans(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	carol := createUser(t, db, "carol")
+	p := createPhoto(t, db, alice.ID, 0)
+	for _, u := range []database.User{bob, carol} {
+		if err := db.FollowerUser(ctx, u.ID, alice.ID); err != nil {
+			t.Fatalf("FollowerUser: %v", err)
+		}
+		if _, err := db.CommentPhoto(ctx, u.ID, p.Id, database.Comment{Comment: "hello"}); err != nil {
+			t.Fatalf("CommentPhoto: %v", err)
+		}
+		if err := db.LikePhoto(ctx, u.ID, p.Id); err != nil {
+			t.Fatalf("LikePhoto: %v", err)
+		}
+	}
+
+	if err := db.BanUser(ctx, alice.ID, bob.ID); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	if err := db.BanUser(ctx, alice.ID, bob.ID); !errors.Is(err, database.ErrBanExists) {
+		t.Errorf("BanUser twice: got %v, want ErrBanExists", err)
+	}
+	if err := db.BanUser(ctx, alice.ID, 1000); !errors.Is(err, database.ErrUserNotExists) {
+		t.Errorf("BanUser of a missing user: got %v, want ErrUserNotExists", err)
+	}
+	if banned, err := db.IsBanned(ctx, alice.ID, bob.ID); err != nil || !banned {
+		t.Errorf("IsBanned: got %v, %v, want true", banned, err)
+	}
+	if banned, err := db.IsBanned(ctx, bob.ID, alice.ID); err != nil || banned {
+		t.Errorf("IsBanned in the other direction: got %v, %v, want false", banned, err)
+	}
+
+	// Content of bob is hidden on alice's photo, and alice is hidden to bob
+	if comments, err := db.ListComments(ctx, p.Id, database.Page{Limit: 10}); err != nil || len(comments) != 1 || comments[0].User.ID != carol.ID {
+		t.Errorf("ListComments: got %+v, %v, want only carol's comment", comments, err)
+	}
+	if likes, err := db.ListLikes(ctx, p.Id, database.Page{Limit: 10}); err != nil || len(likes) != 1 || likes[0].User.ID != carol.ID {
+		t.Errorf("ListLikes: got %+v, %v, want only carol's like", likes, err)
+	}
+	if photos, err := db.GetStream(ctx, bob.ID, database.Page{Limit: 10}); err != nil || len(photos) != 0 {
+		t.Errorf("GetStream of the banned user: got %v, %v, want no photos", photoIDs(photos), err)
+	}
+	if photos, err := db.GetStream(ctx, carol.ID, database.Page{Limit: 10}); err != nil || len(photos) != 1 || photos[0].CommentsCount != 1 || photos[0].Likes != 1 {
+		t.Errorf("GetStream: got %+v, %v, want the photo with one comment and one like", photos, err)
+	}
+	if photo, err := db.GetPhotoDetails(ctx, p.Id, alice.ID); err != nil || photo.Likes != 1 {
+		t.Errorf("GetPhotoDetails: got %d likes, %v, want only carol's like", photo.Likes, err)
+	}
+	if liked, err := db.ListLikedPhotos(ctx, bob.ID, database.Page{Limit: 10}); err != nil || len(liked) != 0 {
+		t.Errorf("ListLikedPhotos of the banned user: got %d photos, %v", len(liked), err)
+	}
+	if users, err := db.SearchUsers(ctx, bob.ID, "a", 10); err != nil || len(users) != 0 {
+		t.Errorf("SearchUsers by the banned user: got %v, %v", userIDs(users), err)
+	}
+	if users, err := db.ListFollowers(ctx, alice.ID, carol.ID, database.Page{Limit: 10}); err != nil || len(users) != 2 {
+		t.Errorf("ListFollowers: got %v, %v, want bob and carol", userIDs(users), err)
+	}
+	if users, err := db.ListFollowers(ctx, alice.ID, alice.ID, database.Page{Limit: 10}); err != nil || !equalIDs(userIDs(users), []uint64{carol.ID}) {
+		t.Errorf("ListFollowers as the user who banned: got %v, %v, want carol", userIDs(users), err)
+	}
+	if profile, err := db.GetUserProfile(ctx, alice.ID, carol.ID); err != nil || profile.Follower != 2 {
+		t.Errorf("GetUserProfile: got %+v, %v, want 2 followers", profile, err)
+	}
+	if profile, err := db.GetUserProfile(ctx, alice.ID, alice.ID); err != nil || profile.Follower != 1 {
+		t.Errorf("GetUserProfile as the user who banned: got %+v, %v, want 1 follower", profile, err)
+	}
+	if profile, err := db.GetUserProfile(ctx, bob.ID, bob.ID); err != nil || profile.Following != 0 {
+		t.Errorf("GetUserProfile as the banned user: got %+v, %v, want no following", profile, err)
+	}
+
+	if err := db.DeleteBan(ctx, alice.ID, bob.ID); err != nil {
+		t.Fatalf("DeleteBan: %v", err)
+	}
+	if banned, err := db.IsBanned(ctx, alice.ID, bob.ID); err != nil || banned {
+		t.Errorf("IsBanned after DeleteBan: got %v, %v, want false", banned, err)
+	}
+	if photo, err := db.GetPhotoDetails(ctx, p.Id, alice.ID); err != nil || photo.Likes != 2 {
+		t.Errorf("GetPhotoDetails after DeleteBan: got %d likes, %v, want 2", photo.Likes, err)
+	}
+	if err := db.DeleteBan(ctx, alice.ID, bob.ID); !errors.Is(err, database.ErrBanNotExists) {
+		t.Errorf("DeleteBan of a missing ban: got %v, want ErrBanNotExists", err)
+	}
+}
+
+func testTransactions(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+
+	// An error rolls back every change made in the transaction, including those in nested calls
+	errAbort := errors.New("abort")
+	err := db.WithTx(ctx, func(tx database.AppDatabase) error {
+		if err := tx.FollowerUser(ctx, alice.ID, bob.ID); err != nil {
+			return err
+		}
+		return tx.WithTx(ctx, func(tx database.AppDatabase) error {
+			if _, err := tx.CreateUser(ctx, database.User{Username: "carol"}); err != nil {
+				return err
+			}
+			return errAbort
+		})
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx: got %v, want the error of the function", err)
+	}
+	if _, err := db.GetUserByUsername(ctx, "carol"); !errors.Is(err, database.ErrUserNotExists) {
+		t.Errorf("user created in a rolled back transaction: got %v, want ErrUserNotExists", err)
+	}
+	if users, err := db.ListFollowing(ctx, alice.ID, alice.ID, database.Page{Limit: 10}); err != nil || len(users) != 0 {
+		t.Errorf("follow created in a rolled back transaction: got %v, %v", userIDs(users), err)
+	}
+
+	// Changes are visible inside the transaction, and after the commit
+	err = db.WithTx(ctx, func(tx database.AppDatabase) error {
+		if err := tx.BanUser(ctx, alice.ID, bob.ID); err != nil {
+			return err
+		}
+		banned, err := tx.IsBanned(ctx, alice.ID, bob.ID)
+		if err == nil && !banned {
+			t.Errorf("ban not visible inside the transaction")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if banned, err := db.IsBanned(ctx, alice.ID, bob.ID); err != nil || !banned {
+		t.Errorf("ban after the commit: got %v, %v, want true", banned, err)
+	}
+}
+
+func testHealth(t *testing.T, db database.AppDatabase) {
+	ctx := context.Background()
+	if err := db.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+	if err := db.CheckSchema(ctx); err != nil {
+		t.Errorf("CheckSchema: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Names of the supported database drivers, as registered in database/sql (and used in the configuration)
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// dialect is the SQL flavour of a database engine. Queries in this package are written once, using `?` placeholders
+// and SQL supported by every engine; the dialect takes care of the (few) remaining differences.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// dialectOf returns the dialect for the database driver name.
+func dialectOf(driver string) (dialect, error) {
+	switch driver {
+	case DriverSQLite:
+		return dialectSQLite, nil
+	case DriverPostgres:
+		return dialectPostgres, nil
+	default:
+		return 0, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// migrationsDir is the directory of the migrations for the dialect.
+func (d dialect) migrationsDir() string {
+	if d == dialectPostgres {
+		return "migrations/postgres"
+	}
+	return "migrations/sqlite"
+}
+
+// wrap returns c, adapting the queries to the dialect before they are sent to the database.
+func (d dialect) wrap(c dbtx) dbtx {
+	if d == dialectPostgres {
+		return rebinder{c}
+	}
+	return c
+}
+
+// PostgreSQL error codes (SQLSTATE) of constraint violations
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+)
+
+// isUniqueViolation returns whether err is the violation of a primary key or a unique index.
+func (d dialect) isUniqueViolation(err error) bool {
+	if d == dialectPostgres {
+		var pqErr *pq.Error
+		return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation
+	}
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// isForeignKeyViolation returns whether err is the violation of a foreign key (e.g., a reference to a missing user).
+func (d dialect) isForeignKeyViolation(err error) bool {
+	if d == dialectPostgres {
+		var pqErr *pq.Error
+		return errors.As(err, &pqErr) && pqErr.Code == pqForeignKeyViolation
+	}
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+}
+
+// rebinder replaces the `?` placeholders with the numbered ones (`$1`, `$2`, ...) used by PostgreSQL.
+type rebinder struct {
+	c dbtx
+}
+
+func (r rebinder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.c.ExecContext(ctx, rebind(query), args...)
+}
+
+func (r rebinder) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return r.c.QueryContext(ctx, rebind(query), args...)
+}
+
+func (r rebinder) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.c.QueryRowContext(ctx, rebind(query), args...)
+}
+
+// rebind replaces each `?` in the query with `$n`, where n is the position of the placeholder. Queries in this
+// package never contain `?` inside string literals.
+func rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			b.WriteByte(query[i])
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
@@ -1,22 +1,82 @@
 package database
 
-func (db *appdbimpl) FollowerUser(followerId uint64, followedId uint64) error {
+import (
+	"context"
+	"time"
+)
 
-	_, err := db.c.Exec(`INSERT INTO followers (followerId,followedId) VALUES (?, ?)`,
-		followerId, followedId)
-	if err != nil {
+func (db *appdbimpl) FollowerUser(ctx context.Context, followerId uint64, followedId uint64) error {
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		_, err := tx.c.ExecContext(ctx, `INSERT INTO followers (followerId,followedId) VALUES (?, ?)`,
+			followerId, followedId)
+		if tx.dialect.isUniqueViolation(err) {
+			return ErrFollowExists
+		} else if tx.dialect.isForeignKeyViolation(err) {
+			return ErrUserNotExists
+		} else if err != nil {
+			return err
+		}
+
+		return tx.notify(ctx, followedId, Notification{
+			Kind:     NotificationFollow,
+			Actor:    User{ID: followerId},
+			Datetime: time.Now(),
+		})
+	})
+}
+
+func (db *appdbimpl) DeleteFollowerUser(ctx context.Context, followerId uint64, followedId uint64) error {
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		res, err := tx.c.ExecContext(ctx, `DELETE FROM followers WHERE followerId=? AND followedId=?`, followerId, followedId)
+		if err != nil {
+			return err
+		} else if err := checkDeleted(res, ErrFollowNotExists); err != nil {
+			return err
+		}
+		_, err = tx.c.ExecContext(ctx, `DELETE FROM notifications WHERE kind=? AND actorId=? AND userId=?`,
+			NotificationFollow, followerId, followedId)
 		return err
-	}
+	})
+}
 
-	return nil
+func (db *appdbimpl) ListFollowers(ctx context.Context, userId uint64, viewerId uint64, page Page) ([]UserEntry, error) {
+	return db.listFollows(ctx, `SELECT followerId FROM followers WHERE followedId=?`, userId, viewerId, page)
 }
 
-func (db *appdbimpl) DeleteFollowerUser(followerId uint64, followedId uint64) error {
+func (db *appdbimpl) ListFollowing(ctx context.Context, userId uint64, viewerId uint64, page Page) ([]UserEntry, error) {
+	return db.listFollows(ctx, `SELECT followedId FROM followers WHERE followerId=?`, userId, viewerId, page)
+}
+
+// listFollows returns a page of the users selected by `subquery` (that must select user IDs, and has `userId` as
+// parameter), sorted by ID. Users who banned the viewer, or banned by the viewer, are hidden.
+func (db *appdbimpl) listFollows(ctx context.Context, subquery string, userId uint64, viewerId uint64, page Page) ([]UserEntry, error) {
+	query := `SELECT u.id, u.username, f.followerId IS NOT NULL FROM users u
+		LEFT JOIN followers f ON f.followedId = u.id AND f.followerId = ?
+		WHERE u.id IN (` + subquery + `)
+		AND u.id NOT IN (SELECT userId FROM bans WHERE bannedUser=?)
+		AND u.id NOT IN (SELECT bannedUser FROM bans WHERE userId=?)`
+	args := []interface{}{viewerId, userId, viewerId, viewerId}
+	if page.After != nil {
+		query += ` AND u.id > ?`
+		args = append(args, page.After.ID)
+	}
+	query += ` ORDER BY u.id LIMIT ?`
+	args = append(args, page.Limit)
 
-	_, err := db.c.Exec(`DELETE FROM followers WHERE followerId=? AND followedId=?`, followerId, followedId)
+	rows, err := db.c.QueryContext(ctx, query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	users := make([]UserEntry, 0)
+	for rows.Next() {
+		var u UserEntry
+		err := rows.Scan(&u.User.ID, &u.User.Username, &u.FollowedByMe)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
 }
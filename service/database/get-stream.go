@@ -1,43 +1,40 @@
 package database
 
-import "time"
-
-func (db *appdbimpl) GetStream(userId uint64) ([]Photo, error) {
-
-	stm, err := db.c.Prepare("SELECT id, uuid, userId, date,likes, photoUrl FROM 'photos' WHERE userid IN (SELECT followedId FROM 'followers' WHERE followerId=?) AND userid NOT IN (SELECT bannedUser FROM 'bans' WHERE userId = ?) ORDER BY date DESC")
-	if err != nil {
-		return nil, err
+import "context"
+
+func (db *appdbimpl) GetStream(ctx context.Context, userId uint64, page Page) ([]Photo, error) {
+
+	query := `SELECT ` + photoDetailsColumns + ` FROM photos p
+		INNER JOIN users u ON u.id = p.userId
+		LEFT JOIN likes l ON l.photoId = p.id AND l.userId = ?
+		WHERE p.userId IN (SELECT followedId FROM followers WHERE followerId=?)
+		AND p.userId NOT IN (SELECT bannedUser FROM bans WHERE userId=?)
+		AND p.userId NOT IN (SELECT userId FROM bans WHERE bannedUser=?)`
+	args := []interface{}{userId, userId, userId, userId}
+	if page.After != nil {
+		query += ` AND (p.date < ? OR (p.date = ? AND p.id < ?))`
+		args = append(args, page.After.Time, page.After.Time, page.After.ID)
 	}
+	query += ` ORDER BY p.date DESC, p.id DESC LIMIT ?`
+	args = append(args, page.Limit)
 
-	rows, err := stm.Query(userId, userId)
+	rows, err := db.c.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	photos := make([]Photo, 0)
 
 	for rows.Next() {
-		var uuid string
-		var photoUserId uint64
-		var id uint64
-		var datetime time.Time
-		var likes uint64
-		var photoUrl string
-
-		err := rows.Scan(&id, &uuid, &photoUserId, &datetime, &likes, &photoUrl)
+		p, err := scanPhotoDetails(rows)
 		if err != nil {
 			return nil, err
 		}
-		p := Photo{
-			Id:       id,
-			UUID:     uuid,
-			Datetime: datetime,
-			UserId:   photoUserId,
-			Likes:    likes,
-			PhotoUrl: photoUrl,
-		}
 		photos = append(photos, p)
-
 	}
-	return photos, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return photos, db.attachComments(ctx, photos)
 }
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// QueryObserver is called after each operation of an instrumented AppDatabase, with the name of the method (e.g.,
+// "GetStream"), how long it took and the returned error (nil on success).
+type QueryObserver func(operation string, duration time.Duration, err error)
+
+// Instrument returns an AppDatabase that calls `observe` after each operation of `db` (e.g., to collect metrics about
+// query timings). Operations run in transactions (see WithTx) are observed too.
+func Instrument(db AppDatabase, observe QueryObserver) AppDatabase {
+	return &instrumented{db: db, observe: observe}
+}
+
+type instrumented struct {
+	db      AppDatabase
+	observe QueryObserver
+}
+
+// track calls the observer for the operation started at `start`. It's meant to be deferred, with a pointer to the named
+// error result of the method.
+func (i *instrumented) track(operation string, start time.Time, err *error) {
+	i.observe(operation, time.Since(start), *err)
+}
+
+func (i *instrumented) CreateUser(ctx context.Context, u User) (_ User, err error) {
+	defer i.track("CreateUser", time.Now(), &err)
+	return i.db.CreateUser(ctx, u)
+}
+
+func (i *instrumented) UpdateUser(ctx context.Context, u User) (_ User, err error) {
+	defer i.track("UpdateUser", time.Now(), &err)
+	return i.db.UpdateUser(ctx, u)
+}
+
+func (i *instrumented) GetUserByUsername(ctx context.Context, username string) (_ User, err error) {
+	defer i.track("GetUserByUsername", time.Now(), &err)
+	return i.db.GetUserByUsername(ctx, username)
+}
+
+func (i *instrumented) CreateSession(ctx context.Context, userId uint64, token string, expiredBefore time.Time) (err error) {
+	defer i.track("CreateSession", time.Now(), &err)
+	return i.db.CreateSession(ctx, userId, token, expiredBefore)
+}
+
+func (i *instrumented) GetSessionUser(ctx context.Context, token string, expiredBefore time.Time) (_ User, err error) {
+	defer i.track("GetSessionUser", time.Now(), &err)
+	return i.db.GetSessionUser(ctx, token, expiredBefore)
+}
+
+func (i *instrumented) BanUser(ctx context.Context, userId uint64, bannedUser uint64) (err error) {
+	defer i.track("BanUser", time.Now(), &err)
+	return i.db.BanUser(ctx, userId, bannedUser)
+}
+
+func (i *instrumented) DeleteBan(ctx context.Context, userId uint64, bannedUser uint64) (err error) {
+	defer i.track("DeleteBan", time.Now(), &err)
+	return i.db.DeleteBan(ctx, userId, bannedUser)
+}
+
+func (i *instrumented) IsBanned(ctx context.Context, userId uint64, bannedUser uint64) (_ bool, err error) {
+	defer i.track("IsBanned", time.Now(), &err)
+	return i.db.IsBanned(ctx, userId, bannedUser)
+}
+
+func (i *instrumented) FollowerUser(ctx context.Context, followerId uint64, followedId uint64) (err error) {
+	defer i.track("FollowerUser", time.Now(), &err)
+	return i.db.FollowerUser(ctx, followerId, followedId)
+}
+
+func (i *instrumented) DeleteFollowerUser(ctx context.Context, followerId uint64, followedId uint64) (err error) {
+	defer i.track("DeleteFollowerUser", time.Now(), &err)
+	return i.db.DeleteFollowerUser(ctx, followerId, followedId)
+}
+
+func (i *instrumented) ListFollowers(ctx context.Context, userId uint64, viewerId uint64, page Page) (_ []UserEntry, err error) {
+	defer i.track("ListFollowers", time.Now(), &err)
+	return i.db.ListFollowers(ctx, userId, viewerId, page)
+}
+
+func (i *instrumented) ListFollowing(ctx context.Context, userId uint64, viewerId uint64, page Page) (_ []UserEntry, err error) {
+	defer i.track("ListFollowing", time.Now(), &err)
+	return i.db.ListFollowing(ctx, userId, viewerId, page)
+}
+
+func (i *instrumented) GetStream(ctx context.Context, userId uint64, page Page) (_ []Photo, err error) {
+	defer i.track("GetStream", time.Now(), &err)
+	return i.db.GetStream(ctx, userId, page)
+}
+
+func (i *instrumented) GetUserProfile(ctx context.Context, userId uint64, viewerId uint64) (_ *Profile, err error) {
+	defer i.track("GetUserProfile", time.Now(), &err)
+	return i.db.GetUserProfile(ctx, userId, viewerId)
+}
+
+func (i *instrumented) SearchUsers(ctx context.Context, viewerId uint64, prefix string, limit int) (_ []UserEntry, err error) {
+	defer i.track("SearchUsers", time.Now(), &err)
+	return i.db.SearchUsers(ctx, viewerId, prefix, limit)
+}
+
+func (i *instrumented) LikePhoto(ctx context.Context, userId uint64, photoId uint64) (err error) {
+	defer i.track("LikePhoto", time.Now(), &err)
+	return i.db.LikePhoto(ctx, userId, photoId)
+}
+
+func (i *instrumented) DeleteLike(ctx context.Context, userId uint64, photoId uint64) (err error) {
+	defer i.track("DeleteLike", time.Now(), &err)
+	return i.db.DeleteLike(ctx, userId, photoId)
+}
+
+func (i *instrumented) ListLikes(ctx context.Context, photoId uint64, page Page) (_ []Like, err error) {
+	defer i.track("ListLikes", time.Now(), &err)
+	return i.db.ListLikes(ctx, photoId, page)
+}
+
+func (i *instrumented) ListLikedPhotos(ctx context.Context, userId uint64, page Page) (_ []Like, err error) {
+	defer i.track("ListLikedPhotos", time.Now(), &err)
+	return i.db.ListLikedPhotos(ctx, userId, page)
+}
+
+func (i *instrumented) GetPhoto(ctx context.Context, userId uint64, photoId uint64) (_ *Photo, err error) {
+	defer i.track("GetPhoto", time.Now(), &err)
+	return i.db.GetPhoto(ctx, userId, photoId)
+}
+
+func (i *instrumented) GetPhotoByID(ctx context.Context, photoId uint64) (_ *Photo, err error) {
+	defer i.track("GetPhotoByID", time.Now(), &err)
+	return i.db.GetPhotoByID(ctx, photoId)
+}
+
+func (i *instrumented) GetPhotoDetails(ctx context.Context, photoId uint64, viewerId uint64) (_ Photo, err error) {
+	defer i.track("GetPhotoDetails", time.Now(), &err)
+	return i.db.GetPhotoDetails(ctx, photoId, viewerId)
+}
+
+func (i *instrumented) UpdatePhotoCaption(ctx context.Context, userId uint64, photoId uint64, caption string, tags []string, mentions []Mention, editedAt time.Time) (err error) {
+	defer i.track("UpdatePhotoCaption", time.Now(), &err)
+	return i.db.UpdatePhotoCaption(ctx, userId, photoId, caption, tags, mentions, editedAt)
+}
+
+func (i *instrumented) ListTagPhotos(ctx context.Context, viewerId uint64, tag string, page Page) (_ []Photo, err error) {
+	defer i.track("ListTagPhotos", time.Now(), &err)
+	return i.db.ListTagPhotos(ctx, viewerId, tag, page)
+}
+
+func (i *instrumented) SearchTags(ctx context.Context, viewerId uint64, prefix string, limit int) (_ []Tag, err error) {
+	defer i.track("SearchTags", time.Now(), &err)
+	return i.db.SearchTags(ctx, viewerId, prefix, limit)
+}
+
+func (i *instrumented) CreatePhoto(ctx context.Context, p Photo) (_ Photo, err error) {
+	defer i.track("CreatePhoto", time.Now(), &err)
+	return i.db.CreatePhoto(ctx, p)
+}
+
+func (i *instrumented) DeletePhoto(ctx context.Context, userId uint64, photoId uint64) (err error) {
+	defer i.track("DeletePhoto", time.Now(), &err)
+	return i.db.DeletePhoto(ctx, userId, photoId)
+}
+
+func (i *instrumented) CommentPhoto(ctx context.Context, userId uint64, photoId uint64, c Comment) (_ *Comment, err error) {
+	defer i.track("CommentPhoto", time.Now(), &err)
+	return i.db.CommentPhoto(ctx, userId, photoId, c)
+}
+
+func (i *instrumented) DeleteComment(ctx context.Context, commentId uint64, userId uint64, photoId uint64) (err error) {
+	defer i.track("DeleteComment", time.Now(), &err)
+	return i.db.DeleteComment(ctx, commentId, userId, photoId)
+}
+
+func (i *instrumented) ListRenditions(ctx context.Context, photoId uint64) (_ []Rendition, err error) {
+	defer i.track("ListRenditions", time.Now(), &err)
+	return i.db.ListRenditions(ctx, photoId)
+}
+
+func (i *instrumented) ListComments(ctx context.Context, photoId uint64, page Page) (_ []Comment, err error) {
+	defer i.track("ListComments", time.Now(), &err)
+	return i.db.ListComments(ctx, photoId, page)
+}
+
+func (i *instrumented) ListNotifications(ctx context.Context, userId uint64, page Page) (_ []Notification, err error) {
+	defer i.track("ListNotifications", time.Now(), &err)
+	return i.db.ListNotifications(ctx, userId, page)
+}
+
+func (i *instrumented) CountUnreadNotifications(ctx context.Context, userId uint64) (_ int, err error) {
+	defer i.track("CountUnreadNotifications", time.Now(), &err)
+	return i.db.CountUnreadNotifications(ctx, userId)
+}
+
+func (i *instrumented) MarkNotificationsRead(ctx context.Context, userId uint64, lastId uint64, readAt time.Time) (err error) {
+	defer i.track("MarkNotificationsRead", time.Now(), &err)
+	return i.db.MarkNotificationsRead(ctx, userId, lastId, readAt)
+}
+
+func (i *instrumented) Ping(ctx context.Context) (err error) {
+	defer i.track("Ping", time.Now(), &err)
+	return i.db.Ping(ctx)
+}
+
+func (i *instrumented) CheckSchema(ctx context.Context) (err error) {
+	defer i.track("CheckSchema", time.Now(), &err)
+	return i.db.CheckSchema(ctx)
+}
+
+// WithTx observes the whole transaction, as well as each operation run in it.
+func (i *instrumented) WithTx(ctx context.Context, fn func(AppDatabase) error) (err error) {
+	defer i.track("WithTx", time.Now(), &err)
+	return i.db.WithTx(ctx, func(tx AppDatabase) error {
+		return fn(&instrumented{db: tx, observe: i.observe})
+	})
+}
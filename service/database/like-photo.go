@@ -1,56 +1,127 @@
 package database
 
-func (db *appdbimpl) LikePhoto(userId uint64, photoId uint64) error {
+import (
+	"context"
+	"time"
+)
 
-	var resL int
-	errL := db.c.QueryRow(`SELECT COUNT(*) FROM likes WHERE userId=? AND photoId=?`, userId, photoId).Scan(&resL)
-	if errL != nil {
-		return errL
-	}
-	if resL > 0 {
-		return ErrLikesExists
-	}
+func (db *appdbimpl) LikePhoto(ctx context.Context, userId uint64, photoId uint64) error {
+	date := time.Now().UTC()
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		res, err := tx.c.ExecContext(ctx, `INSERT INTO likes (userId,photoId,date) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+			userId, photoId, date)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		} else if affected == 0 {
+			return ErrLikesExists
+		}
+		if err := tx.updateLikesCount(ctx, photoId); err != nil {
+			return err
+		}
+		return tx.notifyPhotoOwner(ctx, Notification{Kind: NotificationLike, Actor: User{ID: userId}, PhotoId: photoId, Datetime: date})
+	})
+}
 
-	_, err := db.c.Exec(`INSERT INTO likes (userId,photoId) VALUES (?, ?)`,
-		userId, photoId)
-	if err != nil {
-		return err
-	}
+func (db *appdbimpl) DeleteLike(ctx context.Context, userId uint64, photoId uint64) error {
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		res, err := tx.c.ExecContext(ctx, `DELETE FROM likes WHERE userId=? AND photoId=?`, userId, photoId)
+		if err != nil {
+			return err
+		} else if err := checkDeleted(res, ErrLikeNotExists); err != nil {
+			return err
+		}
+		_, err = tx.c.ExecContext(ctx, `DELETE FROM notifications WHERE kind=? AND actorId=? AND photoId=?`,
+			NotificationLike, userId, photoId)
+		if err != nil {
+			return err
+		}
+		return tx.updateLikesCount(ctx, photoId)
+	})
+}
 
-	var cnt int
-	errP := db.c.QueryRow(`SELECT COUNT(*) FROM likes WHERE photoId=?`, photoId).Scan(&cnt)
-	if errP != nil {
-		return errP
-	}
+// updateLikesCount refreshes the denormalized likes counter of the photo. It must run in the same transaction as the
+// change to the likes table.
+func (db *appdbimpl) updateLikesCount(ctx context.Context, photoId uint64) error {
+	return db.updateLikesCounts(ctx, `id=?`, photoId)
+}
 
-	_, errU := db.c.Exec(`UPDATE photos SET likes=? WHERE id=?`, &cnt, photoId)
-	if errU != nil {
-		return errU
-	}
-	return nil
+// updateLikesCounts refreshes the likes counter of the photos matching `cond`. As in ListLikes, likes of users banned by
+// the owner of the photo are not counted, so the counters must be refreshed when a ban is added or removed too.
+func (db *appdbimpl) updateLikesCounts(ctx context.Context, cond string, args ...interface{}) error {
+	_, err := db.c.ExecContext(ctx, `UPDATE photos SET likes=(SELECT COUNT(*) FROM likes l WHERE l.photoId = photos.id
+		AND l.userId NOT IN (SELECT bannedUser FROM bans b WHERE b.userId = photos.userId))
+		WHERE `+cond, args...)
+	return err
 }
 
-func (db *appdbimpl) DeleteLike(userId uint64, photoId uint64) error {
-	_, err := db.c.Exec(`DELETE FROM likes WHERE userId=? AND photoId=?`, userId, photoId)
-	if err != nil {
-		return err
+func (db *appdbimpl) ListLikes(ctx context.Context, photoId uint64, page Page) ([]Like, error) {
+	// As for comments, likes of users banned by the owner of the photo are hidden
+	query := `SELECT u.id, u.username, l.date FROM likes l
+		INNER JOIN users u ON u.id = l.userId
+		INNER JOIN photos p ON p.id = l.photoId
+		WHERE l.photoId=?
+		AND l.userId NOT IN (SELECT bannedUser FROM bans WHERE userId = p.userId)`
+	args := []interface{}{photoId}
+	if page.After != nil {
+		query += ` AND (l.date < ? OR (l.date = ? AND l.userId < ?))`
+		args = append(args, page.After.Time, page.After.Time, page.After.ID)
 	}
+	query += ` ORDER BY l.date DESC, l.userId DESC LIMIT ?`
+	args = append(args, page.Limit)
 
-	var cnt int
-	err = db.c.QueryRow(`SELECT COUNT(*) FROM likes WHERE photoId=?`, photoId).Scan(&cnt)
+	rows, err := db.c.QueryContext(ctx, query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	res, err := db.c.Exec(`UPDATE photos SET likes=? WHERE id=?`, &cnt, photoId)
-	if err != nil {
-		return err
+	likes := make([]Like, 0)
+	for rows.Next() {
+		var l Like
+		err := rows.Scan(&l.User.ID, &l.User.Username, &l.Datetime)
+		if err != nil {
+			return nil, err
+		}
+		l.Photo.Id = photoId
+		likes = append(likes, l)
+	}
+	return likes, rows.Err()
+}
+
+func (db *appdbimpl) ListLikedPhotos(ctx context.Context, userId uint64, page Page) ([]Like, error) {
+	query := `SELECT ` + photoDetailsColumns + `, l.date FROM likes l
+		INNER JOIN photos p ON p.id = l.photoId
+		INNER JOIN users u ON u.id = p.userId
+		WHERE l.userId=?
+		AND p.userId NOT IN (SELECT bannedUser FROM bans WHERE userId=?)
+		AND p.userId NOT IN (SELECT userId FROM bans WHERE bannedUser=?)`
+	args := []interface{}{userId, userId, userId}
+	if page.After != nil {
+		query += ` AND (l.date < ? OR (l.date = ? AND l.photoId < ?))`
+		args = append(args, page.After.Time, page.After.Time, page.After.ID)
 	}
+	query += ` ORDER BY l.date DESC, l.photoId DESC LIMIT ?`
+	args = append(args, page.Limit)
 
-	_, errR := res.RowsAffected()
-	if errR != nil {
-		return errR
+	rows, err := db.c.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	likes := make([]Like, 0)
+	for rows.Next() {
+		var l Like
+		l.Photo, err = scanPhotoDetails(rows, &l.Datetime)
+		if err != nil {
+			return nil, err
+		}
+		l.User.ID = userId
+		likes = append(likes, l)
+	}
+	return likes, rows.Err()
 }
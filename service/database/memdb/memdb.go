@@ -0,0 +1,223 @@
+/*
+Package memdb is an in-memory implementation of database.AppDatabase, meant for tests: it needs no database file and
+every instance starts empty.
+
+It mirrors the behavior of the SQL implementations (the same errors, orders and ban rules), and it is checked by the
+same conformance suite (see the dbtest package). Constraints enforced by the SQL schema (e.g., foreign keys and primary
+keys) are reported with a generic error, as the SQL drivers do.
+
+All methods are safe for concurrent use. WithTx holds the lock for the whole transaction, and restores a snapshot of the
+data if the transaction is rolled back.
+*/
+package memdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+)
+
+// errConstraint is returned when an operation violates a constraint of the SQL schema.
+var errConstraint = errors.New("memdb: constraint violation")
+
+// pair is a relation between two IDs (e.g., follower and followed user).
+type pair struct {
+	a uint64
+	b uint64
+}
+
+type comment struct {
+	id      uint64
+	userId  uint64
+	photoId uint64
+	date    time.Time
+	text    string
+
+	mentions []database.Mention
+}
+
+// session is a session token of the user, created at date.
+type session struct {
+	userId uint64
+	date   time.Time
+}
+
+// notification is a notification of the user, read at readAt (zero if unread). Only the ID of the actor is stored.
+type notification struct {
+	userId uint64
+	readAt time.Time
+	database.Notification
+}
+
+// store contains the data. Values are stored by value, so that a shallow copy of the maps is a snapshot.
+type store struct {
+	users     map[uint64]database.User
+	sessions  map[string]session
+	bans      map[pair]bool // the user `a` banned `b`
+	followers map[pair]bool // the user `a` follows `b`
+	photos    map[uint64]database.Photo
+	likes     map[pair]time.Time // the user `a` liked the photo `b`
+	comments  map[uint64]comment
+
+	renditions map[uint64][]database.Rendition // by photo ID, sorted by size name
+	tags       map[uint64][]string             // by photo ID
+	mentions   map[uint64][]database.Mention   // in the caption, by photo ID
+
+	notifications map[uint64]notification
+
+	// Last ID assigned to users, photos, comments and notifications. As with AUTOINCREMENT, IDs are never reused.
+	lastUserID         uint64
+	lastPhotoID        uint64
+	lastCommentID      uint64
+	lastNotificationID uint64
+}
+
+func newStore() *store {
+	return &store{
+		users:     map[uint64]database.User{},
+		sessions:  map[string]session{},
+		bans:      map[pair]bool{},
+		followers: map[pair]bool{},
+		photos:    map[uint64]database.Photo{},
+		likes:     map[pair]time.Time{},
+		comments:  map[uint64]comment{},
+
+		renditions: map[uint64][]database.Rendition{},
+		tags:       map[uint64][]string{},
+		mentions:   map[uint64][]database.Mention{},
+
+		notifications: map[uint64]notification{},
+	}
+}
+
+func (s *store) clone() *store {
+	c := *s
+	c.users = cloneMap(s.users)
+	c.sessions = cloneMap(s.sessions)
+	c.bans = cloneMap(s.bans)
+	c.followers = cloneMap(s.followers)
+	c.photos = cloneMap(s.photos)
+	c.likes = cloneMap(s.likes)
+	c.comments = cloneMap(s.comments)
+	c.renditions = cloneMap(s.renditions)
+	c.tags = cloneMap(s.tags)
+	c.mentions = cloneMap(s.mentions)
+	c.notifications = cloneMap(s.notifications)
+	return &c
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+type memdb struct {
+	mu *sync.Mutex
+	s  *store
+
+	// inTx is true for the instance passed to the function of WithTx, which already holds the lock
+	inTx bool
+}
+
+// New returns a new, empty, in-memory AppDatabase.
+func New() database.AppDatabase {
+	return &memdb{
+		mu: &sync.Mutex{},
+		s:  newStore(),
+	}
+}
+
+// lock acquires the lock (unless in a transaction) and returns the function to release it.
+func (db *memdb) lock() func() {
+	if db.inTx {
+		return func() {}
+	}
+	db.mu.Lock()
+	return db.mu.Unlock
+}
+
+func (db *memdb) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// CheckSchema always succeeds: there is no schema in memory.
+func (db *memdb) CheckSchema(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (db *memdb) WithTx(ctx context.Context, fn func(database.AppDatabase) error) (err error) {
+	if db.inTx {
+		return fn(db)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	snapshot := db.s.clone()
+	defer func() {
+		if p := recover(); p != nil {
+			*db.s = *snapshot
+			panic(p)
+		} else if err != nil {
+			*db.s = *snapshot
+		}
+	}()
+	return fn(&memdb{mu: db.mu, s: db.s, inTx: true})
+}
+
+// isBanned returns whether the user `owner` banned `user`.
+func (s *store) isBanned(owner uint64, user uint64) bool {
+	return s.bans[pair{owner, user}]
+}
+
+// bannedEither returns whether one of the two users banned the other.
+func (s *store) bannedEither(a uint64, b uint64) bool {
+	return s.isBanned(a, b) || s.isBanned(b, a)
+}
+
+func (db *memdb) BanUser(ctx context.Context, userId uint64, bannedUser uint64) error {
+	defer db.lock()()
+	if db.s.bans[pair{userId, bannedUser}] {
+		return database.ErrBanExists
+	} else if _, ok := db.s.users[userId]; !ok {
+		return database.ErrUserNotExists
+	} else if _, ok := db.s.users[bannedUser]; !ok {
+		return database.ErrUserNotExists
+	}
+	db.s.bans[pair{userId, bannedUser}] = true
+	db.s.updateBannedLikes(userId, bannedUser)
+	return nil
+}
+
+func (db *memdb) DeleteBan(ctx context.Context, userId uint64, bannedUser uint64) error {
+	defer db.lock()()
+	if _, exists := db.s.bans[pair{userId, bannedUser}]; !exists {
+		return database.ErrBanNotExists
+	}
+	delete(db.s.bans, pair{userId, bannedUser})
+	db.s.updateBannedLikes(userId, bannedUser)
+	return nil
+}
+
+// updateBannedLikes refreshes the likes counters of the photos of the user liked by the (un)banned user.
+func (s *store) updateBannedLikes(userId uint64, bannedUser uint64) {
+	for l := range s.likes {
+		if l.a == bannedUser && s.photos[l.b].UserId == userId {
+			s.updateLikesCount(l.b)
+		}
+	}
+}
+
+func (db *memdb) IsBanned(ctx context.Context, userId uint64, bannedUser uint64) (bool, error) {
+	defer db.lock()()
+	return db.s.isBanned(userId, bannedUser), nil
+}
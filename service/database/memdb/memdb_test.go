@@ -0,0 +1,15 @@
+package memdb_test
+
+import (
+	"testing"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+	"sapienza/azzurra/wasaphoto/service/database/dbtest"
+	"sapienza/azzurra/wasaphoto/service/database/memdb"
+)
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) database.AppDatabase {
+		return memdb.New()
+	})
+}
@@ -0,0 +1,59 @@
+package memdb
+
+import (
+	"sort"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+)
+
+// resolveMentions returns the mentions of existing users, with their IDs, sorted by offset.
+func (s *store) resolveMentions(mentions []database.Mention) []database.Mention {
+	resolved := make([]database.Mention, 0, len(mentions))
+	for _, m := range mentions {
+		for _, u := range s.users {
+			if u.Username == m.User.Username {
+				m.User = u
+				resolved = append(resolved, m)
+				break
+			}
+		}
+	}
+	sort.SliceStable(resolved, func(i, j int) bool { return resolved[i].Offset < resolved[j].Offset })
+	return resolved
+}
+
+// currentMentions returns a copy of the stored mentions, with the current usernames.
+func (s *store) currentMentions(mentions []database.Mention) []database.Mention {
+	ret := make([]database.Mention, 0, len(mentions))
+	for _, m := range mentions {
+		m.User = s.users[m.User.ID]
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+// notifyMentions notifies the users mentioned by the author in the caption of the photo (if commentId is 0) or in the
+// comment, except the author and the users in `skip`. Users who banned the author, and users who can't see the photo,
+// are not notified.
+func (s *store) notifyMentions(authorId uint64, photoId uint64, commentId uint64, mentions []database.Mention, skip map[uint64]bool, date time.Time) {
+	ownerId := s.photos[photoId].UserId
+	notified := map[uint64]bool{authorId: true}
+	for _, m := range mentions {
+		id := m.User.ID
+		if notified[id] || skip[id] {
+			continue
+		}
+		notified[id] = true
+		if s.isBanned(id, authorId) || s.bannedEither(id, ownerId) {
+			continue
+		}
+		s.notify(id, database.Notification{
+			Kind:      database.NotificationMention,
+			Actor:     database.User{ID: authorId},
+			PhotoId:   photoId,
+			CommentId: commentId,
+			Datetime:  date.UTC(),
+		})
+	}
+}
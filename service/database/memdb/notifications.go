@@ -0,0 +1,107 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+)
+
+// notify saves the notification of the user, unless the user is the actor.
+func (s *store) notify(userId uint64, n database.Notification) {
+	if userId == n.Actor.ID {
+		return
+	}
+	s.lastNotificationID++
+	n.Id = s.lastNotificationID
+	n.Datetime = n.Datetime.UTC()
+	s.notifications[n.Id] = notification{userId: userId, Notification: n}
+}
+
+// deleteNotifications removes the notifications matching the function.
+func (s *store) deleteNotifications(match func(notification) bool) {
+	for id, n := range s.notifications {
+		if match(n) {
+			delete(s.notifications, id)
+		}
+	}
+}
+
+// groupKey identifies a group of notifications (see database.AppDatabase.ListNotifications).
+type groupKey struct {
+	kind    string
+	photoId uint64
+	readAt  time.Time
+	mention uint64 // the ID of the notification for mentions, which are not grouped
+}
+
+// notificationGroups returns the groups of visible notifications of the user: for each group, its last notification
+// (with the Others and Read fields filled), not sorted.
+func (s *store) notificationGroups(userId uint64, unread bool) []database.Notification {
+	last := map[groupKey]notification{}
+	actors := map[groupKey]map[uint64]bool{}
+	for _, n := range s.notifications {
+		if n.userId != userId || s.isBanned(userId, n.Actor.ID) || (unread && !n.readAt.IsZero()) {
+			continue
+		} else if p, ok := s.photos[n.PhotoId]; ok && s.isBanned(p.UserId, userId) {
+			continue
+		}
+		key := groupKey{kind: n.Kind, photoId: n.PhotoId, readAt: n.readAt}
+		if n.Kind == database.NotificationMention {
+			key.mention = n.Id
+		}
+		if n.Id > last[key].Id {
+			last[key] = n
+		}
+		if actors[key] == nil {
+			actors[key] = map[uint64]bool{}
+		}
+		actors[key][n.Actor.ID] = true
+	}
+
+	groups := make([]database.Notification, 0, len(last))
+	for key, n := range last {
+		g := n.Notification
+		g.Actor = s.users[g.Actor.ID]
+		g.PhotoOwnerId = s.photos[g.PhotoId].UserId
+		g.Others = uint64(len(actors[key]) - 1)
+		g.Read = !n.readAt.IsZero()
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+func (db *memdb) ListNotifications(ctx context.Context, userId uint64, page database.Page) ([]database.Notification, error) {
+	defer db.lock()()
+	notifications := make([]database.Notification, 0)
+	for _, n := range db.s.notificationGroups(userId, false) {
+		if before(n.Datetime, n.Id, page.After) {
+			notifications = append(notifications, n)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		a, b := notifications[i], notifications[j]
+		return a.Datetime.After(b.Datetime) || (a.Datetime.Equal(b.Datetime) && a.Id > b.Id)
+	})
+	if len(notifications) > page.Limit {
+		notifications = notifications[:page.Limit]
+	}
+	return notifications, nil
+}
+
+func (db *memdb) CountUnreadNotifications(ctx context.Context, userId uint64) (int, error) {
+	defer db.lock()()
+	return len(db.s.notificationGroups(userId, true)), nil
+}
+
+func (db *memdb) MarkNotificationsRead(ctx context.Context, userId uint64, lastId uint64, readAt time.Time) error {
+	defer db.lock()()
+	for id, n := range db.s.notifications {
+		if n.userId == userId && n.readAt.IsZero() && (lastId == 0 || id <= lastId) {
+			n.readAt = readAt.UTC()
+			db.s.notifications[id] = n
+		}
+	}
+	return nil
+}
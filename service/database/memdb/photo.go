@@ -0,0 +1,380 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+)
+
+// before returns whether the item (t, id) comes before the cursor in a list sorted by time and ID, most recent first.
+func before(t time.Time, id uint64, c *database.Cursor) bool {
+	return c == nil || t.Before(c.Time) || (t.Equal(c.Time) && id < c.ID)
+}
+
+// sortPhotos sorts the photos by date and ID, most recent first.
+func sortPhotos(photos []database.Photo) {
+	sort.Slice(photos, func(i, j int) bool {
+		a, b := photos[i], photos[j]
+		return a.Datetime.After(b.Datetime) || (a.Datetime.Equal(b.Datetime) && a.Id > b.Id)
+	})
+}
+
+// visibleComments returns the comments of the photo not written by users banned by its owner, oldest first.
+func (s *store) visibleComments(p database.Photo) []comment {
+	comments := make([]comment, 0)
+	for _, c := range s.comments {
+		if c.photoId == p.Id && !s.isBanned(p.UserId, c.userId) {
+			comments = append(comments, c)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		a, b := comments[i], comments[j]
+		return a.date.Before(b.date) || (a.date.Equal(b.date) && a.id < b.id)
+	})
+	return comments
+}
+
+func (s *store) toComment(c comment) database.Comment {
+	u := s.users[c.userId]
+	return database.Comment{
+		Id:       c.id,
+		User:     &u,
+		Datetime: c.date,
+		Comment:  c.text,
+		Mentions: s.currentMentions(c.mentions),
+	}
+}
+
+// photoDetails fills the details of the photo as seen by the viewer: author, comments count, like state and, if
+// `withComments` is true, the first database.CommentsPreviewSize comments and the mentions in the caption.
+func (s *store) photoDetails(p database.Photo, viewerId uint64, withComments bool) database.Photo {
+	comments := s.visibleComments(p)
+	p.Author = s.users[p.UserId]
+	p.CommentsCount = uint64(len(comments))
+	_, p.LikedByMe = s.likes[pair{viewerId, p.Id}]
+	if withComments {
+		p.Mentions = s.currentMentions(s.mentions[p.Id])
+		p.Comments = make([]database.Comment, 0)
+		for i := 0; i < len(comments) && i < database.CommentsPreviewSize; i++ {
+			p.Comments = append(p.Comments, s.toComment(comments[i]))
+		}
+	}
+	return p
+}
+
+func (db *memdb) CreatePhoto(ctx context.Context, p database.Photo) (database.Photo, error) {
+	defer db.lock()()
+	if _, ok := db.s.users[p.UserId]; !ok {
+		return p, errConstraint
+	}
+	db.s.lastPhotoID++
+	p.Id = db.s.lastPhotoID
+	p.Datetime = p.Datetime.UTC()
+	db.s.photos[p.Id] = database.Photo{
+		Id:       p.Id,
+		Datetime: p.Datetime,
+		UUID:     p.UUID,
+		Path:     p.Path,
+		Likes:    p.Likes,
+		UserId:   p.UserId,
+
+		TakenAt:     p.TakenAt.UTC(),
+		Orientation: p.Orientation,
+		Width:       p.Width,
+		Height:      p.Height,
+
+		Caption: p.Caption,
+	}
+	if len(p.Renditions) > 0 {
+		renditions := append([]database.Rendition(nil), p.Renditions...)
+		sort.Slice(renditions, func(i, j int) bool { return renditions[i].Size < renditions[j].Size })
+		for i := 1; i < len(renditions); i++ {
+			if renditions[i].Size == renditions[i-1].Size {
+				delete(db.s.photos, p.Id)
+				return p, errConstraint
+			}
+		}
+		db.s.renditions[p.Id] = renditions
+	}
+	db.s.setTags(p.Id, p.Tags)
+	p.Mentions = db.s.resolveMentions(p.Mentions)
+	if len(p.Mentions) > 0 {
+		db.s.mentions[p.Id] = p.Mentions
+	}
+	db.s.notifyMentions(p.UserId, p.Id, 0, p.Mentions, nil, p.Datetime)
+	return p, nil
+}
+
+func (db *memdb) ListRenditions(ctx context.Context, photoId uint64) ([]database.Rendition, error) {
+	defer db.lock()()
+	return append(make([]database.Rendition, 0), db.s.renditions[photoId]...), nil
+}
+
+func (db *memdb) DeletePhoto(ctx context.Context, userId uint64, photoId uint64) error {
+	defer db.lock()()
+	if p, ok := db.s.photos[photoId]; !ok || p.UserId != userId {
+		return nil
+	}
+	delete(db.s.photos, photoId)
+	delete(db.s.renditions, photoId)
+	delete(db.s.tags, photoId)
+	delete(db.s.mentions, photoId)
+	db.s.deleteNotifications(func(n notification) bool { return n.PhotoId == photoId })
+	for l := range db.s.likes {
+		if l.b == photoId {
+			delete(db.s.likes, l)
+		}
+	}
+	for id, c := range db.s.comments {
+		if c.photoId == photoId {
+			delete(db.s.comments, id)
+		}
+	}
+	return nil
+}
+
+func (db *memdb) GetPhoto(ctx context.Context, userId uint64, photoId uint64) (*database.Photo, error) {
+	defer db.lock()()
+	p, ok := db.s.photos[photoId]
+	if !ok || p.UserId != userId {
+		return nil, database.ErrPhotoNotExists
+	}
+	return &p, nil
+}
+
+func (db *memdb) GetPhotoByID(ctx context.Context, photoId uint64) (*database.Photo, error) {
+	defer db.lock()()
+	p, ok := db.s.photos[photoId]
+	if !ok {
+		return nil, database.ErrPhotoNotExists
+	}
+	return &p, nil
+}
+
+func (db *memdb) GetPhotoDetails(ctx context.Context, photoId uint64, viewerId uint64) (database.Photo, error) {
+	defer db.lock()()
+	p, ok := db.s.photos[photoId]
+	if !ok {
+		return database.Photo{}, database.ErrPhotoNotExists
+	}
+	return db.s.photoDetails(p, viewerId, true), nil
+}
+
+func (db *memdb) UpdatePhotoCaption(ctx context.Context, userId uint64, photoId uint64, caption string, tags []string, mentions []database.Mention, editedAt time.Time) error {
+	defer db.lock()()
+	p, ok := db.s.photos[photoId]
+	if !ok || p.UserId != userId {
+		return database.ErrPhotoNotExists
+	}
+	p.Caption = caption
+	p.EditedAt = editedAt.UTC()
+	db.s.photos[photoId] = p
+	db.s.setTags(photoId, tags)
+
+	// As in SQL, users already mentioned are not notified again, and notifications of users not mentioned anymore are
+	// removed
+	old := map[uint64]bool{}
+	for _, m := range db.s.mentions[photoId] {
+		old[m.User.ID] = true
+	}
+	resolved := db.s.resolveMentions(mentions)
+	mentioned := map[uint64]bool{}
+	for _, m := range resolved {
+		mentioned[m.User.ID] = true
+	}
+	delete(db.s.mentions, photoId)
+	if len(resolved) > 0 {
+		db.s.mentions[photoId] = resolved
+	}
+	db.s.deleteNotifications(func(n notification) bool {
+		return n.Kind == database.NotificationMention && n.PhotoId == photoId && n.CommentId == 0 && !mentioned[n.userId]
+	})
+	db.s.notifyMentions(userId, photoId, 0, resolved, old, editedAt)
+	return nil
+}
+
+func (db *memdb) GetStream(ctx context.Context, userId uint64, page database.Page) ([]database.Photo, error) {
+	defer db.lock()()
+	photos := make([]database.Photo, 0)
+	for _, p := range db.s.photos {
+		if db.s.followers[pair{userId, p.UserId}] && !db.s.bannedEither(userId, p.UserId) &&
+			before(p.Datetime, p.Id, page.After) {
+			photos = append(photos, p)
+		}
+	}
+	sortPhotos(photos)
+	if len(photos) > page.Limit {
+		photos = photos[:page.Limit]
+	}
+	for i := range photos {
+		photos[i] = db.s.photoDetails(photos[i], userId, true)
+	}
+	return photos, nil
+}
+
+func (db *memdb) LikePhoto(ctx context.Context, userId uint64, photoId uint64) error {
+	defer db.lock()()
+	p, ok := db.s.photos[photoId]
+	if _, exists := db.s.likes[pair{userId, photoId}]; exists {
+		return database.ErrLikesExists
+	} else if _, userOk := db.s.users[userId]; !ok || !userOk {
+		return errConstraint
+	}
+	date := time.Now().UTC()
+	db.s.likes[pair{userId, photoId}] = date
+	db.s.updateLikesCount(photoId)
+	db.s.notify(p.UserId, database.Notification{
+		Kind:     database.NotificationLike,
+		Actor:    database.User{ID: userId},
+		PhotoId:  photoId,
+		Datetime: date,
+	})
+	return nil
+}
+
+func (db *memdb) DeleteLike(ctx context.Context, userId uint64, photoId uint64) error {
+	defer db.lock()()
+	if _, exists := db.s.likes[pair{userId, photoId}]; !exists {
+		return database.ErrLikeNotExists
+	}
+	delete(db.s.likes, pair{userId, photoId})
+	db.s.deleteNotifications(func(n notification) bool {
+		return n.Kind == database.NotificationLike && n.Actor.ID == userId && n.PhotoId == photoId
+	})
+	db.s.updateLikesCount(photoId)
+	return nil
+}
+
+// updateLikesCount refreshes the likes counter of the photo: as in ListLikes, likes of users banned by the owner of the
+// photo are not counted.
+func (s *store) updateLikesCount(photoId uint64) {
+	p, ok := s.photos[photoId]
+	if !ok {
+		return
+	}
+	p.Likes = 0
+	for l := range s.likes {
+		if l.b == photoId && !s.isBanned(p.UserId, l.a) {
+			p.Likes++
+		}
+	}
+	s.photos[photoId] = p
+}
+
+func (db *memdb) ListLikes(ctx context.Context, photoId uint64, page database.Page) ([]database.Like, error) {
+	defer db.lock()()
+	p, ok := db.s.photos[photoId]
+	likes := make([]database.Like, 0)
+	if !ok {
+		return likes, nil
+	}
+	for l, date := range db.s.likes {
+		// As for comments, likes of users banned by the owner of the photo are hidden
+		if l.b == photoId && !db.s.isBanned(p.UserId, l.a) && before(date, l.a, page.After) {
+			likes = append(likes, database.Like{
+				User:     db.s.users[l.a],
+				Photo:    database.Photo{Id: photoId},
+				Datetime: date,
+			})
+		}
+	}
+	sort.Slice(likes, func(i, j int) bool {
+		a, b := likes[i], likes[j]
+		return a.Datetime.After(b.Datetime) || (a.Datetime.Equal(b.Datetime) && a.User.ID > b.User.ID)
+	})
+	if len(likes) > page.Limit {
+		likes = likes[:page.Limit]
+	}
+	return likes, nil
+}
+
+func (db *memdb) ListLikedPhotos(ctx context.Context, userId uint64, page database.Page) ([]database.Like, error) {
+	defer db.lock()()
+	likes := make([]database.Like, 0)
+	for l, date := range db.s.likes {
+		p := db.s.photos[l.b]
+		if l.a == userId && !db.s.bannedEither(userId, p.UserId) && before(date, p.Id, page.After) {
+			likes = append(likes, database.Like{
+				User:     database.User{ID: userId},
+				Photo:    p,
+				Datetime: date,
+			})
+		}
+	}
+	sort.Slice(likes, func(i, j int) bool {
+		a, b := likes[i], likes[j]
+		return a.Datetime.After(b.Datetime) || (a.Datetime.Equal(b.Datetime) && a.Photo.Id > b.Photo.Id)
+	})
+	if len(likes) > page.Limit {
+		likes = likes[:page.Limit]
+	}
+	for i := range likes {
+		likes[i].Photo = db.s.photoDetails(likes[i].Photo, userId, false)
+	}
+	return likes, nil
+}
+
+func (db *memdb) CommentPhoto(ctx context.Context, userId uint64, photoId uint64, c database.Comment) (*database.Comment, error) {
+	defer db.lock()()
+	if _, ok := db.s.users[userId]; !ok {
+		return nil, database.ErrUserNotExists
+	} else if _, ok := db.s.photos[photoId]; !ok {
+		return &c, errConstraint
+	}
+	db.s.lastCommentID++
+	stored := comment{
+		id:      db.s.lastCommentID,
+		userId:  userId,
+		photoId: photoId,
+		date:    time.Now().UTC(),
+		text:    c.Comment,
+
+		mentions: db.s.resolveMentions(c.Mentions),
+	}
+	db.s.comments[stored.id] = stored
+
+	// The owner of the photo is notified of the comment, and not of the mentions in it
+	ownerId := db.s.photos[photoId].UserId
+	db.s.notify(ownerId, database.Notification{
+		Kind:      database.NotificationComment,
+		Actor:     database.User{ID: userId},
+		PhotoId:   photoId,
+		CommentId: stored.id,
+		Datetime:  stored.date,
+	})
+	db.s.notifyMentions(userId, photoId, stored.id, stored.mentions, map[uint64]bool{ownerId: true}, stored.date)
+	ret := db.s.toComment(stored)
+	return &ret, nil
+}
+
+func (db *memdb) DeleteComment(ctx context.Context, commentId uint64, userId uint64, photoId uint64) error {
+	defer db.lock()()
+	if c, ok := db.s.comments[commentId]; !ok || c.userId != userId || c.photoId != photoId {
+		return database.ErrCommentNotExists
+	}
+	delete(db.s.comments, commentId)
+	db.s.deleteNotifications(func(n notification) bool { return n.CommentId == commentId })
+	return nil
+}
+
+func (db *memdb) ListComments(ctx context.Context, photoId uint64, page database.Page) ([]database.Comment, error) {
+	defer db.lock()()
+	ret := make([]database.Comment, 0)
+	p, ok := db.s.photos[photoId]
+	if !ok {
+		return ret, nil
+	}
+	for _, c := range db.s.visibleComments(p) {
+		// Oldest first: skip the comments up to the cursor
+		if page.After != nil && (c.date.Before(page.After.Time) || (c.date.Equal(page.After.Time) && c.id <= page.After.ID)) {
+			continue
+		}
+		if len(ret) == page.Limit {
+			break
+		}
+		ret = append(ret, db.s.toComment(c))
+	}
+	return ret, nil
+}
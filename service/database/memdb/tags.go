@@ -0,0 +1,79 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+)
+
+// setTags replaces the tags of the photo. As in the photo_tags table, duplicates are saved once.
+func (s *store) setTags(photoId uint64, tags []string) {
+	unique := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if !hasTag(unique, t) {
+			unique = append(unique, t)
+		}
+	}
+	if len(unique) == 0 {
+		delete(s.tags, photoId)
+		return
+	}
+	s.tags[photoId] = unique
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *memdb) ListTagPhotos(ctx context.Context, viewerId uint64, tag string, page database.Page) ([]database.Photo, error) {
+	defer db.lock()()
+	photos := make([]database.Photo, 0)
+	for id, tags := range db.s.tags {
+		p := db.s.photos[id]
+		if hasTag(tags, tag) && !db.s.bannedEither(viewerId, p.UserId) && before(p.Datetime, p.Id, page.After) {
+			photos = append(photos, p)
+		}
+	}
+	sortPhotos(photos)
+	if len(photos) > page.Limit {
+		photos = photos[:page.Limit]
+	}
+	for i := range photos {
+		photos[i] = db.s.photoDetails(photos[i], viewerId, true)
+	}
+	return photos, nil
+}
+
+func (db *memdb) SearchTags(ctx context.Context, viewerId uint64, prefix string, limit int) ([]database.Tag, error) {
+	defer db.lock()()
+	counts := map[string]uint64{}
+	for id, tags := range db.s.tags {
+		if db.s.bannedEither(viewerId, db.s.photos[id].UserId) {
+			continue
+		}
+		for _, t := range tags {
+			if strings.HasPrefix(t, prefix) {
+				counts[t]++
+			}
+		}
+	}
+	found := make([]database.Tag, 0, len(counts))
+	for name, n := range counts {
+		found = append(found, database.Tag{Name: name, Photos: n})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		return a.Photos > b.Photos || (a.Photos == b.Photos && a.Name < b.Name)
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
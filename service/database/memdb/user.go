@@ -0,0 +1,187 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/database"
+)
+
+func (db *memdb) CreateUser(ctx context.Context, u database.User) (database.User, error) {
+	defer db.lock()()
+	for _, other := range db.s.users {
+		if other.Username == u.Username {
+			return u, database.ErrUserExists
+		}
+	}
+	db.s.lastUserID++
+	u.ID = db.s.lastUserID
+	db.s.users[u.ID] = u
+	return u, nil
+}
+
+func (db *memdb) UpdateUser(ctx context.Context, u database.User) (database.User, error) {
+	defer db.lock()()
+	if _, ok := db.s.users[u.ID]; !ok {
+		return u, database.ErrUserNotExists
+	}
+	for _, other := range db.s.users {
+		if other.ID != u.ID && other.Username == u.Username {
+			return u, database.ErrUserExists
+		}
+	}
+	db.s.users[u.ID] = u
+	return u, nil
+}
+
+func (db *memdb) GetUserByUsername(ctx context.Context, username string) (database.User, error) {
+	defer db.lock()()
+	for _, u := range db.s.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return database.User{}, database.ErrUserNotExists
+}
+
+func (db *memdb) CreateSession(ctx context.Context, userId uint64, token string, expiredBefore time.Time) error {
+	defer db.lock()()
+	if _, ok := db.s.users[userId]; !ok {
+		return errConstraint
+	} else if _, ok := db.s.sessions[token]; ok {
+		return errConstraint
+	}
+	db.s.sessions[token] = session{userId: userId, date: time.Now()}
+	for t, s := range db.s.sessions {
+		if s.date.Before(expiredBefore) {
+			delete(db.s.sessions, t)
+		}
+	}
+	return nil
+}
+
+func (db *memdb) GetSessionUser(ctx context.Context, token string, expiredBefore time.Time) (database.User, error) {
+	defer db.lock()()
+	s, ok := db.s.sessions[token]
+	if !ok || s.date.Before(expiredBefore) {
+		return database.User{}, database.ErrSessionNotExists
+	}
+	return db.s.users[s.userId], nil
+}
+
+func (db *memdb) FollowerUser(ctx context.Context, followerId uint64, followedId uint64) error {
+	defer db.lock()()
+	if db.s.followers[pair{followerId, followedId}] {
+		return database.ErrFollowExists
+	} else if _, ok := db.s.users[followerId]; !ok {
+		return database.ErrUserNotExists
+	} else if _, ok := db.s.users[followedId]; !ok {
+		return database.ErrUserNotExists
+	}
+	db.s.followers[pair{followerId, followedId}] = true
+	db.s.notify(followedId, database.Notification{
+		Kind:     database.NotificationFollow,
+		Actor:    database.User{ID: followerId},
+		Datetime: time.Now(),
+	})
+	return nil
+}
+
+func (db *memdb) DeleteFollowerUser(ctx context.Context, followerId uint64, followedId uint64) error {
+	defer db.lock()()
+	if _, exists := db.s.followers[pair{followerId, followedId}]; !exists {
+		return database.ErrFollowNotExists
+	}
+	delete(db.s.followers, pair{followerId, followedId})
+	db.s.deleteNotifications(func(n notification) bool {
+		return n.Kind == database.NotificationFollow && n.Actor.ID == followerId && n.userId == followedId
+	})
+	return nil
+}
+
+func (db *memdb) ListFollowers(ctx context.Context, userId uint64, viewerId uint64, page database.Page) ([]database.UserEntry, error) {
+	defer db.lock()()
+	return db.s.listFollows(func(f pair) (uint64, bool) { return f.a, f.b == userId }, viewerId, page), nil
+}
+
+func (db *memdb) ListFollowing(ctx context.Context, userId uint64, viewerId uint64, page database.Page) ([]database.UserEntry, error) {
+	defer db.lock()()
+	return db.s.listFollows(func(f pair) (uint64, bool) { return f.b, f.a == userId }, viewerId, page), nil
+}
+
+// listFollows returns a page of the users selected by `sel` among the follow relationships, sorted by ID. Users who
+// banned the viewer, or banned by the viewer, are hidden.
+func (s *store) listFollows(sel func(pair) (uint64, bool), viewerId uint64, page database.Page) []database.UserEntry {
+	users := make([]database.UserEntry, 0)
+	for f := range s.followers {
+		id, ok := sel(f)
+		if !ok || s.bannedEither(id, viewerId) || (page.After != nil && id <= page.After.ID) {
+			continue
+		}
+		users = append(users, s.userEntry(id, viewerId))
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].User.ID < users[j].User.ID
+	})
+	if len(users) > page.Limit {
+		users = users[:page.Limit]
+	}
+	return users
+}
+
+func (s *store) userEntry(userId uint64, viewerId uint64) database.UserEntry {
+	return database.UserEntry{
+		User:         s.users[userId],
+		FollowedByMe: s.followers[pair{viewerId, userId}],
+	}
+}
+
+func (db *memdb) GetUserProfile(ctx context.Context, userId uint64, viewerId uint64) (*database.Profile, error) {
+	defer db.lock()()
+	u, ok := db.s.users[userId]
+	if !ok {
+		return nil, database.ErrUserNotExists
+	}
+
+	profile := database.Profile{
+		User:   &u,
+		Photos: make([]database.Photo, 0),
+	}
+	for _, p := range db.s.photos {
+		if p.UserId == userId {
+			profile.Photos = append(profile.Photos, db.s.photoDetails(p, viewerId, true))
+		}
+	}
+	sortPhotos(profile.Photos)
+	profile.Post = len(profile.Photos)
+	for f := range db.s.followers {
+		if f.a == userId && !db.s.bannedEither(f.b, viewerId) {
+			profile.Following++
+		}
+		if f.b == userId && !db.s.bannedEither(f.a, viewerId) {
+			profile.Follower++
+		}
+	}
+	return &profile, nil
+}
+
+func (db *memdb) SearchUsers(ctx context.Context, viewerId uint64, prefix string, limit int) ([]database.UserEntry, error) {
+	defer db.lock()()
+	prefix = strings.ToLower(prefix)
+	users := make([]database.UserEntry, 0)
+	for _, u := range db.s.users {
+		if strings.HasPrefix(strings.ToLower(u.Username), prefix) && !db.s.isBanned(u.ID, viewerId) {
+			users = append(users, db.s.userEntry(u.ID, viewerId))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		a, b := strings.ToLower(users[i].User.Username), strings.ToLower(users[j].User.Username)
+		return a < b || (a == b && users[i].User.ID < users[j].User.ID)
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// mentionKey identifies the text containing a mention: the caption of the photo (commentId is 0) or a comment.
+type mentionKey struct {
+	photoId   uint64
+	commentId uint64
+}
+
+// saveMentions resolves the usernames of the mentions and saves them, for the caption of the photo (if commentId is 0)
+// or for the comment. Mentions of users who don't exist are dropped. It returns the saved mentions.
+func (db *appdbimpl) saveMentions(ctx context.Context, photoId uint64, commentId uint64, mentions []Mention) ([]Mention, error) {
+	saved := make([]Mention, 0, len(mentions))
+	for _, m := range mentions {
+		err := db.c.QueryRowContext(ctx, `SELECT id, username FROM users WHERE username = ?`, m.User.Username).
+			Scan(&m.User.ID, &m.User.Username)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		_, err = db.c.ExecContext(ctx, `INSERT INTO mentions (photoId, commentId, userId, startOffset, length)
+			VALUES (?,?,?,?,?)`, photoId, nullID(commentId), m.User.ID, m.Offset, m.Length)
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, m)
+	}
+	return saved, nil
+}
+
+// notifyMentions notifies the users mentioned by the author in the caption of the photo (if commentId is 0) or in the
+// comment, except the author and the users in `skip`. Users who banned the author, and users who can't see the photo
+// (because of a ban with its owner), are not notified.
+func (db *appdbimpl) notifyMentions(ctx context.Context, authorId uint64, photoId uint64, commentId uint64, mentions []Mention, skip map[uint64]bool, date time.Time) error {
+	var ownerId uint64
+	if err := db.c.QueryRowContext(ctx, `SELECT userId FROM photos WHERE id = ?`, photoId).Scan(&ownerId); err != nil {
+		return err
+	}
+	notified := map[uint64]bool{authorId: true}
+	for _, m := range mentions {
+		if notified[m.User.ID] || skip[m.User.ID] {
+			continue
+		}
+		notified[m.User.ID] = true
+
+		var bans int
+		err := db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM bans
+			WHERE (userId = ? AND (bannedUser = ? OR bannedUser = ?)) OR (userId = ? AND bannedUser = ?)`,
+			m.User.ID, authorId, ownerId, ownerId, m.User.ID).Scan(&bans)
+		if err != nil {
+			return err
+		} else if bans > 0 {
+			continue
+		}
+		err = db.notify(ctx, m.User.ID, Notification{
+			Kind:      NotificationMention,
+			Actor:     User{ID: authorId},
+			PhotoId:   photoId,
+			CommentId: commentId,
+			Datetime:  date,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMentions returns the mentions matching the condition on `m` (the mentions table), by text, sorted by offset.
+func (db *appdbimpl) loadMentions(ctx context.Context, cond string, args ...interface{}) (map[mentionKey][]Mention, error) {
+	rows, err := db.c.QueryContext(ctx, `SELECT m.photoId, m.commentId, m.userId, u.username, m.startOffset, m.length
+		FROM mentions m INNER JOIN users u ON u.id = m.userId
+		WHERE `+cond+` ORDER BY m.startOffset`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := map[mentionKey][]Mention{}
+	for rows.Next() {
+		var key mentionKey
+		var commentId sql.NullInt64
+		var m Mention
+		if err := rows.Scan(&key.photoId, &commentId, &m.User.ID, &m.User.Username, &m.Offset, &m.Length); err != nil {
+			return nil, err
+		}
+		key.commentId = uint64(commentId.Int64)
+		mentions[key] = append(mentions[key], m)
+	}
+	return mentions, rows.Err()
+}
+
+// attachMentions loads the mentions in the captions of the photos and in their comments (already loaded).
+func (db *appdbimpl) attachMentions(ctx context.Context, photos []Photo) error {
+	if len(photos) == 0 {
+		return nil
+	}
+	photoIds := make([]interface{}, 0, len(photos))
+	commentIds := make([]interface{}, 0)
+	for _, p := range photos {
+		photoIds = append(photoIds, p.Id)
+		for _, c := range p.Comments {
+			commentIds = append(commentIds, c.Id)
+		}
+	}
+	cond := `(m.commentId IS NULL AND m.photoId IN (?` + strings.Repeat(",?", len(photoIds)-1) + `))`
+	if len(commentIds) > 0 {
+		cond += ` OR m.commentId IN (?` + strings.Repeat(",?", len(commentIds)-1) + `)`
+	}
+	mentions, err := db.loadMentions(ctx, cond, append(photoIds, commentIds...)...)
+	if err != nil {
+		return err
+	}
+
+	for i := range photos {
+		p := &photos[i]
+		p.Mentions = orEmpty(mentions[mentionKey{photoId: p.Id}])
+		for j := range p.Comments {
+			p.Comments[j].Mentions = orEmpty(mentions[mentionKey{photoId: p.Id, commentId: p.Comments[j].Id}])
+		}
+	}
+	return nil
+}
+
+// attachCommentMentions loads the mentions in the comments of the photo.
+func (db *appdbimpl) attachCommentMentions(ctx context.Context, photoId uint64, comments []Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(comments))
+	for _, c := range comments {
+		args = append(args, c.Id)
+	}
+	mentions, err := db.loadMentions(ctx, `m.commentId IN (?`+strings.Repeat(",?", len(args)-1)+`)`, args...)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Mentions = orEmpty(mentions[mentionKey{photoId: photoId, commentId: comments[i].Id}])
+	}
+	return nil
+}
+
+// orEmpty returns the mentions, or an empty slice if nil.
+func orEmpty(mentions []Mention) []Mention {
+	if mentions == nil {
+		return make([]Mention, 0)
+	}
+	return mentions
+}
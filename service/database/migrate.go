@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationsFS contains the SQL migrations, in a directory for each dialect. Each migration is a pair of files named
+// `<version>_<name>.up.sql` and `<version>_<name>.down.sql`, where version is a positive integer. Migrations are applied
+// in version order. Every change to the schema must be added for all dialects, with the same version.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationsFS embed.FS
+
+// Migration is a single schema change, with the SQL to apply it and to revert it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is the status of the database schema.
+type MigrationState struct {
+	// Current is the version of the last applied migration (0 for an empty database)
+	Current int
+
+	// Latest is the version of the last migration embedded in the executable
+	Latest int
+
+	// Pending are the migrations not yet applied, in order
+	Pending []Migration
+}
+
+// Migrations returns the list of all migrations embedded in the executable for the database driver, sorted by version.
+func Migrations(driver string) ([]Migration, error) {
+	d, err := dialectOf(driver)
+	if err != nil {
+		return nil, err
+	}
+	return migrations(d)
+}
+
+func migrations(d dialect) ([]Migration, error) {
+	dir := d.migrationsDir()
+	files, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, f := range files {
+		var direction string
+		var base string
+		switch {
+		case strings.HasSuffix(f.Name(), ".up.sql"):
+			direction, base = "up", strings.TrimSuffix(f.Name(), ".up.sql")
+		case strings.HasSuffix(f.Name(), ".down.sql"):
+			direction, base = "down", strings.TrimSuffix(f.Name(), ".down.sql")
+		default:
+			return nil, fmt.Errorf("invalid migration file name %q", f.Name())
+		}
+
+		v, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(v)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", f.Name())
+		}
+
+		content, err := fs.ReadFile(migrationsFS, dir+"/"+f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %q: %w", f.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("duplicated migration version %d", version)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	ret := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d is missing the up or down file", m.Version)
+		}
+		ret = append(ret, *m)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+	return ret, nil
+}
+
+// MigrationStatus returns the current status of the database schema. `driver` is the name of the driver used to open
+// `db` (DriverSQLite or DriverPostgres).
+func MigrationStatus(db *sql.DB, driver string) (MigrationState, error) {
+	d, err := dialectOf(driver)
+	if err != nil {
+		return MigrationState{}, err
+	}
+	return migrationStatus(db, d)
+}
+
+func migrationStatus(db *sql.DB, d dialect) (MigrationState, error) {
+	var state MigrationState
+	all, err := migrations(d)
+	if err != nil {
+		return state, err
+	}
+	if len(all) > 0 {
+		state.Latest = all[len(all)-1].Version
+	}
+
+	if err := createMigrationsTable(db); err != nil {
+		return state, err
+	}
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&state.Current)
+	if err != nil {
+		return state, fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for _, m := range all {
+		if m.Version > state.Current {
+			state.Pending = append(state.Pending, m)
+		}
+	}
+	return state, nil
+}
+
+// MigrateUp applies all pending migrations to the database. Each migration runs in its own transaction. It returns the
+// number of migrations applied.
+func MigrateUp(db *sql.DB, driver string) (int, error) {
+	d, err := dialectOf(driver)
+	if err != nil {
+		return 0, err
+	}
+	state, err := migrationStatus(db, d)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, m := range state.Pending {
+		err = runMigration(db, m.Up, func(tx *sql.Tx) error {
+			_, err := d.wrap(tx).ExecContext(context.Background(),
+				`INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return i, fmt.Errorf("applying migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	return len(state.Pending), nil
+}
+
+// MigrateDown reverts the last `steps` applied migrations. It returns the number of migrations reverted.
+func MigrateDown(db *sql.DB, driver string, steps int) (int, error) {
+	d, err := dialectOf(driver)
+	if err != nil {
+		return 0, err
+	}
+	state, err := migrationStatus(db, d)
+	if err != nil {
+		return 0, err
+	}
+	all, err := migrations(d)
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	for i := len(all) - 1; i >= 0 && reverted < steps; i-- {
+		m := all[i]
+		if m.Version > state.Current {
+			continue
+		}
+		err = runMigration(db, m.Down, func(tx *sql.Tx) error {
+			_, err := d.wrap(tx).ExecContext(context.Background(), `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("reverting migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		reverted++
+	}
+	return reverted, nil
+}
+
+// runMigration executes the migration SQL and the bookkeeping function in a single transaction.
+func runMigration(db *sql.DB, stmts string, bookkeeping func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(stmts); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = bookkeeping(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func createMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name TEXT NOT NULL,
+		appliedAt TIMESTAMP NOT NULL);`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+-- Initial schema, equivalent to the SQLite one
+CREATE TABLE users (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	-- The "C" collation compares bytes, as SQLite does: the search by prefix relies on it
+	username TEXT COLLATE "C" NOT NULL);
+
+CREATE TABLE bans (
+	userId BIGINT NOT NULL,
+	bannedUser BIGINT NOT NULL,
+	PRIMARY KEY(userId, bannedUser),
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(bannedUser) REFERENCES users(id));
+
+CREATE TABLE followers (
+	followerId BIGINT NOT NULL,
+	followedId BIGINT NOT NULL,
+	PRIMARY KEY(followerId, followedId),
+	FOREIGN KEY(followerId) REFERENCES users(id),
+	FOREIGN KEY(followedId) REFERENCES users(id));
+
+CREATE TABLE photos (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	uuid TEXT NOT NULL,
+	date TIMESTAMP NOT NULL,
+	userId BIGINT NOT NULL,
+	likes BIGINT NOT NULL,
+	photoUrl TEXT NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id));
+
+CREATE TABLE likes (
+	userId BIGINT NOT NULL,
+	photoId BIGINT NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(photoId) REFERENCES photos(id));
+
+CREATE TABLE comments (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	userId BIGINT NOT NULL,
+	photoId BIGINT NOT NULL,
+	date TIMESTAMP NOT NULL,
+	comment TEXT NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(photoId) REFERENCES photos(id));
+
+CREATE TABLE sessions (
+	token TEXT NOT NULL PRIMARY KEY,
+	userId BIGINT NOT NULL,
+	date TIMESTAMP NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id));
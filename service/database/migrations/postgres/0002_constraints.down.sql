@@ -0,0 +1,8 @@
+DROP INDEX likes_photo;
+DROP INDEX comments_photo;
+DROP INDEX followers_followed;
+DROP INDEX photos_user_date;
+
+ALTER TABLE likes DROP CONSTRAINT likes_pkey;
+
+DROP INDEX users_username;
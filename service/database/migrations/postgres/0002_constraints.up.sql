@@ -0,0 +1,11 @@
+-- Usernames are unique
+CREATE UNIQUE INDEX users_username ON users(username);
+
+-- A user can like a photo only once
+ALTER TABLE likes ADD PRIMARY KEY (userId, photoId);
+
+-- Indexes for the stream, the profile and the comments
+CREATE INDEX photos_user_date ON photos(userId, date);
+CREATE INDEX followers_followed ON followers(followedId);
+CREATE INDEX comments_photo ON comments(photoId, date);
+CREATE INDEX likes_photo ON likes(photoId);
@@ -0,0 +1,5 @@
+DROP INDEX likes_user;
+DROP INDEX likes_photo;
+ALTER TABLE likes DROP COLUMN date;
+
+CREATE INDEX likes_photo ON likes(photoId);
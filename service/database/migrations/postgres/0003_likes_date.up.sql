@@ -0,0 +1,7 @@
+-- Store when a like was added. The date of existing likes is unknown, so the migration time is used.
+ALTER TABLE likes ADD COLUMN date TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE likes ALTER COLUMN date DROP DEFAULT;
+
+DROP INDEX likes_photo;
+CREATE INDEX likes_photo ON likes(photoId, date);
+CREATE INDEX likes_user ON likes(userId, date);
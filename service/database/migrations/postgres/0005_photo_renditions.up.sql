@@ -0,0 +1,9 @@
+-- Resized versions of the photos (e.g., thumbnails). The original image is still in photos.photoUrl.
+CREATE TABLE photo_renditions (
+	photoId BIGINT NOT NULL,
+	size TEXT NOT NULL,
+	path TEXT NOT NULL,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	PRIMARY KEY(photoId, size),
+	FOREIGN KEY(photoId) REFERENCES photos(id));
@@ -0,0 +1,4 @@
+ALTER TABLE photos DROP COLUMN height;
+ALTER TABLE photos DROP COLUMN width;
+ALTER TABLE photos DROP COLUMN orientation;
+ALTER TABLE photos DROP COLUMN takenAt;
@@ -0,0 +1,5 @@
+-- Fields read from the metadata of the uploaded image. The dimensions of existing photos are unknown (0).
+ALTER TABLE photos ADD COLUMN takenAt TIMESTAMP;
+ALTER TABLE photos ADD COLUMN orientation INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE photos ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE photos ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
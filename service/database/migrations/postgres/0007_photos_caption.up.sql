@@ -0,0 +1,3 @@
+-- Caption of the photo, and when it was last edited (NULL if never)
+ALTER TABLE photos ADD COLUMN caption TEXT NOT NULL DEFAULT '';
+ALTER TABLE photos ADD COLUMN editedAt TIMESTAMP;
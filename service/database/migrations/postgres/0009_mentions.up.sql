@@ -0,0 +1,32 @@
+-- Mentions of users (@username) in captions (commentId is NULL) and in comments: the mention is the text of `length`
+-- characters at startOffset, including the '@'. Captions and comments saved before this migration have no mentions.
+CREATE TABLE mentions (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	photoId BIGINT NOT NULL,
+	commentId BIGINT,
+	userId BIGINT NOT NULL,
+	startOffset INTEGER NOT NULL,
+	length INTEGER NOT NULL,
+	FOREIGN KEY(photoId) REFERENCES photos(id),
+	FOREIGN KEY(commentId) REFERENCES comments(id),
+	FOREIGN KEY(userId) REFERENCES users(id));
+
+CREATE INDEX mentions_photo ON mentions(photoId, commentId);
+CREATE INDEX mentions_comment ON mentions(commentId);
+
+-- Notifications of the user userId: actorId did something (kind) about the photo and the comment, if any
+CREATE TABLE notifications (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	userId BIGINT NOT NULL,
+	kind TEXT NOT NULL,
+	actorId BIGINT NOT NULL,
+	photoId BIGINT,
+	commentId BIGINT,
+	date TIMESTAMP NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(actorId) REFERENCES users(id),
+	FOREIGN KEY(photoId) REFERENCES photos(id),
+	FOREIGN KEY(commentId) REFERENCES comments(id));
+
+CREATE INDEX notifications_user ON notifications(userId, date);
+CREATE INDEX notifications_photo ON notifications(photoId);
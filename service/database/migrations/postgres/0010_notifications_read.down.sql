@@ -0,0 +1,2 @@
+DROP INDEX notifications_unread;
+ALTER TABLE notifications DROP COLUMN readAt;
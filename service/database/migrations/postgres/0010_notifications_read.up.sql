@@ -0,0 +1,6 @@
+-- When the notification was marked as read (NULL if unread). Notifications marked as read together have the same
+-- time, and they are grouped together (e.g., "alice and 3 others liked your photo").
+ALTER TABLE notifications ADD COLUMN readAt TIMESTAMP;
+
+-- The unread notifications of a user
+CREATE INDEX notifications_unread ON notifications(userId, readAt);
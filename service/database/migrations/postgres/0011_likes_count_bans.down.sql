@@ -0,0 +1 @@
+UPDATE photos SET likes = (SELECT COUNT(*) FROM likes WHERE likes.photoId = photos.id);
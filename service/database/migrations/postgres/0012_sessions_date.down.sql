@@ -0,0 +1 @@
+DROP INDEX sessions_date;
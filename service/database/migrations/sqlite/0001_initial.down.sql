@@ -0,0 +1,7 @@
+DROP TABLE sessions;
+DROP TABLE comments;
+DROP TABLE likes;
+DROP TABLE photos;
+DROP TABLE followers;
+DROP TABLE bans;
+DROP TABLE users;
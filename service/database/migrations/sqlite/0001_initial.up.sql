@@ -0,0 +1,49 @@
+-- Initial schema. Tables are created only if missing, so databases created before the introduction of migrations
+-- are adopted as they are.
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL);
+
+CREATE TABLE IF NOT EXISTS bans (
+	userId INTEGER NOT NULL,
+	bannedUser INTEGER NOT NULL,
+	PRIMARY KEY(userId, bannedUser),
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(bannedUser) REFERENCES users(id));
+
+CREATE TABLE IF NOT EXISTS followers (
+	followerId INTEGER NOT NULL,
+	followedId INTEGER NOT NULL,
+	PRIMARY KEY(followerId, followedId),
+	FOREIGN KEY(followerId) REFERENCES users(id),
+	FOREIGN KEY(followedId) REFERENCES users(id));
+
+CREATE TABLE IF NOT EXISTS photos (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	uuid TEXT NOT NULL,
+	date TIMESTAMP NOT NULL,
+	userId INTEGER NOT NULL,
+	likes INTEGER NOT NULL,
+	photoUrl TEXT NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id));
+
+CREATE TABLE IF NOT EXISTS likes (
+	userId INTEGER NOT NULL,
+	photoId INTEGER NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(photoId) REFERENCES photos(id));
+
+CREATE TABLE IF NOT EXISTS comments (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	userId INTEGER NOT NULL,
+	photoId INTEGER NOT NULL,
+	date TIMESTAMP NOT NULL,
+	comment TEXT NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(photoId) REFERENCES photos(id));
+
+CREATE TABLE IF NOT EXISTS sessions (
+	token TEXT NOT NULL PRIMARY KEY,
+	userId INTEGER NOT NULL,
+	date TIMESTAMP NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id));
@@ -0,0 +1,15 @@
+DROP INDEX likes_photo;
+DROP INDEX comments_photo;
+DROP INDEX followers_followed;
+DROP INDEX photos_user_date;
+
+CREATE TABLE likes_old (
+	userId INTEGER NOT NULL,
+	photoId INTEGER NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(photoId) REFERENCES photos(id));
+INSERT INTO likes_old (userId, photoId) SELECT userId, photoId FROM likes;
+DROP TABLE likes;
+ALTER TABLE likes_old RENAME TO likes;
+
+DROP INDEX users_username;
@@ -0,0 +1,20 @@
+-- Usernames are unique
+CREATE UNIQUE INDEX users_username ON users(username);
+
+-- A user can like a photo only once: remove duplicated likes (if any) and rebuild the table with a primary key
+CREATE TABLE likes_new (
+	userId INTEGER NOT NULL,
+	photoId INTEGER NOT NULL,
+	PRIMARY KEY(userId, photoId),
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(photoId) REFERENCES photos(id));
+INSERT INTO likes_new (userId, photoId) SELECT DISTINCT userId, photoId FROM likes;
+DROP TABLE likes;
+ALTER TABLE likes_new RENAME TO likes;
+UPDATE photos SET likes = (SELECT COUNT(*) FROM likes WHERE likes.photoId = photos.id);
+
+-- Indexes for the stream, the profile and the comments
+CREATE INDEX photos_user_date ON photos(userId, date);
+CREATE INDEX followers_followed ON followers(followedId);
+CREATE INDEX comments_photo ON comments(photoId, date);
+CREATE INDEX likes_photo ON likes(photoId);
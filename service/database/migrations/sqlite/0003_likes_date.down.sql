@@ -0,0 +1,11 @@
+CREATE TABLE likes_old (
+	userId INTEGER NOT NULL,
+	photoId INTEGER NOT NULL,
+	PRIMARY KEY(userId, photoId),
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(photoId) REFERENCES photos(id));
+INSERT INTO likes_old (userId, photoId) SELECT userId, photoId FROM likes;
+DROP TABLE likes;
+ALTER TABLE likes_old RENAME TO likes;
+
+CREATE INDEX likes_photo ON likes(photoId);
@@ -0,0 +1,14 @@
+-- Store when a like was added. The date of existing likes is unknown, so the migration time is used.
+CREATE TABLE likes_new (
+	userId INTEGER NOT NULL,
+	photoId INTEGER NOT NULL,
+	date TIMESTAMP NOT NULL,
+	PRIMARY KEY(userId, photoId),
+	FOREIGN KEY(userId) REFERENCES users(id),
+	FOREIGN KEY(photoId) REFERENCES photos(id));
+INSERT INTO likes_new (userId, photoId, date) SELECT userId, photoId, CURRENT_TIMESTAMP FROM likes;
+DROP TABLE likes;
+ALTER TABLE likes_new RENAME TO likes;
+
+CREATE INDEX likes_photo ON likes(photoId, date);
+CREATE INDEX likes_user ON likes(userId, date);
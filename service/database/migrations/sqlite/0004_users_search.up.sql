@@ -0,0 +1,2 @@
+-- Case-insensitive index for the search of users by username prefix
+CREATE INDEX users_username_lower ON users(lower(username));
@@ -0,0 +1,2 @@
+ALTER TABLE photos DROP COLUMN editedAt;
+ALTER TABLE photos DROP COLUMN caption;
@@ -0,0 +1,3 @@
+DROP INDEX photo_tags_tag;
+DROP TABLE photo_tags;
+DROP TABLE tags;
@@ -0,0 +1,15 @@
+-- Hashtags of the photos, parsed from the captions. Names are in lower case, and compared byte by byte (the search by
+-- prefix relies on it). Captions saved before this migration are not parsed.
+CREATE TABLE tags (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE);
+
+CREATE TABLE photo_tags (
+	photoId INTEGER NOT NULL,
+	tagId INTEGER NOT NULL,
+	PRIMARY KEY(photoId, tagId),
+	FOREIGN KEY(photoId) REFERENCES photos(id),
+	FOREIGN KEY(tagId) REFERENCES tags(id));
+
+-- The photos with a tag
+CREATE INDEX photo_tags_tag ON photo_tags(tagId, photoId);
@@ -0,0 +1,6 @@
+DROP INDEX notifications_photo;
+DROP INDEX notifications_user;
+DROP TABLE notifications;
+DROP INDEX mentions_comment;
+DROP INDEX mentions_photo;
+DROP TABLE mentions;
@@ -0,0 +1,3 @@
+-- Likes of users banned by the owner of the photo are hidden, so they are not counted anymore
+UPDATE photos SET likes = (SELECT COUNT(*) FROM likes WHERE likes.photoId = photos.id
+	AND likes.userId NOT IN (SELECT bannedUser FROM bans WHERE bans.userId = photos.userId));
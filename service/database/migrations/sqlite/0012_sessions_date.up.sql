@@ -0,0 +1,2 @@
+-- Index for the removal of the expired sessions
+CREATE INDEX sessions_date ON sessions(date);
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// notify saves the notification of the user, unless the user is the actor. Only the ID of the actor is needed.
+func (db *appdbimpl) notify(ctx context.Context, userId uint64, n Notification) error {
+	if userId == n.Actor.ID {
+		return nil
+	}
+	_, err := db.c.ExecContext(ctx, `INSERT INTO notifications (userId, kind, actorId, photoId, commentId, date)
+		VALUES (?,?,?,?,?,?)`, userId, n.Kind, n.Actor.ID, nullID(n.PhotoId), nullID(n.CommentId), n.Datetime.UTC())
+	return err
+}
+
+// notifyPhotoOwner saves the notification of the owner of the photo (see notify).
+func (db *appdbimpl) notifyPhotoOwner(ctx context.Context, n Notification) error {
+	var ownerId uint64
+	if err := db.c.QueryRowContext(ctx, `SELECT userId FROM photos WHERE id = ?`, n.PhotoId).Scan(&ownerId); err != nil {
+		return err
+	}
+	return db.notify(ctx, ownerId, n)
+}
+
+// notificationGroups returns the query selecting the groups of visible notifications of a user (see
+// ListNotifications), with the ID of the last notification and the number of actors of each group. The parameters are
+// the user ID, three times. Only the unread notifications are selected if `unread` is true.
+func notificationGroups(unread bool) string {
+	query := `SELECT MAX(id) AS lastId, COUNT(DISTINCT actorId) AS actors FROM notifications
+		WHERE userId = ?
+		AND actorId NOT IN (SELECT bannedUser FROM bans WHERE userId = ?)
+		AND (photoId IS NULL OR photoId NOT IN (SELECT p.id FROM photos p
+			INNER JOIN bans b ON b.userId = p.userId WHERE b.bannedUser = ?))`
+	if unread {
+		query += ` AND readAt IS NULL`
+	}
+	// Mentions are not grouped: each one is in the group of its ID
+	return query + ` GROUP BY kind, photoId, readAt, CASE WHEN kind = '` + NotificationMention + `' THEN id ELSE 0 END`
+}
+
+func (db *appdbimpl) ListNotifications(ctx context.Context, userId uint64, page Page) ([]Notification, error) {
+	query := `SELECT n.id, n.kind, n.actorId, u.username, n.photoId, p.userId, n.commentId, n.date,
+			n.readAt IS NOT NULL, g.actors - 1
+		FROM (` + notificationGroups(false) + `) g
+		INNER JOIN notifications n ON n.id = g.lastId
+		INNER JOIN users u ON u.id = n.actorId
+		LEFT JOIN photos p ON p.id = n.photoId`
+	args := []interface{}{userId, userId, userId}
+	if page.After != nil {
+		query += ` WHERE (n.date < ? OR (n.date = ? AND n.id < ?))`
+		args = append(args, page.After.Time, page.After.Time, page.After.ID)
+	}
+	query += ` ORDER BY n.date DESC, n.id DESC LIMIT ?`
+	args = append(args, page.Limit)
+
+	rows, err := db.c.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]Notification, 0)
+	for rows.Next() {
+		var n Notification
+		var photoId, ownerId, commentId sql.NullInt64
+		err := rows.Scan(&n.Id, &n.Kind, &n.Actor.ID, &n.Actor.Username, &photoId, &ownerId, &commentId, &n.Datetime,
+			&n.Read, &n.Others)
+		if err != nil {
+			return nil, err
+		}
+		n.PhotoId = uint64(photoId.Int64)
+		n.PhotoOwnerId = uint64(ownerId.Int64)
+		n.CommentId = uint64(commentId.Int64)
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (db *appdbimpl) CountUnreadNotifications(ctx context.Context, userId uint64) (int, error) {
+	var count int
+	err := db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+notificationGroups(true)+`) g`, userId, userId, userId).
+		Scan(&count)
+	return count, err
+}
+
+func (db *appdbimpl) MarkNotificationsRead(ctx context.Context, userId uint64, lastId uint64, readAt time.Time) error {
+	query := `UPDATE notifications SET readAt = ? WHERE userId = ? AND readAt IS NULL`
+	args := []interface{}{readAt.UTC(), userId}
+	if lastId != 0 {
+		query += ` AND id <= ?`
+		args = append(args, lastId)
+	}
+	_, err := db.c.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// CommentsPreviewSize is the number of comments attached to the photos of the stream and of the profile
+const CommentsPreviewSize = 3
+
+// photoDetailsColumns selects a photo `p` with its author `u`, the number of comments and whether the viewer liked it.
+// The query must join `users u ON u.id = p.userId` and `LEFT JOIN likes l ON l.photoId = p.id AND l.userId = <viewer>`.
+const photoDetailsColumns = `p.id, p.uuid, p.userId, u.username, p.date, p.likes, p.photoUrl,
+	p.takenAt, p.orientation, p.width, p.height, p.caption, p.editedAt,
+	(SELECT COUNT(*) FROM comments c WHERE c.photoId = p.id
+		AND c.userId NOT IN (SELECT bannedUser FROM bans b WHERE b.userId = p.userId)),
+	l.userId IS NOT NULL`
+
+// scanPhotoDetails reads the columns in photoDetailsColumns, followed by `extra` columns (if any).
+func scanPhotoDetails(rows *sql.Rows, extra ...interface{}) (Photo, error) {
+	var p Photo
+	var takenAt, editedAt sql.NullTime
+	dest := []interface{}{&p.Id, &p.UUID, &p.UserId, &p.Author.Username, &p.Datetime, &p.Likes, &p.Path,
+		&takenAt, &p.Orientation, &p.Width, &p.Height, &p.Caption, &editedAt, &p.CommentsCount, &p.LikedByMe}
+	err := rows.Scan(append(dest, extra...)...)
+	p.Author.ID = p.UserId
+	p.TakenAt = takenAt.Time
+	p.EditedAt = editedAt.Time
+	return p, err
+}
+
+// nullTime returns the time in UTC, or NULL if it's zero.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// nullID returns the ID, or NULL if it's 0.
+func nullID(id uint64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// attachComments loads the first CommentsPreviewSize comments of each photo, with a single query, and then the mentions
+// in the captions and in the comments. As in ListComments, comments written by users banned by the owner of the photo
+// are hidden.
+func (db *appdbimpl) attachComments(ctx context.Context, photos []Photo) error {
+	if len(photos) == 0 {
+		return nil
+	}
+
+	byId := make(map[uint64]*Photo, len(photos))
+	args := make([]interface{}, 0, len(photos)+1)
+	for i := range photos {
+		photos[i].Comments = make([]Comment, 0)
+		byId[photos[i].Id] = &photos[i]
+		args = append(args, photos[i].Id)
+	}
+	args = append(args, CommentsPreviewSize)
+
+	rows, err := db.c.QueryContext(ctx, `SELECT id, photoId, userId, username, date, comment FROM (
+			SELECT c.id, c.photoId, c.userId, u.username, c.date, c.comment,
+				ROW_NUMBER() OVER (PARTITION BY c.photoId ORDER BY c.date, c.id) AS rn
+			FROM comments c INNER JOIN users u ON u.id = c.userId INNER JOIN photos p ON p.id = c.photoId
+			WHERE c.photoId IN (?`+strings.Repeat(",?", len(photos)-1)+`)
+			AND c.userId NOT IN (SELECT bannedUser FROM bans WHERE userId = p.userId)
+		) AS preview WHERE rn <= ? ORDER BY photoId, date, id`, args...)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var photoId uint64
+		var c Comment
+		var u User
+		var datetime time.Time
+		err := rows.Scan(&c.Id, &photoId, &u.ID, &u.Username, &datetime, &c.Comment)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		c.User = &u
+		c.Datetime = datetime
+		p := byId[photoId]
+		p.Comments = append(p.Comments, c)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return db.attachMentions(ctx, photos)
+}
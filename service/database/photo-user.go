@@ -1,54 +1,188 @@
 package database
 
-import "time"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
 
-func (db *appdbimpl) CreatePhoto(p Photo) (Photo, error) {
+func (db *appdbimpl) CreatePhoto(ctx context.Context, p Photo) (Photo, error) {
+	err := db.withTx(ctx, func(tx *appdbimpl) error {
+		err := tx.c.QueryRowContext(ctx, `INSERT INTO photos (date,userid,uuid,likes, photourl, takenAt, orientation, width, height, caption)
+			VALUES (?,?,?,?,?,?,?,?,?,?) RETURNING id`,
+			p.Datetime.UTC(), p.UserId, p.UUID, p.Likes, p.Path, nullTime(p.TakenAt), p.Orientation, p.Width, p.Height,
+			p.Caption).Scan(&p.Id)
+		if err != nil {
+			return err
+		}
+		for _, r := range p.Renditions {
+			_, err := tx.c.ExecContext(ctx, `INSERT INTO photo_renditions (photoId, size, path, width, height) VALUES (?,?,?,?,?)`,
+				p.Id, r.Size, r.Path, r.Width, r.Height)
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.setPhotoTags(ctx, p.Id, p.Tags); err != nil {
+			return err
+		}
+		p.Mentions, err = tx.saveMentions(ctx, p.Id, 0, p.Mentions)
+		if err != nil {
+			return err
+		}
+		return tx.notifyMentions(ctx, p.UserId, p.Id, 0, p.Mentions, nil, p.Datetime)
+	})
+	return p, err
+}
 
-	res, err := db.c.Exec(`INSERT INTO photos (id,date,userid,uuid,likes, photourl) VALUES (NULL, ?,?,?,?,?)`,
-		p.Datetime, p.UserId, p.UUID, p.Likes, p.PhotoUrl)
+func (db *appdbimpl) ListRenditions(ctx context.Context, photoId uint64) ([]Rendition, error) {
+	rows, err := db.c.QueryContext(ctx, `SELECT size, path, width, height FROM photo_renditions WHERE photoId = ? ORDER BY size`, photoId)
 	if err != nil {
-		return p, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	lastInsertID, err := res.LastInsertId()
-	if err != nil {
-		return p, err
+	renditions := make([]Rendition, 0)
+	for rows.Next() {
+		var r Rendition
+		if err := rows.Scan(&r.Size, &r.Path, &r.Width, &r.Height); err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, r)
 	}
+	return renditions, rows.Err()
+}
 
-	p.Id = uint64(lastInsertID)
-
-	return p, nil
+func (db *appdbimpl) DeletePhoto(ctx context.Context, userId uint64, photoId uint64) error {
+	// Likes, comments, renditions, tags, mentions and notifications are removed together with the photo (before it, as
+	// they reference it)
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		for _, query := range []string{
+			`DELETE FROM notifications WHERE photoId IN (SELECT id FROM photos WHERE userid = ? AND id = ?)`,
+			`DELETE FROM mentions WHERE photoId IN (SELECT id FROM photos WHERE userid = ? AND id = ?)`,
+			`DELETE FROM photo_tags WHERE photoId IN (SELECT id FROM photos WHERE userid = ? AND id = ?)`,
+			`DELETE FROM photo_renditions WHERE photoId IN (SELECT id FROM photos WHERE userid = ? AND id = ?)`,
+			`DELETE FROM likes WHERE photoId IN (SELECT id FROM photos WHERE userid = ? AND id = ?)`,
+			`DELETE FROM comments WHERE photoId IN (SELECT id FROM photos WHERE userid = ? AND id = ?)`,
+			`DELETE FROM photos WHERE userid = ? AND id = ?`,
+		} {
+			if _, err := tx.c.ExecContext(ctx, query, userId, photoId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (db *appdbimpl) DeletePhoto(userId uint64, photoId uint64) error {
-	_, err := db.c.Exec(`DELETE FROM photos WHERE userid = ? AND id = ?`, userId, photoId)
-	if err != nil {
-		return err
+func (db *appdbimpl) GetPhoto(ctx context.Context, userid uint64, id uint64) (*Photo, error) {
+
+	p := Photo{
+		Id:     id,
+		UserId: userid,
 	}
-	return nil
+	var takenAt, editedAt sql.NullTime
+	err := db.c.QueryRowContext(ctx, `SELECT uuid,date,photoUrl,likes,takenAt,orientation,width,height,caption,editedAt
+		FROM photos WHERE userid=? AND id = ?`, userid, id).Scan(&p.UUID, &p.Datetime, &p.Path, &p.Likes, &takenAt,
+		&p.Orientation, &p.Width, &p.Height, &p.Caption, &editedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPhotoNotExists
+	} else if err != nil {
+		return nil, err
+	}
+	p.TakenAt = takenAt.Time
+	p.EditedAt = editedAt.Time
+	return &p, nil
+
 }
 
-func (db *appdbimpl) GetPhoto(userid uint64, id uint64) (*Photo, error) {
+func (db *appdbimpl) GetPhotoByID(ctx context.Context, id uint64) (*Photo, error) {
+	var userid uint64
+	err := db.c.QueryRowContext(ctx, `SELECT userId FROM photos WHERE id = ?`, id).Scan(&userid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPhotoNotExists
+	} else if err != nil {
+		return nil, err
+	}
+	return db.GetPhoto(ctx, userid, id)
+}
 
-	stm, err := db.c.Prepare("SELECT uuid,date,photoUrl,likes FROM photos WHERE userid=? AND id = ?")
+func (db *appdbimpl) GetPhotoDetails(ctx context.Context, photoId uint64, viewerId uint64) (Photo, error) {
+	rows, err := db.c.QueryContext(ctx, `SELECT `+photoDetailsColumns+` FROM photos p
+		INNER JOIN users u ON u.id = p.userId
+		LEFT JOIN likes l ON l.photoId = p.id AND l.userId = ?
+		WHERE p.id = ?`, viewerId, photoId)
 	if err != nil {
-		return nil, err
+		return Photo{}, err
+	}
+	var photos []Photo
+	for rows.Next() {
+		p, err := scanPhotoDetails(rows)
+		if err != nil {
+			_ = rows.Close()
+			return Photo{}, err
+		}
+		photos = append(photos, p)
+	}
+	// The rows are closed before loading the comments: inside a transaction, there is a single connection
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return Photo{}, err
+	} else if len(photos) == 0 {
+		return Photo{}, ErrPhotoNotExists
 	}
 
-	var uuid string
-	var likes uint64
-	date := time.Now()
-	photoUrl := ""
-	if err := stm.QueryRow(userid, id).Scan(&uuid, &date, &photoUrl, &likes); err != nil {
-		return nil, err
+	if err := db.attachComments(ctx, photos); err != nil {
+		return Photo{}, err
 	}
-	return &Photo{
-		Id:       id,
-		UUID:     uuid,
-		Datetime: date,
-		UserId:   userid,
-		Likes:    likes,
-		PhotoUrl: photoUrl,
-	}, nil
+	return photos[0], nil
+}
+
+func (db *appdbimpl) UpdatePhotoCaption(ctx context.Context, userId uint64, photoId uint64, caption string, tags []string, mentions []Mention, editedAt time.Time) error {
+	return db.withTx(ctx, func(tx *appdbimpl) error {
+		res, err := tx.c.ExecContext(ctx, `UPDATE photos SET caption = ?, editedAt = ? WHERE userId = ? AND id = ?`,
+			caption, editedAt.UTC(), userId, photoId)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrPhotoNotExists
+		}
+		if err := tx.setPhotoTags(ctx, photoId, tags); err != nil {
+			return err
+		}
+
+		// Users already mentioned in the caption are not notified again
+		old, err := tx.loadMentions(ctx, `m.photoId = ? AND m.commentId IS NULL`, photoId)
+		if err != nil {
+			return err
+		}
+		mentioned := map[uint64]bool{}
+		for _, m := range old[mentionKey{photoId: photoId}] {
+			mentioned[m.User.ID] = true
+		}
+		if _, err := tx.c.ExecContext(ctx, `DELETE FROM mentions WHERE photoId = ? AND commentId IS NULL`, photoId); err != nil {
+			return err
+		}
+		saved, err := tx.saveMentions(ctx, photoId, 0, mentions)
+		if err != nil {
+			return err
+		}
 
+		// Notifications of users not mentioned anymore are removed
+		query := `DELETE FROM notifications WHERE kind = ? AND photoId = ? AND commentId IS NULL`
+		args := []interface{}{NotificationMention, photoId}
+		if len(saved) > 0 {
+			query += ` AND userId NOT IN (?` + strings.Repeat(",?", len(saved)-1) + `)`
+			for _, m := range saved {
+				args = append(args, m.User.ID)
+			}
+		}
+		if _, err := tx.c.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		return tx.notifyMentions(ctx, userId, photoId, 0, saved, mentioned, editedAt)
+	})
 }
@@ -1,57 +1,71 @@
 package database
 
-func (db *appdbimpl) GetUserProfile(userId uint64) (*Profile, error) {
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+func (db *appdbimpl) GetUserProfile(ctx context.Context, userId uint64, viewerId uint64) (*Profile, error) {
 	var username string
-	errU := db.c.QueryRow(`SELECT username FROM users WHERE id=?`, userId).Scan(&username)
-	if errU != nil {
+	errU := db.c.QueryRowContext(ctx, `SELECT username FROM users WHERE id=?`, userId).Scan(&username)
+	if errors.Is(errU, sql.ErrNoRows) {
 		return nil, ErrUserNotExists
+	} else if errU != nil {
+		return nil, errU
 	}
 
 	var cntP int
-	errP := db.c.QueryRow(`SELECT COUNT(*) FROM photos WHERE userId=?`, userId).Scan(&cntP)
+	errP := db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM photos WHERE userId=?`, userId).Scan(&cntP)
 	if errP != nil {
 		return nil, errP
 	}
 
+	// The counts hide the users hidden by ListFollowers and ListFollowing: who banned the viewer, or is banned by them
 	var cntF int
-	errF := db.c.QueryRow(`SELECT COUNT(*) FROM followers WHERE followerId=?`, userId).Scan(&cntF)
+	errF := db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM followers WHERE followerId=?
+		AND followedId NOT IN (SELECT userId FROM bans WHERE bannedUser=?)
+		AND followedId NOT IN (SELECT bannedUser FROM bans WHERE userId=?)`, userId, viewerId, viewerId).Scan(&cntF)
 	if errF != nil {
 		return nil, errF
 	}
 
 	var cntD int
-	errD := db.c.QueryRow(`SELECT COUNT(*) FROM followers WHERE followedId=?`, userId).Scan(&cntD)
+	errD := db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM followers WHERE followedId=?
+		AND followerId NOT IN (SELECT userId FROM bans WHERE bannedUser=?)
+		AND followerId NOT IN (SELECT bannedUser FROM bans WHERE userId=?)`, userId, viewerId, viewerId).Scan(&cntD)
 	if errD != nil {
 		return nil, errD
 	}
 
-	stm, err := db.c.Prepare(`SELECT photoUrl,likes FROM photos WHERE userId=?`)
-	if err != nil {
-		return nil, err
-	}
-	rows, err := stm.Query(userId)
+	rows, err := db.c.QueryContext(ctx, `SELECT `+photoDetailsColumns+` FROM photos p
+		INNER JOIN users u ON u.id = p.userId
+		LEFT JOIN likes l ON l.photoId = p.id AND l.userId = ?
+		WHERE p.userId=? ORDER BY p.date DESC, p.id DESC`, viewerId, userId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	photos := make([]Photo, 0)
 
 	for rows.Next() {
-		var pathPhoto string
-		var likes uint64
-		err := rows.Scan(&pathPhoto, &likes)
+		p, err := scanPhotoDetails(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		p := Photo{
-			Likes:    likes,
-			PhotoUrl: pathPhoto,
-		}
 		photos = append(photos, p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := db.attachComments(ctx, photos); err != nil {
+		return nil, err
+	}
 
 	u := User{
+		ID:       userId,
 		Username: username,
 	}
 
@@ -63,3 +77,31 @@ func (db *appdbimpl) GetUserProfile(userId uint64) (*Profile, error) {
 		Photos:    photos,
 	}, nil
 }
+
+func (db *appdbimpl) SearchUsers(ctx context.Context, viewerId uint64, prefix string, limit int) ([]UserEntry, error) {
+	// The range on lower(username) uses the users_username_lower index. Usernames contain only ASCII characters, so
+	// the upper bound is the prefix with the last character incremented.
+	from := strings.ToLower(prefix)
+	to := from[:len(from)-1] + string(from[len(from)-1]+1)
+
+	rows, err := db.c.QueryContext(ctx, `SELECT u.id, u.username, f.followerId IS NOT NULL FROM users u
+		LEFT JOIN followers f ON f.followedId = u.id AND f.followerId = ?
+		WHERE lower(u.username) >= ? AND lower(u.username) < ?
+		AND u.id NOT IN (SELECT userId FROM bans WHERE bannedUser=?)
+		ORDER BY lower(u.username) LIMIT ?`, viewerId, from, to, viewerId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]UserEntry, 0)
+	for rows.Next() {
+		var u UserEntry
+		err := rows.Scan(&u.User.ID, &u.User.Username, &u.FollowedByMe)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
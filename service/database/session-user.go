@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (db *appdbimpl) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	var u User
+	err := db.c.QueryRowContext(ctx, `SELECT id, username FROM users WHERE username=?`, username).Scan(&u.ID, &u.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrUserNotExists
+	} else if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+func (db *appdbimpl) CreateSession(ctx context.Context, userId uint64, token string, expiredBefore time.Time) error {
+	_, err := db.c.ExecContext(ctx, `INSERT INTO sessions (token,userId,date) VALUES (?, ?, ?)`,
+		token, userId, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	// Expired sessions are removed at each login, so that the table doesn't grow without bound
+	_, err = db.c.ExecContext(ctx, `DELETE FROM sessions WHERE date < ?`, expiredBefore.UTC())
+	return err
+}
+
+func (db *appdbimpl) GetSessionUser(ctx context.Context, token string, expiredBefore time.Time) (User, error) {
+	var u User
+	err := db.c.QueryRowContext(ctx, `SELECT u.id, u.username FROM sessions s INNER JOIN users u ON u.id = s.userId
+		WHERE s.token=? AND s.date >= ?`, token, expiredBefore.UTC()).Scan(&u.ID, &u.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrSessionNotExists
+	} else if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"unicode/utf8"
+)
+
+// setPhotoTags replaces the tags of the photo, creating the missing ones. It must run in a transaction.
+func (db *appdbimpl) setPhotoTags(ctx context.Context, photoId uint64, tags []string) error {
+	if _, err := db.c.ExecContext(ctx, `DELETE FROM photo_tags WHERE photoId = ?`, photoId); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := db.c.ExecContext(ctx, `INSERT INTO tags (name) VALUES (?) ON CONFLICT DO NOTHING`, tag); err != nil {
+			return err
+		}
+		_, err := db.c.ExecContext(ctx, `INSERT INTO photo_tags (photoId, tagId)
+			VALUES (?, (SELECT id FROM tags WHERE name = ?)) ON CONFLICT DO NOTHING`, photoId, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *appdbimpl) ListTagPhotos(ctx context.Context, viewerId uint64, tag string, page Page) ([]Photo, error) {
+	query := `SELECT ` + photoDetailsColumns + ` FROM photo_tags pt
+		INNER JOIN tags t ON t.id = pt.tagId
+		INNER JOIN photos p ON p.id = pt.photoId
+		INNER JOIN users u ON u.id = p.userId
+		LEFT JOIN likes l ON l.photoId = p.id AND l.userId = ?
+		WHERE t.name = ?
+		AND p.userId NOT IN (SELECT bannedUser FROM bans WHERE userId=?)
+		AND p.userId NOT IN (SELECT userId FROM bans WHERE bannedUser=?)`
+	args := []interface{}{viewerId, tag, viewerId, viewerId}
+	if page.After != nil {
+		query += ` AND (p.date < ? OR (p.date = ? AND p.id < ?))`
+		args = append(args, page.After.Time, page.After.Time, page.After.ID)
+	}
+	query += ` ORDER BY p.date DESC, p.id DESC LIMIT ?`
+	args = append(args, page.Limit)
+
+	rows, err := db.c.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	photos := make([]Photo, 0)
+	for rows.Next() {
+		p, err := scanPhotoDetails(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		photos = append(photos, p)
+	}
+	// As in GetPhotoDetails, the rows are closed before loading the comments
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return photos, db.attachComments(ctx, photos)
+}
+
+func (db *appdbimpl) SearchTags(ctx context.Context, viewerId uint64, prefix string, limit int) ([]Tag, error) {
+	// Names are compared byte by byte, so the range on the name (using the unique index) contains every name starting
+	// with the prefix: the upper bound is the prefix followed by the greatest character.
+	rows, err := db.c.QueryContext(ctx, `SELECT t.name, COUNT(*) FROM tags t
+		INNER JOIN photo_tags pt ON pt.tagId = t.id
+		INNER JOIN photos p ON p.id = pt.photoId
+		WHERE t.name >= ? AND t.name < ?
+		AND p.userId NOT IN (SELECT bannedUser FROM bans WHERE userId=?)
+		AND p.userId NOT IN (SELECT userId FROM bans WHERE bannedUser=?)
+		GROUP BY t.name
+		ORDER BY COUNT(*) DESC, t.name LIMIT ?`, prefix, prefix+string(utf8.MaxRune), viewerId, viewerId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]Tag, 0)
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.Name, &t.Photos); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
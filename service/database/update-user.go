@@ -1,9 +1,13 @@
 package database
 
-func (db *appdbimpl) UpdateUser(u User) (User, error) {
-	res, err := db.c.Exec(`UPDATE users SET username=? WHERE id=?`,
+import "context"
+
+func (db *appdbimpl) UpdateUser(ctx context.Context, u User) (User, error) {
+	res, err := db.c.ExecContext(ctx, `UPDATE users SET username=? WHERE id=?`,
 		u.Username, u.ID)
-	if err != nil {
+	if db.dialect.isUniqueViolation(err) {
+		return u, ErrUserExists
+	} else if err != nil {
 		return u, err
 	}
 
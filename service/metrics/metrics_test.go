@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Number of requests.", "route", "code")
+	requests.Inc("login", "200")
+	requests.Add(2, "login", "200")
+	requests.Inc(`a"b`, "500")
+	duration := r.NewHistogram("duration_seconds", "Duration.", []float64{0.1, 1})
+	duration.Observe(0.05)
+	duration.Observe(0.1)
+	duration.Observe(5)
+
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{route="a\"b",code="500"} 1
+requests_total{route="login",code="200"} 3
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1"} 2
+duration_seconds_bucket{le="1"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 5.15
+duration_seconds_count 3
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestDuplicatedMetric(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a duplicated metric didn't panic")
+		}
+	}()
+	r := NewRegistry()
+	r.NewCounter("requests_total", "")
+	r.NewCounter("requests_total", "")
+}
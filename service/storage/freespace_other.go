@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package storage
+
+// freeSpace is not implemented on this platform: the free space is not checked.
+func freeSpace(path string) (uint64, error) {
+	return 0, ErrFreeSpaceUnsupported
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrFreeSpaceUnsupported is returned by Local.FreeSpace on platforms where the free space can't be read
+var ErrFreeSpaceUnsupported = errors.New("free space not available on this platform")
+
+// Local is a BlobStore saving blobs as files in a folder of the local filesystem: the key is the path of the file,
+// relative to the folder. The folder must exist, subfolders are created when needed.
+//
+// Keys can also be absolute paths inside the folder: images uploaded before the storage package were saved with their
+// absolute path.
+type Local struct {
+	root string
+}
+
+// NewLocal returns a Local store saving blobs in the folder.
+func NewLocal(folder string) *Local {
+	return &Local{root: filepath.Clean(folder)}
+}
+
+// Folder returns the folder where blobs are saved
+func (l *Local) Folder() string {
+	return l.root
+}
+
+// path returns the path of the file of the blob.
+func (l *Local) path(key string) (string, error) {
+	if filepath.IsAbs(key) {
+		rel, err := filepath.Rel(l.root, key)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%w: %q is not in %s", ErrInvalidKey, key, l.root)
+		}
+		return key, nil
+	}
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	// The folder itself is not created: if it's missing, the configuration (or a volume mount) is wrong
+	if _, err := os.Stat(l.root); err != nil {
+		return fmt.Errorf("images folder: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// The blob is written in a temporary file, renamed when complete
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, BlobInfo{}, ErrNotFound
+	} else if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, BlobInfo{}, err
+	}
+	return f, newLocalInfo(key, stat), nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	stat, err := os.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return BlobInfo{}, ErrNotFound
+	} else if err != nil {
+		return BlobInfo{}, err
+	}
+	return newLocalInfo(key, stat), nil
+}
+
+// PresignedURL is not supported: blobs are served by the API server.
+func (l *Local) PresignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+// FreeSpace returns the space available to unprivileged users in the filesystem of the folder, in bytes, or
+// ErrFreeSpaceUnsupported.
+func (l *Local) FreeSpace() (uint64, error) {
+	return freeSpace(l.root)
+}
+
+// newLocalInfo returns the information about the file of the blob. The content type is guessed from the extension, as
+// it's not saved.
+func newLocalInfo(key string, stat fs.FileInfo) BlobInfo {
+	return BlobInfo{
+		Key:         key,
+		Size:        stat.Size(),
+		ContentType: mime.TypeByExtension(strings.ToLower(path.Ext(key))),
+		ModTime:     stat.ModTime(),
+	}
+}
@@ -0,0 +1,57 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/storage"
+	"sapienza/azzurra/wasaphoto/service/storage/storagetest"
+)
+
+func TestLocalConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.BlobStore {
+		return storage.NewLocal(t.TempDir())
+	})
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := storage.NewLocal(dir)
+
+	// Blobs are files in the folder
+	if err := store.Put(ctx, "1/photo.png", []byte("png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "1", "photo.png")); err != nil || string(data) != "png" {
+		t.Errorf("file: got %q, %v", data, err)
+	}
+	if files, _ := os.ReadDir(filepath.Join(dir, "1")); len(files) != 1 {
+		t.Errorf("got %d files, want no temporary files left", len(files))
+	}
+
+	// Absolute paths in the folder are accepted, other absolute paths are not
+	if _, err := store.Stat(ctx, filepath.Join(dir, "1", "photo.png")); err != nil {
+		t.Errorf("absolute path: %v", err)
+	}
+	if _, err := store.Stat(ctx, filepath.Join(filepath.Dir(dir), "photo.png")); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Errorf("absolute path outside the folder: got %v, want ErrInvalidKey", err)
+	}
+
+	if _, err := store.PresignedURL(ctx, "1/photo.png", time.Minute); !errors.Is(err, storage.ErrPresignUnsupported) {
+		t.Errorf("PresignedURL: got %v, want ErrPresignUnsupported", err)
+	}
+
+	// The folder is not created
+	missing := storage.NewLocal(filepath.Join(dir, "missing"))
+	if err := missing.Put(ctx, "1/photo.png", []byte("png"), "image/png"); err == nil {
+		t.Errorf("missing folder: Put succeeded")
+	}
+	if free, err := store.FreeSpace(); err != nil && !errors.Is(err, storage.ErrFreeSpaceUnsupported) {
+		t.Errorf("FreeSpace: %d, %v", free, err)
+	}
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPresignTTL is the maximum validity of presigned URLs allowed by S3
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// S3Config is the configuration of an S3 store
+type S3Config struct {
+	// Endpoint is the URL of the service, e.g. https://s3.eu-south-1.amazonaws.com or http://localhost:9000 (MinIO)
+	Endpoint string
+
+	// Region of the bucket. Default is us-east-1
+	Region string
+
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// PathStyle puts the bucket in the path of the URLs (http://host/bucket/key) instead of the host name
+	// (http://bucket.host/key). It's required by most S3-compatible services, like MinIO.
+	PathStyle bool
+
+	// Client is the HTTP client used for requests. Default is a client with a timeout of 1 minute
+	Client *http.Client
+}
+
+// S3 is a BlobStore saving blobs as objects in a bucket of an S3-compatible object storage. Requests are signed with
+// AWS Signature Version 4.
+type S3 struct {
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool
+	signer    signer
+	client    *http.Client
+
+	// now returns the current time, used for signatures
+	now func() time.Time
+}
+
+// NewS3 returns an S3 store. No request is sent: the bucket must already exist.
+func NewS3(cfg S3Config) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: bucket is required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3: access key and secret key are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: time.Minute}
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/")
+
+	return &S3{
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		pathStyle: cfg.PathStyle,
+		signer: signer{
+			accessKey: cfg.AccessKey,
+			secretKey: cfg.SecretKey,
+			region:    cfg.Region,
+		},
+		client: cfg.Client,
+		now:    time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of the object with the key.
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path += "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+	// The path is sent encoded as in the signature
+	u.RawPath = uriEncode(u.Path, false)
+	return &u
+}
+
+// do sends the signed request for the object with the key. Responses with a status other than 2xx are returned as
+// errors: ErrNotFound for 404.
+func (s *S3) do(ctx context.Context, method string, key string, body []byte, header http.Header) (*http.Response, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.signer.signRequest(req, hashHex(body), s.now())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %s %s: %w", method, key, err)
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	// Errors have an XML body (except for HEAD requests)
+	var s3err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	_ = xml.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&s3err)
+	if s3err.Code == "" {
+		s3err.Code = res.Status
+	}
+	return nil, fmt.Errorf("s3: %s %s: %s %s", method, key, s3err.Code, s3err.Message)
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	res, err := s.do(ctx, http.MethodPut, key, data, header)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return res.Body.Close()
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	return res.Body, newS3Info(key, res), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	res, err := s.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	_ = res.Body.Close()
+	return newS3Info(key, res), nil
+}
+
+// PresignedURL returns a presigned GET URL of the object. The ttl must be between 1 second and 7 days. The existence of
+// the object is not checked.
+func (s *S3) PresignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	} else if ttl < time.Second || ttl > maxPresignTTL {
+		return "", fmt.Errorf("s3: invalid presigned URL validity %s", ttl)
+	}
+	return s.signer.presign(http.MethodGet, s.objectURL(key), ttl, s.now()).String(), nil
+}
+
+// newS3Info returns the information about the object in the response headers.
+func newS3Info(key string, res *http.Response) BlobInfo {
+	info := BlobInfo{
+		Key:         key,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+	}
+	if size, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+	info.ModTime, _ = http.ParseTime(res.Header.Get("Last-Modified"))
+	return info
+}
@@ -0,0 +1,100 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/storage"
+	"sapienza/azzurra/wasaphoto/service/storage/s3fake"
+	"sapienza/azzurra/wasaphoto/service/storage/storagetest"
+)
+
+// newS3 returns an S3 store using a new fake S3 service.
+func newS3(t *testing.T, accessKey string) (*storage.S3, *s3fake.Server) {
+	t.Helper()
+	fake := s3fake.New("photos", "test-access-key")
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	store, err := storage.NewS3(storage.S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "photos",
+		AccessKey: accessKey,
+		SecretKey: "test-secret-key",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, fake
+}
+
+func TestS3Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.BlobStore {
+		store, _ := newS3(t, "test-access-key")
+		return store
+	})
+}
+
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	store, fake := newS3(t, "test-access-key")
+
+	if err := store.Put(ctx, "1/photo 1.png", []byte("png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := fake.Keys(); len(keys) != 1 || keys[0] != "1/photo 1.png" {
+		t.Errorf("got keys %v", keys)
+	}
+
+	// The presigned URL can be downloaded without credentials
+	u, err := store.PresignedURL(ctx, "1/photo 1.png", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(u, "/photos/1/photo%201.png?") || !strings.Contains(u, "X-Amz-Expires=60&") {
+		t.Errorf("got URL %s", u)
+	}
+	res, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "png" || res.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("presigned URL: got status %d, %q", res.StatusCode, body)
+	}
+	if _, err := store.PresignedURL(ctx, "1/photo 1.png", 8*24*time.Hour); err == nil {
+		t.Errorf("PresignedURL: a validity of 8 days is accepted")
+	}
+
+	// Errors of the service are returned
+	wrong, _ := newS3(t, "wrong-access-key")
+	err = wrong.Put(ctx, "1/photo.png", []byte("png"), "image/png")
+	if err == nil || errors.Is(err, storage.ErrNotFound) || !strings.Contains(err.Error(), "InvalidAccessKeyId") {
+		t.Errorf("wrong access key: got %v", err)
+	}
+}
+
+func TestNewS3(t *testing.T) {
+	valid := storage.S3Config{Endpoint: "https://s3.example.com", Bucket: "b", AccessKey: "a", SecretKey: "s"}
+	if _, err := storage.NewS3(valid); err != nil {
+		t.Errorf("valid configuration: %v", err)
+	}
+	for name, change := range map[string]func(*storage.S3Config){
+		"no bucket":        func(c *storage.S3Config) { c.Bucket = "" },
+		"no credentials":   func(c *storage.S3Config) { c.SecretKey = "" },
+		"invalid endpoint": func(c *storage.S3Config) { c.Endpoint = "s3.example.com" },
+	} {
+		cfg := valid
+		change(&cfg)
+		if _, err := storage.NewS3(cfg); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Package s3fake is an in-process fake of an S3-compatible object storage, meant for tests: it needs no S3 service, and
+every instance starts empty.
+
+A Server serves a single bucket with path-style URLs (http://host/bucket/key), and implements the part of the S3 API
+used by storage.S3: PutObject, GetObject, HeadObject and DeleteObject, authenticated with the Authorization header or
+with presigned URLs. Requests are checked for the access key, the payload hash and the expiration of presigned URLs, but
+signatures are not verified: the signer is tested against the examples of the S3 documentation.
+
+	srv := httptest.NewServer(s3fake.New("bucket", "access-key"))
+	defer srv.Close()
+	store, err := storage.NewS3(storage.S3Config{Endpoint: srv.URL, Bucket: "bucket", ..., PathStyle: true})
+*/
+package s3fake
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// Server is the fake S3 service, an http.Handler. It's safe for concurrent use.
+type Server struct {
+	bucket    string
+	accessKey string
+
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+// New returns a Server with an empty bucket, accepting requests signed with the access key.
+func New(bucket string, accessKey string) *Server {
+	return &Server{
+		bucket:    bucket,
+		accessKey: accessKey,
+		objects:   map[string]object{},
+	}
+}
+
+// Keys returns the keys of the objects in the bucket, sorted.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/"+s.bucket+"/")
+	if key == r.URL.Path || key == "" {
+		sendError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	presigned := r.URL.Query().Has("X-Amz-Signature")
+	if code, message := s.authenticate(r, presigned); code != "" {
+		sendError(w, http.StatusForbidden, code, message)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPut && !presigned:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		sum := sha256.Sum256(data)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			sendError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed")
+			return
+		}
+		s.mu.Lock()
+		s.objects[key] = object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		s.mu.Lock()
+		obj, ok := s.objects[key]
+		s.mu.Unlock()
+		if !ok {
+			sendError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		http.ServeContent(w, r, "", obj.modTime, bytes.NewReader(obj.data))
+
+	case r.Method == http.MethodDelete && !presigned:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+	}
+}
+
+// authenticate checks the credentials of the request, returning the code and the message of the error (if any).
+func (s *Server) authenticate(r *http.Request, presigned bool) (string, string) {
+	if presigned {
+		query := r.URL.Query()
+		date, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+		expires, _ := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if !strings.HasPrefix(query.Get("X-Amz-Credential"), s.accessKey+"/") {
+			return "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records."
+		} else if err != nil || time.Now().After(date.Add(time.Duration(expires)*time.Second)) {
+			return "AccessDenied", "Request has expired"
+		}
+		return "", ""
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/") {
+		return "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records."
+	} else if !strings.Contains(auth, ",Signature=") || r.Header.Get("X-Amz-Date") == "" {
+		return "AccessDenied", "Missing signature"
+	}
+	return "", ""
+}
+
+// sendError sends an S3 error response. The body is omitted for HEAD requests by the http package.
+func sendError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4, as described in https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const (
+	sigAlgorithm = "AWS4-HMAC-SHA256"
+	sigTimeFmt   = "20060102T150405Z"
+
+	// unsignedPayload is the payload hash of presigned URLs
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// signer signs S3 requests with the credentials
+type signer struct {
+	accessKey string
+	secretKey string
+	region    string
+}
+
+// scope returns the credential scope of requests signed at t.
+func (s signer) scope(t time.Time) string {
+	return t.UTC().Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signRequest adds the Authorization header to the request. The headers needed by S3 (X-Amz-Date and
+// X-Amz-Content-Sha256) are added too. payloadHash is the hex SHA-256 of the body.
+func (s signer) signRequest(req *http.Request, payloadHash string, t time.Time) {
+	req.Header.Set("X-Amz-Date", t.UTC().Format(sigTimeFmt))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// The host, the content type, the range and the x-amz-* headers are signed
+	headers := http.Header{"Host": {requestHost(req)}}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[name] = values
+		}
+	}
+	signedHeaders, signature := s.signature(req.Method, req.URL, headers, payloadHash, t)
+	req.Header.Set("Authorization", sigAlgorithm+" Credential="+s.accessKey+"/"+s.scope(t)+
+		",SignedHeaders="+signedHeaders+",Signature="+signature)
+}
+
+// presign returns the URL with the signature in the query string, valid for ttl from t. Only the host is signed.
+func (s signer) presign(method string, u *url.URL, ttl time.Duration, t time.Time) *url.URL {
+	presigned := *u
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigAlgorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.UTC().Format(sigTimeFmt))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(ttl/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	presigned.RawQuery = canonicalQuery(query)
+
+	_, signature := s.signature(method, &presigned, http.Header{"Host": {u.Host}}, unsignedPayload, t)
+	query.Set("X-Amz-Signature", signature)
+	presigned.RawQuery = canonicalQuery(query)
+	return &presigned
+}
+
+// signature returns the signed headers and the signature of the request. All headers are signed.
+func (s signer) signature(method string, u *url.URL, headers http.Header, payloadHash string, t time.Time) (string, string) {
+	names := make([]string, 0, len(headers))
+	values := map[string]string{}
+	for name, v := range headers {
+		lower := strings.ToLower(name)
+		names = append(names, lower)
+		trimmed := make([]string, len(v))
+		for i := range v {
+			trimmed[i] = strings.Join(strings.Fields(v[i]), " ")
+		}
+		values[lower] = strings.Join(trimmed, ",")
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		uriEncode(u.Path, false),
+		canonicalQuery(u.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		sigAlgorithm,
+		t.UTC().Format(sigTimeFmt),
+		s.scope(t),
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.UTC().Format("20060102"))
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalQuery returns the query string sorted by name, with names and values encoded as required by the signature.
+func canonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, v := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent-encodes every byte except the unreserved characters (and "/", unless encodeSlash is true).
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+// requestHost returns the Host header sent with the request.
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
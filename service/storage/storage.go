@@ -0,0 +1,69 @@
+/*
+Package storage stores the image files of the photos (blobs). BlobStore is implemented by Local, which saves the blobs
+as files in a folder, and by S3, which saves them as objects in a bucket of an S3-compatible object storage (Amazon S3,
+MinIO, ...).
+
+Blobs are identified by keys: relative, slash-separated paths like `12/0b7e5a7c-9a8e-4d3a-a2a4-2d0f7d3a1a1b.jpg`.
+Blobs are written once and never modified: a new version of an image is saved with a new key.
+
+The conformance test suite for the implementations is in the storagetest package.
+*/
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the blob doesn't exist
+var ErrNotFound = errors.New("blob not found")
+
+// ErrPresignUnsupported is returned by BlobStore.PresignedURL when the store can't create presigned URLs (e.g., Local)
+var ErrPresignUnsupported = errors.New("presigned URLs are not supported")
+
+// ErrInvalidKey is returned when the key is not a valid relative path (e.g., it contains ".." or empty segments)
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobInfo describes a blob
+type BlobInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// BlobStore saves and reads blobs by key. All methods are safe for concurrent use.
+type BlobStore interface {
+	// Put saves the blob with the key, replacing the existing one (if any). Readers never see partially written blobs.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+
+	// Get returns the content of the blob, which must be closed by the caller, or ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+
+	// Delete removes the blob. Removing a blob that doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// Stat returns the information about the blob, or ErrNotFound.
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+
+	// PresignedURL returns a URL where the blob can be downloaded without credentials for the ttl duration, or
+	// ErrPresignUnsupported.
+	PresignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// checkKey checks that the key is a relative, slash-separated path, without empty, "." or ".." segments.
+func checkKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "\\\x00") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+/*
+Package storagetest contains the conformance test suite for the implementations of storage.BlobStore. Every
+implementation must pass it, so that the rest of the code can rely on the same behavior regardless of where the blobs
+are saved.
+
+To run the suite, call Run from a test with a function that returns a new, empty BlobStore:
+
+	func TestConformance(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.BlobStore {
+			...
+		})
+	}
+*/
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"sapienza/azzurra/wasaphoto/service/storage"
+)
+
+// Factory returns a new, empty and ready to use BlobStore. It's called once for each test of the suite.
+type Factory func(t *testing.T) storage.BlobStore
+
+// Run runs the conformance test suite against the BlobStore instances returned by newStore.
+func Run(t *testing.T, newStore Factory) {
+	var tests = []struct {
+		name string
+		fn   func(*testing.T, storage.BlobStore)
+	}{
+		{"PutGet", testPutGet},
+		{"Overwrite", testOverwrite},
+		{"Delete", testDelete},
+		{"NotFound", testNotFound},
+		{"InvalidKeys", testInvalidKeys},
+		{"Concurrent", testConcurrent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// read returns the content of the blob.
+func read(t *testing.T, store storage.BlobStore, key string) ([]byte, storage.BlobInfo) {
+	t.Helper()
+	body, info, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("Get(%q): reading: %v", key, err)
+	}
+	return data, info
+}
+
+func put(t *testing.T, store storage.BlobStore, key string, data []byte, contentType string) {
+	t.Helper()
+	if err := store.Put(context.Background(), key, data, contentType); err != nil {
+		t.Fatalf("Put(%q): %v", key, err)
+	}
+}
+
+func testPutGet(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Minute)
+	data := []byte("\x89PNG\r\n\x1a\nnot really an image")
+
+	put(t, store, "1/photo.png", data, "image/png")
+	put(t, store, "1/photo_thumb.jpg", []byte("thumb"), "image/jpeg")
+	put(t, store, "empty.png", nil, "image/png")
+
+	got, info := read(t, store, "1/photo.png")
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %q, want %q", got, data)
+	}
+	if info.Key != "1/photo.png" || info.Size != int64(len(data)) || info.ContentType != "image/png" || info.ModTime.Before(start) {
+		t.Errorf("Get: got %+v", info)
+	}
+
+	stat, err := store.Stat(ctx, "1/photo.png")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	} else if stat.Size != info.Size || stat.ContentType != info.ContentType || !stat.ModTime.Equal(info.ModTime) {
+		t.Errorf("Stat: got %+v, want %+v", stat, info)
+	}
+
+	if got, info := read(t, store, "empty.png"); len(got) != 0 || info.Size != 0 {
+		t.Errorf("empty blob: got %d bytes, %+v", len(got), info)
+	}
+	if got, _ := read(t, store, "1/photo_thumb.jpg"); string(got) != "thumb" {
+		t.Errorf("second blob: got %q", got)
+	}
+}
+
+func testOverwrite(t *testing.T, store storage.BlobStore) {
+	put(t, store, "a/b.jpg", []byte("first"), "image/jpeg")
+	put(t, store, "a/b.jpg", []byte("second version"), "image/jpeg")
+
+	if got, info := read(t, store, "a/b.jpg"); string(got) != "second version" || info.Size != int64(len(got)) {
+		t.Errorf("got %q, %+v", got, info)
+	}
+}
+
+func testDelete(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+	put(t, store, "1/a.png", []byte("a"), "image/png")
+	put(t, store, "1/b.png", []byte("b"), "image/png")
+
+	if err := store.Delete(ctx, "1/a.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Stat(ctx, "1/a.png"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat after delete: got %v, want ErrNotFound", err)
+	}
+	if got, _ := read(t, store, "1/b.png"); string(got) != "b" {
+		t.Errorf("other blob: got %q", got)
+	}
+
+	// Deleting again is not an error
+	if err := store.Delete(ctx, "1/a.png"); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+}
+
+func testNotFound(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+	if _, _, err := store.Get(ctx, "missing/photo.png"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get: got %v, want ErrNotFound", err)
+	}
+	if _, err := store.Stat(ctx, "missing.png"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat: got %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "missing/photo.png"); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+}
+
+func testInvalidKeys(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+	for _, key := range []string{"", "../photo.png", "1/../../photo.png", "1//photo.png", "./photo.png", "1/", "a\\b.png"} {
+		if err := store.Put(ctx, key, []byte("x"), "image/png"); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Put(%q): got %v, want ErrInvalidKey", key, err)
+		}
+		if _, _, err := store.Get(ctx, key); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Get(%q): got %v, want ErrInvalidKey", key, err)
+		}
+		if err := store.Delete(ctx, key); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Delete(%q): got %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func testConcurrent(t *testing.T, store storage.BlobStore) {
+	// Readers never see partially written blobs
+	small, large := []byte("small"), bytes.Repeat([]byte("large"), 64<<10)
+	put(t, store, "c/photo.jpg", small, "image/jpeg")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := store.Put(context.Background(), "c/photo.jpg", large, "image/jpeg"); err != nil {
+				t.Errorf("Put: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			body, _, err := store.Get(context.Background(), "c/photo.jpg")
+			if err != nil {
+				t.Errorf("Get: %v", err)
+				return
+			}
+			defer body.Close()
+			if got, err := io.ReadAll(body); err != nil || (!bytes.Equal(got, small) && !bytes.Equal(got, large)) {
+				t.Errorf("Get: got %d bytes, %v", len(got), err)
+			}
+		}()
+	}
+	wg.Wait()
+}